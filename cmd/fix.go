@@ -162,16 +162,19 @@ func runFixLocation(ctx *cli.Context) {
 	fmt.Print("Press <enter> to continue, use <Ctrl+c> to exit.")
 	fmt.Scanln()
 
-	// Fix in authorized_keys file.
-	sshPath := path.Join(models.SshPath, "authorized_keys")
-	fmt.Printf("Fixing pathes in file: %s\n", sshPath)
-	if err := rewriteAuthorizedKeys(sshPath, oldPath, execPath); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	setting.NewConfigContext()
+
+	// Fix in authorized_keys file, which is not used if keys are looked up by keys command.
+	if !setting.DisableSshAuthorizedKeys {
+		sshPath := path.Join(models.SshPath, "authorized_keys")
+		fmt.Printf("Fixing pathes in file: %s\n", sshPath)
+		if err := rewriteAuthorizedKeys(sshPath, oldPath, execPath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 
 	// Fix position in gogs-repositories.
-	setting.NewConfigContext()
 	fmt.Printf("Fixing pathes in repositories: %s\n", setting.RepoRootPath)
 	if err := walkDir(setting.RepoRootPath, "", execPath, 0); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,62 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+var CmdKeys = cli.Command{
+	Name:  "keys",
+	Usage: "This command should only be called by SSH server as AuthorizedKeysCommand",
+	Description: `Keys prints the authorized_keys line of the public key that is given
+by its fingerprint, or by its type and content, so that authorized_keys file is not needed`,
+	Action: runKeys,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "expected, e", Value: "", Usage: "user that keys are looked up for, default is RUN_USER"},
+		cli.StringFlag{Name: "username, u", Value: "", Usage: "user that is trying to log in (%u)"},
+		cli.StringFlag{Name: "fingerprint, f", Value: "", Usage: "fingerprint of the key (%f)"},
+		cli.StringFlag{Name: "type, t", Value: "", Usage: "type of the key (%t)"},
+		cli.StringFlag{Name: "content, k", Value: "", Usage: "base64 encoded content of the key (%k)"},
+	},
+}
+
+func runKeys(c *cli.Context) {
+	setup("keys.log")
+
+	// Keys of other system users are not managed by Gogs.
+	expected := c.String("expected")
+	if len(expected) == 0 {
+		expected = setting.RunUser
+	}
+	if len(expected) > 0 && len(c.String("username")) > 0 && c.String("username") != expected {
+		return
+	}
+
+	var key *models.PublicKey
+	err := models.ErrKeyNotExist
+	if len(c.String("fingerprint")) > 0 {
+		key, err = models.GetPublicKeyByFingerprint(c.String("fingerprint"))
+	}
+	// Fingerprints of keys that are added with older ssh-keygen may be in another format.
+	if err == models.ErrKeyNotExist && len(c.String("type")) > 0 && len(c.String("content")) > 0 {
+		key, err = models.GetPublicKeyByContent(c.String("type") + " " + c.String("content"))
+	}
+	if err != nil {
+		if err == models.ErrKeyNotExist {
+			return
+		}
+		println("Gogs: internal error:", err.Error())
+		log.GitLogger.Fatal(2, "Fail to get public key: %v", err)
+	}
+
+	fmt.Print(key.GetAuthorizedString())
+}
@@ -7,6 +7,7 @@ package cmd
 import (
 	"os"
 
+	"github.com/Unknwon/com"
 	"github.com/codegangsta/cli"
 
 	"github.com/gogits/gogs/models"
@@ -23,7 +24,8 @@ var CmdUpdate = cli.Command{
 
 func runUpdate(c *cli.Context) {
 	cmd := os.Getenv("SSH_ORIGINAL_COMMAND")
-	if cmd == "" {
+	userId := com.StrTo(os.Getenv(models.ENV_AUTH_USER_ID)).MustInt64()
+	if cmd == "" && userId == 0 {
 		return
 	}
 
@@ -36,6 +38,26 @@ func runUpdate(c *cli.Context) {
 		log.GitLogger.Fatal(2, "refName is empty, shouldn't use")
 	}
 
+	// Reject pushes that violate protected branches,
+	// non-zero exit status makes Git refuse to update the reference.
+	if userId > 0 {
+		repoUserName := os.Getenv(models.ENV_REPO_OWNER_NAME)
+		repoName := os.Getenv(models.ENV_REPO_NAME)
+		if err := models.CheckProtectBranch(repoUserName, repoName, args[0], args[1], args[2], userId); err != nil {
+			if _, ok := err.(models.ErrBranchProtected); ok {
+				println("Gogs:", err.Error())
+			} else {
+				println("Gogs: internal error:", err.Error())
+			}
+			log.GitLogger.Fatal(2, "CheckProtectBranch(%s/%s): %v", repoUserName, repoName, err)
+		}
+	}
+
+	// Pushes over HTTP are processed by web server.
+	if cmd == "" {
+		return
+	}
+
 	uuid := os.Getenv("uuid")
 
 	task := models.UpdateTask{
@@ -30,6 +30,7 @@ import (
 	"github.com/gogits/gogs/modules/middleware"
 	"github.com/gogits/gogs/modules/middleware/binding"
 	"github.com/gogits/gogs/modules/setting"
+	"github.com/gogits/gogs/modules/ssh"
 	"github.com/gogits/gogs/routers"
 	"github.com/gogits/gogs/routers/admin"
 	"github.com/gogits/gogs/routers/api/v1"
@@ -126,6 +127,7 @@ func runWeb(*cli.Context) {
 	m.Get("/", ignSignIn, routers.Home)
 	m.Get("/install", bindIgnErr(auth.InstallForm{}), routers.Install)
 	m.Post("/install", bindIgnErr(auth.InstallForm{}), routers.InstallPost)
+	m.Get("/explore/code", ignSignIn, repo.SearchGlobal)
 	m.Group("", func(r *macaron.Router) {
 		r.Get("/pulls", user.Pulls)
 		r.Get("/issues", user.Issues)
@@ -283,6 +285,9 @@ func runWeb(*cli.Context) {
 		r.Post("/settings", bindIgnErr(auth.RepoSettingForm{}), repo.SettingsPost)
 		m.Group("/settings", func(r *macaron.Router) {
 			r.Route("/collaboration", "GET,POST", repo.SettingsCollaboration)
+			r.Route("/branches", "GET,POST", repo.SettingsBranches)
+			r.Get("/branches/*", repo.SettingsProtectedBranch)
+			r.Post("/branches/*", bindIgnErr(auth.ProtectBranchForm{}), repo.SettingsProtectedBranchPost)
 			r.Get("/hooks", repo.Webhooks)
 			r.Get("/hooks/new", repo.WebHooksNew)
 			r.Post("/hooks/gogs/new", bindIgnErr(auth.NewWebhookForm{}), repo.WebHooksNewPost)
@@ -316,11 +321,36 @@ func runWeb(*cli.Context) {
 		})
 
 		r.Post("/comment/:action", repo.Comment)
+		r.Post("/commit/comment", bindIgnErr(auth.CreateLineCommentForm{}), repo.CreateLineComment)
+		r.Get("/pulls/new", repo.NewPullRequest)
+		r.Post("/pulls/new", bindIgnErr(auth.CreatePullRequestForm{}), repo.NewPullRequestPost)
+		r.Post("/branches/new", bindIgnErr(auth.CreateBranchForm{}), repo.CreateBranch)
+		r.Post("/branches/delete", repo.DeleteBranch)
+		r.Post("/tags/delete", repo.DeleteTag)
 		r.Get("/releases/new", repo.NewRelease)
 		r.Get("/releases/edit/:tagname", repo.EditRelease)
+
+		m.Group("/wiki", func(r *macaron.Router) {
+			r.Get("/_new", repo.NewWiki)
+			r.Post("/_new", bindIgnErr(auth.NewWikiForm{}), repo.NewWikiPost)
+			r.Get("/:page/_edit", repo.EditWiki)
+			r.Post("/:page/_edit", bindIgnErr(auth.NewWikiForm{}), repo.EditWikiPost)
+			r.Post("/:page/_delete", repo.DeleteWikiPagePost)
+		})
 	}, reqSignIn, middleware.RepoAssignment(true))
 
 	m.Group("/:username/:reponame", func(r *macaron.Router) {
+		r.Get("/_edit/:branchname/*", repo.EditFile)
+		r.Post("/_edit/:branchname/*", bindIgnErr(auth.EditRepoFileForm{}), repo.EditFilePost)
+		r.Get("/_new/:branchname", repo.NewFile)
+		r.Get("/_new/:branchname/*", repo.NewFile)
+		r.Post("/_new/:branchname", bindIgnErr(auth.EditRepoFileForm{}), repo.NewFilePost)
+		r.Get("/_delete/:branchname/*", repo.DeleteFile)
+		r.Post("/_delete/:branchname/*", bindIgnErr(auth.DeleteRepoFileForm{}), repo.DeleteFilePost)
+		r.Get("/_upload/:branchname", repo.UploadFile)
+		r.Get("/_upload/:branchname/*", repo.UploadFile)
+		r.Post("/_upload/:branchname", bindIgnErr(auth.UploadRepoFileForm{}), repo.UploadFilePost)
+		r.Post("/pulls/:index/merge", repo.MergePullRequest)
 		r.Post("/releases/new", bindIgnErr(auth.NewReleaseForm{}), repo.NewReleasePost)
 		r.Post("/releases/edit/:tagname", bindIgnErr(auth.EditReleaseForm{}), repo.EditReleasePost)
 	}, reqSignIn, middleware.RepoAssignment(true, true))
@@ -328,24 +358,49 @@ func runWeb(*cli.Context) {
 	m.Group("/:username/:reponame", func(r *macaron.Router) {
 		r.Get("/issues", repo.Issues)
 		r.Get("/issues/:index", repo.ViewIssue)
+		r.Get("/forks", repo.Forks)
 		r.Get("/pulls", repo.Pulls)
+		r.Get("/pulls/:index", repo.ViewPull)
+		r.Get("/pulls/:index/commits", repo.ViewPullCommits)
+		r.Get("/pulls/:index/files", repo.ViewPullFiles)
 		r.Get("/branches", repo.Branches)
+		r.Get("/wiki", repo.Wiki)
+		r.Get("/wiki/_pages", repo.WikiPages)
+		r.Get("/wiki/:page", repo.Wiki)
+		r.Get("/wiki/:page/_history", repo.WikiHistory)
 	}, ignSignIn, middleware.RepoAssignment(true))
 
 	m.Group("/:username/:reponame", func(r *macaron.Router) {
 		r.Get("/src/:branchname", repo.Home)
 		r.Get("/src/:branchname/*", repo.Home)
 		r.Get("/raw/:branchname/*", repo.SingleDownload)
+		r.Get("/blame/:branchname/*", repo.Blame)
 		r.Get("/commits/:branchname", repo.Commits)
 		r.Get("/commits/:branchname/search", repo.SearchCommits)
 		r.Get("/commits/:branchname/*", repo.FileHistory)
+		r.Get("/graph", repo.Graph)
+		r.Get("/graph/data", repo.GraphData)
+		r.Get("/activity", repo.Activity)
+		r.Get("/activity/:branchname", repo.Activity)
+		r.Get("/search", repo.Search)
+		r.Get("/commit/:sha([a-z0-9]+).:ext(patch|diff)", repo.RawDiff)
 		r.Get("/commit/:branchname", repo.Diff)
 		r.Get("/commit/:branchname/*", repo.Diff)
 		r.Get("/releases", repo.Releases)
-		r.Get("/archive/*.*", repo.Download)
+		r.Get("/archive/*", repo.Download)
+		r.Get("/compare/:before([a-z0-9]+)...:after([a-z0-9]+).:ext(patch|diff)", repo.RawDiff)
 		r.Get("/compare/:before([a-z0-9]+)...:after([a-z0-9]+)", repo.CompareDiff)
 	}, ignSignIn, middleware.RepoAssignment(true, true))
 
+	if setting.LFSStartServer {
+		m.Group("/:username/:reponame/info/lfs", func(r *macaron.Router) {
+			r.Post("/objects/batch", repo.LFSBatch)
+			r.Get("/objects/:oid", repo.LFSDownload)
+			r.Put("/objects/:oid", repo.LFSUpload)
+			r.Post("/verify", repo.LFSVerify)
+		}, ignSignInAndCsrf)
+	}
+
 	m.Group("/:username", func(r *macaron.Router) {
 		r.Get("/:reponame", middleware.RepoAssignment(true, true, true), repo.Home)
 		m.Group("/:reponame", func(r *macaron.Router) {
@@ -357,6 +412,13 @@ func runWeb(*cli.Context) {
 	m.NotFound(routers.NotFound)
 
 	var err error
+	if setting.StartSshServer {
+		if err = ssh.Listen(setting.SshListenHost, setting.SshListenPort, setting.SshHostKeyPath); err != nil {
+			log.Fatal(4, "Fail to start SSH server: %v", err)
+		}
+		log.Info("SSH server listen: %s:%d", setting.SshListenHost, setting.SshListenPort)
+	}
+
 	listenAddr := fmt.Sprintf("%s:%s", setting.HttpAddr, setting.HttpPort)
 	log.Info("Listen: %v://%s", setting.Protocol, listenAddr)
 	switch setting.Protocol {
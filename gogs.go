@@ -32,6 +32,7 @@ func main() {
 	app.Commands = []cli.Command{
 		cmd.CmdWeb,
 		cmd.CmdServ,
+		cmd.CmdKeys,
 		cmd.CmdUpdate,
 		cmd.CmdFix,
 		cmd.CmdDump,
@@ -0,0 +1,142 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gogits/gogs/modules/git"
+)
+
+// EMPTY_SHA is the commit ID Git uses for references that do not exist.
+const EMPTY_SHA = "0000000000000000000000000000000000000000"
+
+var (
+	ErrBranchAlreadyExist   = errors.New("Branch already exist")
+	ErrBranchNotExist       = errors.New("Branch does not exist")
+	ErrTagNotExist          = errors.New("Tag does not exist")
+	ErrDeleteDefaultBranch  = errors.New("Default branch cannot be deleted")
+	ErrRevisionNotExist     = errors.New("Revision does not exist")
+	ErrReferenceNameIllegal = errors.New("Reference name contains illegal characters")
+)
+
+// IsLegalReferenceName returns true if given name can be used as a branch or tag name.
+func IsLegalReferenceName(name string) bool {
+	if len(name) == 0 || name[0] == '-' || name[0] == '/' || name[len(name)-1] == '/' ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") || name == "@" {
+		return false
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "//") ||
+		strings.Contains(name, "@{") || strings.Contains(name, "/.") || name[0] == '.' {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c == 0x7f || strings.ContainsRune("~^:?*[\\", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func openRepository(repo *Repository) (*git.Repository, error) {
+	if repo.Owner == nil {
+		if err := repo.GetOwner(); err != nil {
+			return nil, fmt.Errorf("GetOwner: %v", err)
+		}
+	}
+	gitRepo, err := git.OpenRepository(RepoPath(repo.Owner.Name, repo.Name))
+	if err != nil {
+		return nil, fmt.Errorf("OpenRepository: %v", err)
+	}
+	return gitRepo, nil
+}
+
+// CreateBranch creates a new branch of repository that starts from given revision,
+// which can be a branch, a tag or a commit ID.
+func CreateBranch(doer *User, repo *Repository, branchName, startPoint string) error {
+	if !IsLegalReferenceName(branchName) {
+		return ErrReferenceNameIllegal
+	}
+
+	gitRepo, err := openRepository(repo)
+	if err != nil {
+		return err
+	}
+	if gitRepo.IsBranchExist(branchName) {
+		return ErrBranchAlreadyExist
+	}
+
+	commitId, err := gitRepo.GetCommitIdOfRevision(startPoint)
+	if err != nil {
+		return ErrRevisionNotExist
+	}
+
+	refName := "refs/heads/" + branchName
+	if err = CheckProtectBranch(repo.Owner.Name, repo.Name, refName, EMPTY_SHA, commitId, doer.Id); err != nil {
+		return err
+	}
+	if err = gitRepo.CreateBranch(branchName, commitId); err != nil {
+		return fmt.Errorf("CreateBranch: %v", err)
+	}
+
+	// Go through normal update process, so feeds and webhooks are triggered.
+	return Update(refName, EMPTY_SHA, commitId, doer.Name, repo.Owner.Name, repo.Name, doer.Id)
+}
+
+// DeleteBranch deletes given branch of repository,
+// default branch and protected branches that disabled deletion cannot be deleted.
+func DeleteBranch(doer *User, repo *Repository, branchName string) error {
+	if branchName == repo.DefaultBranch {
+		return ErrDeleteDefaultBranch
+	}
+
+	gitRepo, err := openRepository(repo)
+	if err != nil {
+		return err
+	}
+	if !gitRepo.IsBranchExist(branchName) {
+		return ErrBranchNotExist
+	}
+
+	commitId, err := gitRepo.GetCommitIdOfBranch(branchName)
+	if err != nil {
+		return fmt.Errorf("GetCommitIdOfBranch: %v", err)
+	}
+
+	refName := "refs/heads/" + branchName
+	if err = CheckProtectBranch(repo.Owner.Name, repo.Name, refName, commitId, EMPTY_SHA, doer.Id); err != nil {
+		return err
+	}
+	if err = gitRepo.DeleteBranch(branchName); err != nil {
+		return fmt.Errorf("DeleteBranch: %v", err)
+	}
+	return Update(refName, commitId, EMPTY_SHA, doer.Name, repo.Owner.Name, repo.Name, doer.Id)
+}
+
+// DeleteTag deletes given tag of repository along with its release.
+func DeleteTag(doer *User, repo *Repository, tagName string) error {
+	gitRepo, err := openRepository(repo)
+	if err != nil {
+		return err
+	}
+	if !gitRepo.IsTagExist(tagName) {
+		return ErrTagNotExist
+	}
+
+	commitId, err := gitRepo.GetCommitIdOfTag(tagName)
+	if err != nil {
+		return fmt.Errorf("GetCommitIdOfTag: %v", err)
+	}
+
+	if err = gitRepo.DeleteTag(tagName); err != nil {
+		return fmt.Errorf("DeleteTag: %v", err)
+	}
+	if _, err = x.Delete(&Release{RepoId: repo.Id, LowerTagName: strings.ToLower(tagName)}); err != nil {
+		return err
+	}
+	return Update("refs/tags/"+tagName, commitId, EMPTY_SHA, doer.Name, repo.Owner.Name, repo.Name, doer.Id)
+}
@@ -10,8 +10,10 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/Unknwon/com"
 
@@ -19,6 +21,7 @@ import (
 
 	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/process"
+	"github.com/gogits/gogs/modules/setting"
 )
 
 // Diff line types.
@@ -29,149 +32,504 @@ const (
 	DIFF_LINE_SECTION
 )
 
+// Diff file types.
 const (
 	DIFF_FILE_ADD = iota + 1
 	DIFF_FILE_CHANGE
 	DIFF_FILE_DEL
+	DIFF_FILE_RENAME
+	DIFF_FILE_COPY
 )
 
+// DiffLineSegment represents a part of content of a diff line,
+// changed segments are the ones that differ from the paired line.
+type DiffLineSegment struct {
+	Content   string
+	IsChanged bool
+}
+
 type DiffLine struct {
 	LeftIdx  int
 	RightIdx int
 	Type     int
 	Content  string
+	Comments []*Comment
+	// Segments is only set for paired deleted and added lines
+	// that have intra-line changes to highlight.
+	Segments []*DiffLineSegment
 }
 
 func (d DiffLine) GetType() int {
 	return d.Type
 }
 
+// CommentLine returns the line number that comments refer to,
+// negative number means line of old file.
+func (d DiffLine) CommentLine() int64 {
+	if d.Type == DIFF_LINE_DEL {
+		return -int64(d.LeftIdx)
+	}
+	return int64(d.RightIdx)
+}
+
 type DiffSection struct {
 	Name  string
 	Lines []*DiffLine
 }
 
+// DiffSplitLine represents a row of side-by-side diff view,
+// either side is nil when the line has no counterpart on that side.
+type DiffSplitLine struct {
+	Left, Right *DiffLine
+}
+
+// IsSection returns true if the row is header of a section.
+func (l *DiffSplitLine) IsSection() bool {
+	return l.Left != nil && l.Left.Type == DIFF_LINE_SECTION
+}
+
+// Comments returns line comments of both sides of the row.
+func (l *DiffSplitLine) Comments() []*Comment {
+	var comments []*Comment
+	if l.Left != nil {
+		comments = append(comments, l.Left.Comments...)
+	}
+	if l.Right != nil && l.Right != l.Left {
+		comments = append(comments, l.Right.Comments...)
+	}
+	return comments
+}
+
+// SplitLines returns lines of section in side-by-side form,
+// deleted lines are paired with added lines that follow them.
+func (s *DiffSection) SplitLines() []*DiffSplitLine {
+	lines := make([]*DiffSplitLine, 0, len(s.Lines))
+	for i := 0; i < len(s.Lines); {
+		if s.Lines[i].Type != DIFF_LINE_DEL && s.Lines[i].Type != DIFF_LINE_ADD {
+			lines = append(lines, &DiffSplitLine{s.Lines[i], s.Lines[i]})
+			i++
+			continue
+		}
+
+		delStart := i
+		for i < len(s.Lines) && s.Lines[i].Type == DIFF_LINE_DEL {
+			i++
+		}
+		addStart := i
+		for i < len(s.Lines) && s.Lines[i].Type == DIFF_LINE_ADD {
+			i++
+		}
+		dels, adds := s.Lines[delStart:addStart], s.Lines[addStart:i]
+		for j := 0; j < len(dels) || j < len(adds); j++ {
+			line := new(DiffSplitLine)
+			if j < len(dels) {
+				line.Left = dels[j]
+			}
+			if j < len(adds) {
+				line.Right = adds[j]
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// highlightChanges computes intra-line changes of paired deleted and added lines.
+func (s *DiffSection) highlightChanges() {
+	for _, line := range s.SplitLines() {
+		if line.Left != nil && line.Right != nil && line.Left.Type == DIFF_LINE_DEL {
+			highlightDiffLines(line.Left, line.Right)
+		}
+	}
+}
+
+// MAX_HIGHLIGHT_TOKENS is the maximum product of token numbers of two lines
+// that intra-line changes are computed for, longer lines are not highlighted.
+const MAX_HIGHLIGHT_TOKENS = 10000
+
+// splitDiffTokens splits content into words, runs of spaces and single symbols.
+func splitDiffTokens(content string) []string {
+	tokens := make([]string, 0, 10)
+	start, lastKind := 0, 0
+	for i, r := range content {
+		kind := 3
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			kind = 1
+		case unicode.IsSpace(r):
+			kind = 2
+		}
+		if i > start && (kind != lastKind || kind == 3) {
+			tokens = append(tokens, content[start:i])
+			start = i
+		}
+		lastKind = kind
+	}
+	if start < len(content) {
+		tokens = append(tokens, content[start:])
+	}
+	return tokens
+}
+
+// diffLineSegments merges tokens into segments by whether they are changed.
+func diffLineSegments(prefix string, tokens []string, isChanged []bool) []*DiffLineSegment {
+	segments := []*DiffLineSegment{{Content: prefix}}
+	for i := range tokens {
+		last := segments[len(segments)-1]
+		if last.IsChanged == isChanged[i] {
+			last.Content += tokens[i]
+		} else {
+			segments = append(segments, &DiffLineSegment{tokens[i], isChanged[i]})
+		}
+	}
+	return segments
+}
+
+// highlightDiffLines computes changed segments of a deleted line and
+// its paired added line by longest common subsequence of tokens.
+func highlightDiffLines(del, add *DiffLine) {
+	a, b := splitDiffTokens(del.Content[1:]), splitDiffTokens(add.Content[1:])
+	if len(a) == 0 || len(b) == 0 || len(a)*len(b) > MAX_HIGHLIGHT_TOKENS {
+		return
+	}
+
+	// lcs[i][j] is the length of LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	aChanged, bChanged := make([]bool, len(a)), make([]bool, len(b))
+	hasCommon := false
+	for i := range aChanged {
+		aChanged[i] = true
+	}
+	for j := range bChanged {
+		bChanged[j] = true
+	}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			aChanged[i], bChanged[j] = false, false
+			if len(strings.TrimSpace(a[i])) > 0 {
+				hasCommon = true
+			}
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	// Lines that have nothing in common are entirely changed,
+	// highlighting them does not help anything.
+	if !hasCommon {
+		return
+	}
+	del.Segments = diffLineSegments(del.Content[:1], a, aChanged)
+	add.Segments = diffLineSegments(add.Content[:1], b, bChanged)
+}
+
 type DiffFile struct {
 	Name               string
+	OldName            string
 	Index              int
 	Addition, Deletion int
 	Type               int
+	Similarity         int // Percentage of similarity of renamed or copied file.
+	OldMode, NewMode   string
 	IsBin              bool
+	IsIncomplete       bool // Lines of file are truncated by limit.
 	Sections           []*DiffSection
+	OutdatedComments   []*Comment
+}
+
+// IsModeChanged returns true if file mode is changed, e.g. becomes executable.
+func (diffFile *DiffFile) IsModeChanged() bool {
+	return len(diffFile.OldMode) > 0 && len(diffFile.NewMode) > 0 && diffFile.OldMode != diffFile.NewMode
+}
+
+// GetLine returns the diff line by given line number,
+// negative number means line of old file.
+func (diffFile *DiffFile) GetLine(line int64) *DiffLine {
+	for _, section := range diffFile.Sections {
+		for _, diffLine := range section.Lines {
+			if diffLine.Type == DIFF_LINE_SECTION {
+				continue
+			}
+			if (line > 0 && diffLine.RightIdx == int(line) && diffLine.Type != DIFF_LINE_DEL) ||
+				(line < 0 && diffLine.LeftIdx == int(-line) && diffLine.Type == DIFF_LINE_DEL) {
+				return diffLine
+			}
+		}
+	}
+	return nil
 }
 
 type Diff struct {
 	TotalAddition, TotalDeletion int
 	Files                        []*DiffFile
+	IsIncomplete                 bool // Files or lines are truncated by limits.
 }
 
 func (diff *Diff) NumFiles() int {
 	return len(diff.Files)
 }
 
+// GetFile returns the diff file by given path.
+func (diff *Diff) GetFile(treePath string) *DiffFile {
+	for _, diffFile := range diff.Files {
+		if diffFile.Name == treePath {
+			return diffFile
+		}
+	}
+	return nil
+}
+
+// LoadComments attaches line comments to corresponding lines of diff,
+// comments whose lines have changed since then are marked as outdated.
+// Only given comments are checked, so outdated comments are only found
+// when caller loads comments of earlier commits as well, e.g. commits of
+// a pull request, but not for the diff of a single commit.
+func (diff *Diff) LoadComments(comments []*Comment) {
+	for _, c := range comments {
+		diffFile := diff.GetFile(c.TreePath)
+		if diffFile == nil {
+			continue
+		}
+
+		diffLine := diffFile.GetLine(c.Line)
+		if diffLine == nil || diffLine.Content[1:] != c.LineContent {
+			c.IsOutdated = true
+			diffFile.OutdatedComments = append(diffFile.OutdatedComments, c)
+			continue
+		}
+		diffLine.Comments = append(diffLine.Comments, c)
+	}
+}
+
 const DIFF_HEAD = "diff --git "
 
-func ParsePatch(pid int64, cmd *exec.Cmd, reader io.Reader) (*Diff, error) {
-	scanner := bufio.NewScanner(reader)
+// unquoteDiffName returns unquoted file name if Git quoted it
+// because of special characters.
+func unquoteDiffName(name string) string {
+	if len(name) > 1 && name[0] == '"' {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			return unquoted
+		}
+	}
+	return name
+}
+
+// parseDiffHeaderNames returns old and new file names of "diff --git" header line,
+// names are overwritten later by extended headers if file was renamed or copied.
+func parseDiffHeaderNames(line string) (oldName, newName string) {
+	switch {
+	case strings.HasPrefix(line, `"`):
+		i := 1
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(line) {
+			i = len(line) - 1
+		}
+		oldName, newName = line[:i+1], strings.TrimPrefix(line[i+1:], " ")
+	case strings.HasSuffix(line, `"`) && strings.Contains(line, ` "`):
+		i := strings.LastIndex(line, ` "`)
+		oldName, newName = line[:i], line[i+1:]
+	default:
+		// Both names are the same when file is not renamed or copied,
+		// so they are split in the middle in case names contain spaces.
+		i := len(line) / 2
+		oldName, newName = line[:i], line[i+1:]
+	}
+	return strings.TrimPrefix(unquoteDiffName(oldName), "a/"), strings.TrimPrefix(unquoteDiffName(newName), "b/")
+}
+
+// parseDiffFileHeader parses extended header line of file diff,
+// it returns false if the line is not an extended header.
+func parseDiffFileHeader(diffFile *DiffFile, line string) bool {
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		diffFile.Type = DIFF_FILE_ADD
+		diffFile.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		diffFile.Type = DIFF_FILE_DEL
+		diffFile.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		diffFile.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		diffFile.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "similarity index "):
+		diffFile.Similarity, _ = com.StrTo(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%")).Int()
+	case strings.HasPrefix(line, "rename from "):
+		diffFile.Type = DIFF_FILE_RENAME
+		diffFile.OldName = unquoteDiffName(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		diffFile.Type = DIFF_FILE_RENAME
+		diffFile.Name = unquoteDiffName(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		diffFile.Type = DIFF_FILE_COPY
+		diffFile.OldName = unquoteDiffName(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		diffFile.Type = DIFF_FILE_COPY
+		diffFile.Name = unquoteDiffName(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "Binary files "), strings.HasPrefix(line, "GIT binary patch"):
+		diffFile.IsBin = true
+	case strings.HasPrefix(line, "index "), strings.HasPrefix(line, "dissimilarity index "),
+		strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+	default:
+		return false
+	}
+	return true
+}
+
+// ParsePatch parses output of "git diff" into Diff, zero limit means no limit.
+// Files beyond maxFiles and lines beyond maxLines are dropped and the diff is
+// marked as incomplete, so as a file that has more lines than maxFileLines.
+func ParsePatch(pid int64, maxFiles, maxFileLines, maxLines int, cmd *exec.Cmd, reader io.Reader) (*Diff, error) {
 	var (
+		diff       = &Diff{Files: make([]*DiffFile, 0)}
 		curFile    *DiffFile
-		curSection = &DiffSection{
-			Lines: make([]*DiffLine, 0, 10),
-		}
+		curSection *DiffSection
+		isHeader   bool
 
 		leftLine, rightLine int
+		fileLines, numLines int
 	)
 
-	diff := &Diff{Files: make([]*DiffFile, 0)}
-	var i int
-	for scanner.Scan() {
-		line := scanner.Text()
-		// fmt.Println(i, line)
-		if strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- ") {
+	input := bufio.NewReader(reader)
+	for {
+		line, err := input.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				return nil, fmt.Errorf("ReadString: %v", err)
+			} else if len(line) == 0 {
+				break
+			}
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		// Get new file.
+		if strings.HasPrefix(line, DIFF_HEAD) {
+			if maxFiles > 0 && len(diff.Files) >= maxFiles {
+				log.Warn("Diff has too many files, only first %d files are shown", maxFiles)
+				diff.IsIncomplete = true
+				break
+			}
+
+			oldName, newName := parseDiffHeaderNames(line[len(DIFF_HEAD):])
+			curFile = &DiffFile{
+				Name:     newName,
+				OldName:  oldName,
+				Index:    len(diff.Files) + 1,
+				Type:     DIFF_FILE_CHANGE,
+				Sections: make([]*DiffSection, 0, 10),
+			}
+			diff.Files = append(diff.Files, curFile)
+			curSection = nil
+			isHeader = true
+			fileLines = 0
 			continue
 		}
 
-		i = i + 1
+		// Lines before first file, e.g. commit message from "git show".
+		if curFile == nil || len(line) == 0 {
+			continue
+		}
 
-		// Diff data too large.
-		if i == 5000 {
-			log.Warn("Diff data too large")
-			return &Diff{}, nil
+		if isHeader {
+			if parseDiffFileHeader(curFile, line) {
+				continue
+			}
+			isHeader = false
 		}
 
-		if line == "" {
+		if line[0] == '@' {
+			// Parse line number, e.g. "@@ -1,3 +1,4 @@ func main() {".
+			ss := strings.SplitN(line, "@@", 3)
+			if len(ss) < 3 {
+				continue
+			}
+			ranges := strings.Fields(ss[1])
+			if len(ranges) < 2 {
+				continue
+			}
+			leftLine, _ = com.StrTo(strings.Split(ranges[0], ",")[0][1:]).Int()
+			rightLine, _ = com.StrTo(strings.Split(ranges[1], ",")[0][1:]).Int()
+
+			curSection = &DiffSection{Lines: make([]*DiffLine, 0, 10)}
+			if !curFile.IsIncomplete {
+				curFile.Sections = append(curFile.Sections, curSection)
+				curSection.Lines = append(curSection.Lines, &DiffLine{Type: DIFF_LINE_SECTION, Content: line})
+			}
 			continue
 		}
 
-		switch {
-		case line[0] == ' ':
-			diffLine := &DiffLine{Type: DIFF_LINE_PLAIN, Content: line, LeftIdx: leftLine, RightIdx: rightLine}
+		if curSection == nil {
+			continue
+		}
+
+		var diffLine *DiffLine
+		switch line[0] {
+		case ' ':
+			diffLine = &DiffLine{Type: DIFF_LINE_PLAIN, Content: line, LeftIdx: leftLine, RightIdx: rightLine}
 			leftLine++
 			rightLine++
-			curSection.Lines = append(curSection.Lines, diffLine)
-			continue
-		case line[0] == '@':
-			curSection = &DiffSection{}
-			curFile.Sections = append(curFile.Sections, curSection)
-			ss := strings.Split(line, "@@")
-			diffLine := &DiffLine{Type: DIFF_LINE_SECTION, Content: line}
-			curSection.Lines = append(curSection.Lines, diffLine)
-
-			// Parse line number.
-			ranges := strings.Split(ss[len(ss)-2][1:], " ")
-			leftLine, _ = com.StrTo(strings.Split(ranges[0], ",")[0][1:]).Int()
-			rightLine, _ = com.StrTo(strings.Split(ranges[1], ",")[0]).Int()
-			continue
-		case line[0] == '+':
+		case '+':
 			curFile.Addition++
 			diff.TotalAddition++
-			diffLine := &DiffLine{Type: DIFF_LINE_ADD, Content: line, RightIdx: rightLine}
+			diffLine = &DiffLine{Type: DIFF_LINE_ADD, Content: line, RightIdx: rightLine}
 			rightLine++
-			curSection.Lines = append(curSection.Lines, diffLine)
-			continue
-		case line[0] == '-':
+		case '-':
 			curFile.Deletion++
 			diff.TotalDeletion++
-			diffLine := &DiffLine{Type: DIFF_LINE_DEL, Content: line, LeftIdx: leftLine}
-			if leftLine > 0 {
-				leftLine++
-			}
-			curSection.Lines = append(curSection.Lines, diffLine)
-		case strings.HasPrefix(line, "Binary"):
-			curFile.IsBin = true
+			diffLine = &DiffLine{Type: DIFF_LINE_DEL, Content: line, LeftIdx: leftLine}
+			leftLine++
+		default:
+			// E.g. "\ No newline at end of file".
 			continue
 		}
 
-		// Get new file.
-		if strings.HasPrefix(line, DIFF_HEAD) {
-			fs := strings.Split(line[len(DIFF_HEAD):], " ")
-			a := fs[0]
-
-			curFile = &DiffFile{
-				Name:     a[strings.Index(a, "/")+1:],
-				Index:    len(diff.Files) + 1,
-				Type:     DIFF_FILE_CHANGE,
-				Sections: make([]*DiffSection, 0, 10),
-			}
-			diff.Files = append(diff.Files, curFile)
+		// Lines of file beyond limit are still counted for statistics.
+		fileLines++
+		if maxFileLines > 0 && fileLines > maxFileLines {
+			curFile.IsIncomplete = true
+		}
+		if curFile.IsIncomplete {
+			continue
+		}
 
-			// Check file diff type.
-			for scanner.Scan() {
-				switch {
-				case strings.HasPrefix(scanner.Text(), "new file"):
-					curFile.Type = DIFF_FILE_ADD
-				case strings.HasPrefix(scanner.Text(), "deleted"):
-					curFile.Type = DIFF_FILE_DEL
-				case strings.HasPrefix(scanner.Text(), "index"):
-					curFile.Type = DIFF_FILE_CHANGE
-				}
-				if curFile.Type > 0 {
-					break
-				}
-			}
+		numLines++
+		if maxLines > 0 && numLines > maxLines {
+			log.Warn("Diff has too many lines, only first %d lines are shown", maxLines)
+			curFile.IsIncomplete = true
+			diff.IsIncomplete = true
+			break
 		}
+		curSection.Lines = append(curSection.Lines, diffLine)
 	}
 
+	for _, f := range diff.Files {
+		for _, section := range f.Sections {
+			section.highlightChanges()
+		}
+	}
 	return diff, nil
 }
 
@@ -192,13 +550,13 @@ func GetDiffRange(repoPath, beforeCommitId string, afterCommitId string) (*Diff,
 	if beforeCommitId == "" {
 		// First commit of repository.
 		if commit.ParentCount() == 0 {
-			cmd = exec.Command("git", "show", afterCommitId)
+			cmd = exec.Command("git", "show", "-M", "-C", afterCommitId)
 		} else {
 			c, _ := commit.Parent(0)
-			cmd = exec.Command("git", "diff", c.Id.String(), afterCommitId)
+			cmd = exec.Command("git", "diff", "-M", "-C", c.Id.String(), afterCommitId)
 		}
 	} else {
-		cmd = exec.Command("git", "diff", beforeCommitId, afterCommitId)
+		cmd = exec.Command("git", "diff", "-M", "-C", beforeCommitId, afterCommitId)
 	}
 	cmd.Dir = repoPath
 	cmd.Stdout = wr
@@ -229,7 +587,52 @@ func GetDiffRange(repoPath, beforeCommitId string, afterCommitId string) (*Diff,
 		}
 	}()
 
-	return ParsePatch(pid, cmd, rd)
+	return ParsePatch(pid, setting.MaxGitDiffFiles, setting.MaxGitDiffFileLines, setting.MaxGitDiffLines, cmd, rd)
+}
+
+// EMPTY_TREE_SHA is the ID of empty tree that Git always knows about,
+// which is used as the parent of root commit.
+const EMPTY_TREE_SHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// WriteRawDiff writes raw output of "git diff", or "git format-patch" if isPatch is true,
+// of given commit range to writer, empty before commit ID means the commit itself.
+func WriteRawDiff(repoPath, beforeCommitId, afterCommitId string, isPatch bool, w io.Writer) error {
+	var args []string
+	if isPatch {
+		if len(beforeCommitId) == 0 {
+			args = []string{"format-patch", "--stdout", "-1", afterCommitId}
+		} else {
+			args = []string{"format-patch", "--stdout", beforeCommitId + ".." + afterCommitId}
+		}
+	} else {
+		if len(beforeCommitId) == 0 {
+			repo, err := git.OpenRepository(repoPath)
+			if err != nil {
+				return err
+			}
+			commit, err := repo.GetCommit(afterCommitId)
+			if err != nil {
+				return err
+			}
+			if commit.ParentCount() == 0 {
+				beforeCommitId = EMPTY_TREE_SHA
+			} else {
+				c, err := commit.Parent(0)
+				if err != nil {
+					return err
+				}
+				beforeCommitId = c.Id.String()
+			}
+		}
+		args = []string{"diff", "-M", beforeCommitId, afterCommitId}
+	}
+
+	stderr, err := process.ExecDirWriter(5*time.Minute, repoPath, w,
+		fmt.Sprintf("WriteRawDiff(git %s): %s", args[0], repoPath), "git", args...)
+	if err != nil {
+		return fmt.Errorf("git %s: %v - %s", args[0], err, stderr)
+	}
+	return nil
 }
 
 func GetDiffCommit(repoPath, commitId string) (*Diff, error) {
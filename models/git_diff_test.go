@@ -0,0 +1,215 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// Output of "git show -M -C" of a commit that adds, copies, renames, changes,
+// deletes files and changes file mode.
+const patchOutput = `commit 2d9d2d8d0bb3d6ab0e3ec6e8ba7b1d2f3a4c5e6f
+Author: Alice <alice@example.com>
+Date:   Thu Jan 1 00:00:00 2015 +0000
+
+    diff --git a/fake b/fake
+
+diff --git a/bin.dat b/bin.dat
+new file mode 100644
+index 0000000..8352675
+Binary files /dev/null and b/bin.dat differ
+diff --git a/src b/copied
+similarity index 100%
+copy from src
+copy to copied
+diff --git a/big b/renamed
+similarity index 90%
+rename from big
+rename to renamed
+index 0ff3bbb..fb3ced1 100644
+--- a/big
++++ b/renamed
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+diff --git a/sp ace.txt b/sp ace.txt
+new file mode 100644
+index 0000000..587be6b
+--- /dev/null
++++ b/sp ace.txt
+@@ -0,0 +1 @@
++x
+diff --git a/src b/src
+index d348a97..4895ffb 100644
+--- a/src
++++ b/src
+@@ -18,3 +18,4 @@ func main() {
+ 118
+ 119
+ 120
++21
+diff --git "a/tab\tname" "b/tab\tname"
+new file mode 100644
+index 0000000..3e75765
+--- /dev/null
++++ "b/tab\tname"
+@@ -0,0 +1 @@
++new
+diff --git a/top b/top
+deleted file mode 100644
+index d00491f..0000000
+--- a/top
++++ /dev/null
+@@ -1 +0,0 @@
+-1
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+index 3b18e51..ab2c3f5
+--- a/run.sh
++++ b/run.sh
+@@ -1 +1 @@
+--- a
+\ No newline at end of file
++++ b
+\ No newline at end of file
+`
+
+func TestParsePatch(t *testing.T) {
+	diff, err := ParsePatch(0, 0, 0, 0, nil, strings.NewReader(patchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.IsIncomplete {
+		t.Error("diff without limit is incomplete")
+	}
+	if diff.TotalAddition != 5 || diff.TotalDeletion != 3 {
+		t.Errorf("expected +5 -3, got +%d -%d", diff.TotalAddition, diff.TotalDeletion)
+	}
+
+	expected := []struct {
+		name, oldName      string
+		typ                int
+		similarity         int
+		isBin              bool
+		addition, deletion int
+		numLines           int // Including section headers.
+	}{
+		{"bin.dat", "bin.dat", DIFF_FILE_ADD, 0, true, 0, 0, 0},
+		{"copied", "src", DIFF_FILE_COPY, 100, false, 0, 0, 0},
+		{"renamed", "big", DIFF_FILE_RENAME, 90, false, 1, 1, 9},
+		{"sp ace.txt", "sp ace.txt", DIFF_FILE_ADD, 0, false, 1, 0, 2},
+		{"src", "src", DIFF_FILE_CHANGE, 0, false, 1, 0, 5},
+		{"tab\tname", "tab\tname", DIFF_FILE_ADD, 0, false, 1, 0, 2},
+		{"top", "top", DIFF_FILE_DEL, 0, false, 0, 1, 2},
+		{"run.sh", "run.sh", DIFF_FILE_CHANGE, 0, false, 1, 1, 3},
+	}
+	if len(diff.Files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(diff.Files))
+	}
+	for i, e := range expected {
+		f := diff.Files[i]
+		if f.Name != e.name || f.OldName != e.oldName {
+			t.Errorf("file %d: expected names %q -> %q, got %q -> %q", i, e.oldName, e.name, f.OldName, f.Name)
+		}
+		if f.Index != i+1 || f.Type != e.typ || f.Similarity != e.similarity || f.IsBin != e.isBin {
+			t.Errorf("file %d: expected index %d, type %d, similarity %d, binary %v, got %d, %d, %d, %v",
+				i, i+1, e.typ, e.similarity, e.isBin, f.Index, f.Type, f.Similarity, f.IsBin)
+		}
+		if f.Addition != e.addition || f.Deletion != e.deletion {
+			t.Errorf("file %d: expected +%d -%d, got +%d -%d", i, e.addition, e.deletion, f.Addition, f.Deletion)
+		}
+		numLines := 0
+		for _, section := range f.Sections {
+			numLines += len(section.Lines)
+		}
+		if numLines != e.numLines {
+			t.Errorf("file %d: expected %d lines, got %d", i, e.numLines, numLines)
+		}
+	}
+
+	// Line numbers of both sides.
+	renamed := diff.Files[2]
+	for _, test := range []struct {
+		line              int64
+		content           string
+		leftIdx, rightIdx int
+	}{
+		{2, " 2", 2, 2},
+		{-5, "-5", 5, 0},
+		{5, "+five", 0, 5},
+		{8, " 8", 8, 8},
+	} {
+		l := renamed.GetLine(test.line)
+		if l == nil {
+			t.Errorf("line %d is not found", test.line)
+		} else if l.Content != test.content || l.LeftIdx != test.leftIdx || l.RightIdx != test.rightIdx {
+			t.Errorf("line %d: expected %q (%d, %d), got %q (%d, %d)",
+				test.line, test.content, test.leftIdx, test.rightIdx, l.Content, l.LeftIdx, l.RightIdx)
+		}
+	}
+	if l := diff.Files[4].GetLine(21); l == nil || l.Content != "+21" {
+		t.Errorf("expected line 21 of src to be added")
+	}
+	if l := diff.Files[6].GetLine(-1); l == nil || l.Content != "-1" {
+		t.Errorf("expected line 1 of top to be deleted")
+	}
+
+	// Lines of content that look like headers.
+	runSh := diff.Files[7]
+	if !runSh.IsModeChanged() || runSh.OldMode != "100644" || runSh.NewMode != "100755" {
+		t.Errorf("expected mode change of run.sh, got %q -> %q", runSh.OldMode, runSh.NewMode)
+	}
+	if l := runSh.GetLine(-1); l == nil || l.Content != "--- a" {
+		t.Errorf("expected deleted line %q of run.sh", "--- a")
+	}
+	if l := runSh.GetLine(1); l == nil || l.Content != "+++ b" {
+		t.Errorf("expected added line %q of run.sh", "+++ b")
+	}
+}
+
+func TestParsePatchLimits(t *testing.T) {
+	// Files beyond limit are dropped.
+	diff, err := ParsePatch(0, 3, 0, 0, nil, strings.NewReader(patchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.IsIncomplete || len(diff.Files) != 3 {
+		t.Errorf("expected 3 files of incomplete diff, got %d files and incomplete %v", len(diff.Files), diff.IsIncomplete)
+	}
+
+	// Lines of a file beyond limit are dropped but still counted.
+	diff, err = ParsePatch(0, 0, 3, 0, nil, strings.NewReader(patchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.IsIncomplete || len(diff.Files) != 8 {
+		t.Errorf("expected 8 files of complete diff, got %d files and incomplete %v", len(diff.Files), diff.IsIncomplete)
+	}
+	renamed := diff.Files[2]
+	if !renamed.IsIncomplete || len(renamed.Sections[0].Lines) != 4 || renamed.Addition != 1 || renamed.Deletion != 1 {
+		t.Errorf("expected incomplete file with 4 lines and +1 -1, got incomplete %v with %d lines and +%d -%d",
+			renamed.IsIncomplete, len(renamed.Sections[0].Lines), renamed.Addition, renamed.Deletion)
+	}
+	if diff.Files[3].IsIncomplete {
+		t.Error("expected sp ace.txt to be complete")
+	}
+
+	// Lines of the whole diff beyond limit stop parsing.
+	diff, err = ParsePatch(0, 0, 0, 10, nil, strings.NewReader(patchOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.IsIncomplete || len(diff.Files) != 5 || !diff.Files[4].IsIncomplete || diff.Files[3].IsIncomplete {
+		t.Errorf("expected incomplete diff that stops at 5th file, got %d files and incomplete %v", len(diff.Files), diff.IsIncomplete)
+	}
+}
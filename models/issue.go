@@ -7,6 +7,7 @@ package models
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"html/template"
 	"os"
 	"strconv"
@@ -16,6 +17,7 @@ import (
 	"github.com/Unknwon/com"
 	"github.com/go-xorm/xorm"
 
+	"github.com/gogits/gogs/modules/base"
 	"github.com/gogits/gogs/modules/log"
 )
 
@@ -27,6 +29,7 @@ var (
 	ErrAttachmentNotExist  = errors.New("Attachment does not exist")
 	ErrAttachmentNotLinked = errors.New("Attachment does not belong to this issue")
 	ErrMissingIssueNumber  = errors.New("No issue number specified")
+	ErrDiffLineNotExist    = errors.New("Diff line does not exist")
 )
 
 // Issue represents an issue or pull request of repository.
@@ -103,6 +106,18 @@ func (i *Issue) Attachments() []*Attachment {
 	return a
 }
 
+// NumTasks returns number of task list items in issue content.
+func (i *Issue) NumTasks() int {
+	_, total := base.TaskCount(i.Content)
+	return total
+}
+
+// NumDoneTasks returns number of checked task list items in issue content.
+func (i *Issue) NumDoneTasks() int {
+	done, _ := base.TaskCount(i.Content)
+	return done
+}
+
 func (i *Issue) AfterDelete() {
 	_, err := DeleteAttachmentsByIssue(i.Id, true)
 
@@ -198,6 +213,7 @@ func GetIssues(uid, rid, pid, mid int64, page int, isClosed bool, labelIds, sort
 	} else {
 		sess.Where("is_closed=?", isClosed)
 	}
+	sess.And("is_pull=?", false)
 
 	if uid > 0 {
 		sess.And("assignee_id=?", uid)
@@ -253,7 +269,7 @@ func GetIssuesByLabel(repoId int64, label string) ([]*Issue, error) {
 
 // GetIssueCountByPoster returns number of issues of repository by poster.
 func GetIssueCountByPoster(uid, rid int64, isClosed bool) int64 {
-	count, _ := x.Where("repo_id=?", rid).And("poster_id=?", uid).And("is_closed=?", isClosed).Count(new(Issue))
+	count, _ := x.Where("repo_id=?", rid).And("poster_id=?", uid).And("is_pull=?", false).And("is_closed=?", isClosed).Count(new(Issue))
 	return count
 }
 
@@ -392,7 +408,7 @@ func GetIssueStats(rid, uid int64, isShowClosed bool, filterMode int) *IssueStat
 	issue := new(Issue)
 	tmpSess := &xorm.Session{}
 
-	sess := x.Where("repo_id=?", rid)
+	sess := x.Where("repo_id=?", rid).And("is_pull=?", false)
 	*tmpSess = *sess
 	stats.OpenCount, _ = tmpSess.And("is_closed=?", false).Count(issue)
 	*tmpSess = *sess
@@ -404,7 +420,7 @@ func GetIssueStats(rid, uid int64, isShowClosed bool, filterMode int) *IssueStat
 	}
 
 	if filterMode != FM_MENTION {
-		sess = x.Where("repo_id=?", rid)
+		sess = x.Where("repo_id=?", rid).And("is_pull=?", false)
 		switch filterMode {
 		case FM_ASSIGN:
 			sess.And("assignee_id=?", uid)
@@ -425,8 +441,8 @@ func GetIssueStats(rid, uid int64, isShowClosed bool, filterMode int) *IssueStat
 		stats.ClosedCount, _ = tmpSess.And("is_closed=?", true).Count(new(IssueUser))
 	}
 nofilter:
-	stats.AssignCount, _ = x.Where("repo_id=?", rid).And("is_closed=?", isShowClosed).And("assignee_id=?", uid).Count(issue)
-	stats.CreateCount, _ = x.Where("repo_id=?", rid).And("is_closed=?", isShowClosed).And("poster_id=?", uid).Count(issue)
+	stats.AssignCount, _ = x.Where("repo_id=?", rid).And("is_pull=?", false).And("is_closed=?", isShowClosed).And("assignee_id=?", uid).Count(issue)
+	stats.CreateCount, _ = x.Where("repo_id=?", rid).And("is_pull=?", false).And("is_closed=?", isShowClosed).And("poster_id=?", uid).Count(issue)
 	stats.MentionCount, _ = x.Where("repo_id=?", rid).And("uid=?", uid).And("is_closed=?", isShowClosed).And("is_mentioned=?", true).Count(new(IssueUser))
 	return stats
 }
@@ -435,8 +451,8 @@ nofilter:
 func GetUserIssueStats(uid int64, filterMode int) *IssueStats {
 	stats := &IssueStats{}
 	issue := new(Issue)
-	stats.AssignCount, _ = x.Where("assignee_id=?", uid).And("is_closed=?", false).Count(issue)
-	stats.CreateCount, _ = x.Where("poster_id=?", uid).And("is_closed=?", false).Count(issue)
+	stats.AssignCount, _ = x.Where("assignee_id=?", uid).And("is_pull=?", false).And("is_closed=?", false).Count(issue)
+	stats.CreateCount, _ = x.Where("poster_id=?", uid).And("is_pull=?", false).And("is_closed=?", false).Count(issue)
 	return stats
 }
 
@@ -882,9 +898,16 @@ type Comment struct {
 	Poster   *User `xorm:"-"`
 	IssueId  int64
 	CommitId int64
-	Line     int64
+	Line     int64     // Line number in diff, negative means line of old file.
 	Content  string    `xorm:"TEXT"`
 	Created  time.Time `xorm:"CREATED"`
+
+	// For comments on diff lines.
+	RepoId      int64  `xorm:"INDEX"`
+	CommitSHA   string `xorm:"VARCHAR(40) INDEX"`
+	TreePath    string
+	LineContent string `xorm:"TEXT"`
+	IsOutdated  bool   `xorm:"-"`
 }
 
 // CreateComment creates comment of issue or commit.
@@ -926,14 +949,23 @@ func CreateComment(userId, repoId, issueId, commitId, line int64, cmtType Commen
 				return nil, err
 			}
 		}
-	case REOPEN:
-		rawSql := "UPDATE `repository` SET num_closed_issues = num_closed_issues - 1 WHERE id = ?"
-		if _, err := sess.Exec(rawSql, repoId); err != nil {
+	case REOPEN, CLOSE:
+		issue := &Issue{Id: issueId}
+		if _, err := sess.Get(issue); err != nil {
 			sess.Rollback()
 			return nil, err
 		}
-	case CLOSE:
-		rawSql := "UPDATE `repository` SET num_closed_issues = num_closed_issues + 1 WHERE id = ?"
+
+		column := "num_closed_issues"
+		if issue.IsPull {
+			column = "num_closed_pulls"
+		}
+		op := "+"
+		if cmtType == REOPEN {
+			op = "-"
+		}
+
+		rawSql := fmt.Sprintf("UPDATE `repository` SET %s = %s %s 1 WHERE id = ?", column, column, op)
 		if _, err := sess.Exec(rawSql, repoId); err != nil {
 			sess.Rollback()
 			return nil, err
@@ -943,6 +975,54 @@ func CreateComment(userId, repoId, issueId, commitId, line int64, cmtType Commen
 	return comment, sess.Commit()
 }
 
+// CreateLineComment creates comment on a line of diff that ends with given commit.
+func CreateLineComment(userId, repoId int64, commitSHA, treePath string, line int64, lineContent, content string) (*Comment, error) {
+	comment := &Comment{
+		Type:        COMMENT,
+		PosterId:    userId,
+		RepoId:      repoId,
+		CommitSHA:   commitSHA,
+		TreePath:    treePath,
+		Line:        line,
+		LineContent: lineContent,
+		Content:     content,
+	}
+	if _, err := x.Insert(comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// GetLineComments returns all comments on diff lines of given commits in repository.
+func GetLineComments(repoId int64, commitSHAs []string) ([]*Comment, error) {
+	comments := make([]*Comment, 0, 10)
+	if len(commitSHAs) == 0 {
+		return comments, nil
+	}
+
+	args := make([]interface{}, 0, len(commitSHAs)+1)
+	args = append(args, repoId)
+	for _, sha := range commitSHAs {
+		args = append(args, sha)
+	}
+	cond := "repo_id=? AND commit_sha IN (" + strings.TrimSuffix(strings.Repeat("?,", len(commitSHAs)), ",") + ")"
+	err := x.Where(cond, args...).Asc("created").Find(&comments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range comments {
+		c.Poster, err = GetUserById(c.PosterId)
+		if err != nil {
+			if err != ErrUserNotExist {
+				return nil, err
+			}
+			c.Poster = &User{Name: "FakeUser"}
+		}
+	}
+	return comments, nil
+}
+
 // GetCommentById returns the comment with the given id
 func GetCommentById(commentId int64) (*Comment, error) {
 	c := &Comment{Id: commentId}
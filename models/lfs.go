@@ -0,0 +1,137 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/lfs"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+var (
+	ErrLFSObjectNotExist = errors.New("LFS object does not exist")
+	ErrLFSTokenInvalid   = errors.New("LFS token is invalid or expired")
+)
+
+const (
+	LFS_OPERATION_DOWNLOAD = "download"
+	LFS_OPERATION_UPLOAD   = "upload"
+
+	// Tokens are issued by serv command for clients that talk to server over SSH.
+	LFS_TOKEN_EXPIRE_MINUTES = 30
+)
+
+// LFSMetaObject represents an LFS object that is linked to a repository,
+// content is stored once and shared by all repositories that link to it.
+type LFSMetaObject struct {
+	Id      int64
+	Oid     string    `xorm:"UNIQUE(lfs_meta_object) NOT NULL"`
+	Size    int64     `xorm:"NOT NULL"`
+	RepoId  int64     `xorm:"UNIQUE(lfs_meta_object) INDEX NOT NULL"`
+	Created time.Time `xorm:"CREATED"`
+}
+
+// Pointer returns pointer of the object.
+func (m *LFSMetaObject) Pointer() *lfs.Pointer {
+	return &lfs.Pointer{Oid: m.Oid, Size: m.Size}
+}
+
+// LFSContentStore returns store of LFS object content.
+func LFSContentStore() *lfs.ContentStore {
+	return &lfs.ContentStore{BasePath: setting.LFSContentPath}
+}
+
+// NewLFSMetaObject links object to repository, it does nothing if they are already linked.
+func NewLFSMetaObject(m *LFSMetaObject) error {
+	has, err := x.Where("repo_id=?", m.RepoId).And("oid=?", m.Oid).Get(new(LFSMetaObject))
+	if err != nil {
+		return err
+	} else if has {
+		return nil
+	}
+	_, err = x.Insert(m)
+	return err
+}
+
+// GetLFSMetaObjectByOid returns LFS object of given OID that is linked to repository.
+func GetLFSMetaObjectByOid(repoId int64, oid string) (*LFSMetaObject, error) {
+	m := new(LFSMetaObject)
+	has, err := x.Where("repo_id=?", repoId).And("oid=?", oid).Get(m)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrLFSObjectNotExist
+	}
+	return m, nil
+}
+
+// deleteLFSObjectsOfRepo unlinks all LFS objects from repository,
+// and deletes content of objects that are no longer linked to any repository.
+func deleteLFSObjectsOfRepo(repoId int64) error {
+	objs := make([]*LFSMetaObject, 0, 10)
+	if err := x.Where("repo_id=?", repoId).Find(&objs); err != nil {
+		return err
+	}
+	if _, err := x.Delete(&LFSMetaObject{RepoId: repoId}); err != nil {
+		return err
+	}
+
+	store := LFSContentStore()
+	for _, obj := range objs {
+		count, err := x.Where("oid=?", obj.Oid).Count(new(LFSMetaObject))
+		if err != nil {
+			return err
+		} else if count > 0 {
+			continue
+		}
+		if err = store.Remove(obj.Oid); err != nil {
+			log.Error(4, "Remove LFS object(%s): %v", obj.Oid, err)
+		}
+	}
+	return nil
+}
+
+func lfsTokenData(userId, repoId int64, operation string) string {
+	return fmt.Sprintf("lfs:%d:%d:%s", userId, repoId, operation)
+}
+
+// NewLFSToken returns a token that allows user to perform operation
+// on LFS objects of repository for a limited time.
+func NewLFSToken(userId, repoId int64, operation string) string {
+	return com.ToStr(userId) + ":" +
+		base.CreateTimeLimitCode(lfsTokenData(userId, repoId, operation), LFS_TOKEN_EXPIRE_MINUTES, nil)
+}
+
+// VerifyLFSToken returns the user that token was issued to if the token allows
+// operation on repository, tokens of upload also allow download.
+func VerifyLFSToken(token string, repoId int64, operation string) (*User, error) {
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrLFSTokenInvalid
+	}
+	userId := com.StrTo(parts[0]).MustInt64()
+
+	valid := base.VerifyTimeLimitCode(lfsTokenData(userId, repoId, operation), LFS_TOKEN_EXPIRE_MINUTES, parts[1])
+	if !valid && operation == LFS_OPERATION_DOWNLOAD {
+		valid = base.VerifyTimeLimitCode(lfsTokenData(userId, repoId, LFS_OPERATION_UPLOAD), LFS_TOKEN_EXPIRE_MINUTES, parts[1])
+	}
+	if !valid {
+		return nil, ErrLFSTokenInvalid
+	}
+
+	u, err := GetUserById(userId)
+	if err == ErrUserNotExist {
+		return nil, ErrLFSTokenInvalid
+	}
+	return u, err
+}
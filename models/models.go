@@ -22,6 +22,10 @@ var (
 	tables []interface{}
 
 	HasEngine bool
+	// IsWebServer is true in the long-running web server process. Goroutines started
+	// by short-lived processes (e.g. serv) are killed when they exit, so work must be
+	// done synchronously there.
+	IsWebServer bool
 
 	DbCfg struct {
 		Type, Host, Name, User, Pwd, Path, SslMode string
@@ -37,7 +41,8 @@ func init() {
 		new(Issue), new(Comment), new(Oauth2), new(Follow),
 		new(Mirror), new(Release), new(LoginSource), new(Webhook), new(IssueUser),
 		new(Milestone), new(Label), new(HookTask), new(Team), new(OrgUser), new(TeamUser),
-		new(UpdateTask), new(Attachment))
+		new(UpdateTask), new(Attachment), new(PullRequest), new(ProtectBranch), new(RepoLanguage),
+		new(LFSMetaObject))
 }
 
 func LoadModelsConfig() {
@@ -0,0 +1,252 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/process"
+)
+
+var (
+	ErrProtectBranchNotExist = errors.New("Protect branch does not exist")
+)
+
+// Reasons of a push being rejected by protection rules of a branch,
+// they are also suffixes of locale keys "repo.settings.protected_branch_<reason>".
+const (
+	PROTECT_REASON_NOT_ALLOWED = "not_allowed"
+	PROTECT_REASON_DELETION    = "deletion"
+	PROTECT_REASON_FORCE_PUSH  = "force_push"
+)
+
+var protectReasonDescs = map[string]string{
+	PROTECT_REASON_NOT_ALLOWED: "you are not allowed to push to this branch",
+	PROTECT_REASON_DELETION:    "deletion is not allowed",
+	PROTECT_REASON_FORCE_PUSH:  "force push is not allowed",
+}
+
+// ErrBranchProtected represents a push that violates protection rules of a branch.
+type ErrBranchProtected struct {
+	Branch string
+	Reason string
+}
+
+func (err ErrBranchProtected) Error() string {
+	return fmt.Sprintf("branch '%s' is protected: %s", err.Branch, protectReasonDescs[err.Reason])
+}
+
+// ProtectBranch represents protection rules of a branch.
+type ProtectBranch struct {
+	Id               int64
+	RepoId           int64  `xorm:"UNIQUE(protect_branch)"`
+	Name             string `xorm:"UNIQUE(protect_branch)"`
+	DisableForcePush bool
+	DisableDeletion  bool
+	EnableWhitelist  bool
+	WhitelistUserIds string    `xorm:"TEXT"`
+	WhitelistTeamIds string    `xorm:"TEXT"`
+	Created          time.Time `xorm:"CREATED"`
+	Updated          time.Time `xorm:"UPDATED"`
+}
+
+func splitIds(ids string) []int64 {
+	ss := strings.Split(ids, ",")
+	ints := make([]int64, 0, len(ss))
+	for _, s := range ss {
+		if id := com.StrTo(strings.TrimSpace(s)).MustInt64(); id > 0 {
+			ints = append(ints, id)
+		}
+	}
+	return ints
+}
+
+func joinIds(ids []int64) string {
+	ss := make([]string, len(ids))
+	for i := range ids {
+		ss[i] = com.ToStr(ids[i])
+	}
+	return strings.Join(ss, ",")
+}
+
+func (pb *ProtectBranch) GetWhitelistUserIds() []int64 {
+	return splitIds(pb.WhitelistUserIds)
+}
+
+func (pb *ProtectBranch) SetWhitelistUserIds(ids []int64) {
+	pb.WhitelistUserIds = joinIds(ids)
+}
+
+func (pb *ProtectBranch) GetWhitelistTeamIds() []int64 {
+	return splitIds(pb.WhitelistTeamIds)
+}
+
+func (pb *ProtectBranch) SetWhitelistTeamIds(ids []int64) {
+	pb.WhitelistTeamIds = joinIds(ids)
+}
+
+// GetWhitelistUsers returns users that are allowed to push to the branch.
+func (pb *ProtectBranch) GetWhitelistUsers() ([]*User, error) {
+	ids := pb.GetWhitelistUserIds()
+	users := make([]*User, 0, len(ids))
+	for _, id := range ids {
+		u, err := GetUserById(id)
+		if err != nil {
+			if err == ErrUserNotExist {
+				continue
+			}
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// GetWhitelistTeams returns teams whose members are allowed to push to the branch.
+func (pb *ProtectBranch) GetWhitelistTeams() ([]*Team, error) {
+	ids := pb.GetWhitelistTeamIds()
+	teams := make([]*Team, 0, len(ids))
+	for _, id := range ids {
+		t, err := GetTeamById(id)
+		if err != nil {
+			if err == ErrTeamNotExist {
+				continue
+			}
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, nil
+}
+
+// CanUserPush returns true if given user is allowed to push to the branch.
+// Write access to repository is not checked here.
+func (pb *ProtectBranch) CanUserPush(uid int64) bool {
+	if !pb.EnableWhitelist {
+		return true
+	}
+
+	for _, id := range pb.GetWhitelistUserIds() {
+		if id == uid {
+			return true
+		}
+	}
+
+	repo, err := GetRepositoryById(pb.RepoId)
+	if err != nil {
+		return false
+	}
+	for _, id := range pb.GetWhitelistTeamIds() {
+		if IsTeamMember(repo.OwnerId, id, uid) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProtectBranchOfRepoByName returns protection rules of given branch of repository.
+func GetProtectBranchOfRepoByName(repoId int64, name string) (*ProtectBranch, error) {
+	pb := &ProtectBranch{
+		RepoId: repoId,
+		Name:   name,
+	}
+	has, err := x.Get(pb)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrProtectBranchNotExist
+	}
+	return pb, nil
+}
+
+// IsBranchOfRepoProtected returns true if given branch of repository is protected.
+func IsBranchOfRepoProtected(repoId int64, name string) (bool, error) {
+	return x.Get(&ProtectBranch{RepoId: repoId, Name: name})
+}
+
+// GetProtectBranchesByRepoId returns all protected branches of repository.
+func GetProtectBranchesByRepoId(repoId int64) ([]*ProtectBranch, error) {
+	pbs := make([]*ProtectBranch, 0, 2)
+	return pbs, x.Where("repo_id=?", repoId).Asc("name").Find(&pbs)
+}
+
+// UpdateProtectBranch creates or updates protection rules of a branch.
+func UpdateProtectBranch(pb *ProtectBranch) (err error) {
+	if pb.Id == 0 {
+		_, err = x.Insert(pb)
+		return err
+	}
+	_, err = x.Id(pb.Id).AllCols().Update(pb)
+	return err
+}
+
+// DeleteProtectBranch removes protection rules of given branch of repository.
+func DeleteProtectBranch(repoId int64, name string) error {
+	_, err := x.Delete(&ProtectBranch{RepoId: repoId, Name: name})
+	return err
+}
+
+// isForcePush returns true if old commit is not an ancestor of new commit.
+func isForcePush(repoPath, oldCommitId, newCommitId string) (bool, error) {
+	stdout, stderr, err := process.ExecDir(-1, repoPath,
+		fmt.Sprintf("isForcePush(git rev-list): %s", repoPath),
+		"git", "rev-list", "--max-count=1", oldCommitId, "^"+newCommitId)
+	if err != nil {
+		return false, fmt.Errorf("git rev-list: %v - %s", err, stderr)
+	}
+	return len(strings.TrimSpace(stdout)) > 0, nil
+}
+
+// CheckProtectBranch returns ErrBranchProtected if given user is not allowed
+// to update the reference from old commit to new commit.
+func CheckProtectBranch(repoUserName, repoName, refName, oldCommitId, newCommitId string, userId int64) error {
+	if !strings.HasPrefix(refName, "refs/heads/") {
+		return nil
+	}
+	branchName := strings.TrimPrefix(refName, "refs/heads/")
+
+	repoUser, err := GetUserByName(repoUserName)
+	if err != nil {
+		return fmt.Errorf("GetUserByName: %v", err)
+	}
+	repo, err := GetRepositoryByName(repoUser.Id, repoName)
+	if err != nil {
+		return fmt.Errorf("GetRepositoryByName: %v", err)
+	}
+
+	pb, err := GetProtectBranchOfRepoByName(repo.Id, branchName)
+	if err != nil {
+		if err == ErrProtectBranchNotExist {
+			return nil
+		}
+		return fmt.Errorf("GetProtectBranchOfRepoByName: %v", err)
+	}
+
+	if !pb.CanUserPush(userId) {
+		return ErrBranchProtected{branchName, PROTECT_REASON_NOT_ALLOWED}
+	}
+
+	isNew := strings.HasPrefix(oldCommitId, "0000000")
+	isDel := strings.HasPrefix(newCommitId, "0000000")
+	switch {
+	case isDel:
+		if pb.DisableDeletion {
+			return ErrBranchProtected{branchName, PROTECT_REASON_DELETION}
+		}
+	case !isNew && pb.DisableForcePush:
+		isForce, err := isForcePush(RepoPath(repoUserName, repoName), oldCommitId, newCommitId)
+		if err != nil {
+			return err
+		} else if isForce {
+			return ErrBranchProtected{branchName, PROTECT_REASON_FORCE_PUSH}
+		}
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/process"
+	"github.com/gogits/gogs/modules/setting"
 )
 
 const (
@@ -198,6 +199,8 @@ func AddPublicKey(key *PublicKey) (err error) {
 	// Save SSH key.
 	if _, err = x.Insert(key); err != nil {
 		return err
+	} else if setting.DisableSshAuthorizedKeys {
+		return nil
 	} else if err = saveAuthorizedKeyFile(key); err != nil {
 		// Roll back.
 		if _, err2 := x.Delete(key); err2 != nil {
@@ -221,6 +224,35 @@ func GetPublicKeyById(keyId int64) (*PublicKey, error) {
 	return key, nil
 }
 
+// GetPublicKeyByFingerprint returns public key by given fingerprint.
+func GetPublicKeyByFingerprint(fingerprint string) (*PublicKey, error) {
+	key := new(PublicKey)
+	has, err := x.Where("fingerprint=?", fingerprint).Get(key)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrKeyNotExist
+	}
+	return key, nil
+}
+
+// GetPublicKeyByContent returns public key by given content in the form of
+// "<type> <base64>", comment of saved content is ignored.
+func GetPublicKeyByContent(content string) (*PublicKey, error) {
+	keys := make([]*PublicKey, 0, 1)
+	if err := x.Where("content LIKE ?", content+"%").Find(&keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		// Prefix may match a longer key.
+		fields := strings.Fields(key.Content)
+		if len(fields) >= 2 && fields[0]+" "+fields[1] == content {
+			return key, nil
+		}
+	}
+	return nil, ErrKeyNotExist
+}
+
 // ListPublicKey returns a list of all public keys that user has.
 func ListPublicKey(uid int64) ([]*PublicKey, error) {
 	keys := make([]*PublicKey, 0, 5)
@@ -236,18 +268,16 @@ func ListPublicKey(uid int64) ([]*PublicKey, error) {
 	return keys, nil
 }
 
-// rewriteAuthorizedKeys finds and deletes corresponding line in authorized_keys file.
+// rewriteAuthorizedKeys finds and deletes corresponding line in authorized_keys file,
+// caller must hold sshOpLocker.
 func rewriteAuthorizedKeys(key *PublicKey, p, tmpP string) error {
-	sshOpLocker.Lock()
-	defer sshOpLocker.Unlock()
-
 	fr, err := os.Open(p)
 	if err != nil {
 		return err
 	}
 	defer fr.Close()
 
-	fw, err := os.OpenFile(tmpP, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	fw, err := os.OpenFile(tmpP, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
@@ -306,8 +336,14 @@ func DeletePublicKey(key *PublicKey) error {
 
 	if _, err = x.Delete(key); err != nil {
 		return err
+	} else if setting.DisableSshAuthorizedKeys {
+		return nil
 	}
 
+	// Lock is held until the new file replaces the old one, so that no key is appended in between.
+	sshOpLocker.Lock()
+	defer sshOpLocker.Unlock()
+
 	fpath := filepath.Join(SshPath, "authorized_keys")
 	tmpPath := filepath.Join(SshPath, "authorized_keys.tmp")
 	if err = rewriteAuthorizedKeys(key, fpath, tmpPath); err != nil {
@@ -0,0 +1,601 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/process"
+)
+
+var (
+	ErrPullRequestNotExist     = errors.New("Pull request does not exist")
+	ErrPullRequestAlreadyExist = errors.New("Pull request already exists")
+	ErrPullRequestNotMergeable = errors.New("Pull request is not mergeable")
+	ErrPullRequestHasMerged    = errors.New("Pull request has been merged")
+)
+
+type PullRequestStatus int
+
+const (
+	PR_STATUS_CHECKING PullRequestStatus = iota + 1
+	PR_STATUS_CONFLICT
+	PR_STATUS_MERGEABLE
+	PR_STATUS_BRANCH_MISSING // Head repository, head or base branch is gone.
+)
+
+// PullRequest represents relation between pull request and repositories.
+type PullRequest struct {
+	Id             int64
+	PullId         int64  `xorm:"INDEX"` // Issue ID of pull request.
+	Issue          *Issue `xorm:"-"`
+	PullIndex      int64
+	HeadRepoId     int64       `xorm:"INDEX"`
+	HeadRepo       *Repository `xorm:"-"`
+	BaseRepoId     int64       `xorm:"INDEX"`
+	BaseRepo       *Repository `xorm:"-"`
+	HeadUserName   string
+	HeadBranch     string
+	BaseBranch     string
+	MergeBase      string `xorm:"VARCHAR(40)"`
+	Status         PullRequestStatus
+	HasMerged      bool
+	MergedCommitId string `xorm:"VARCHAR(40)"`
+	MergerId       int64
+	Merger         *User `xorm:"-"`
+	Merged         time.Time
+}
+
+// GetIssue loads the issue that the pull request belongs to.
+func (pr *PullRequest) GetIssue() (err error) {
+	pr.Issue, err = GetIssueById(pr.PullId)
+	return err
+}
+
+// GetHeadRepo loads the head repository and its owner.
+func (pr *PullRequest) GetHeadRepo() (err error) {
+	pr.HeadRepo, err = GetRepositoryById(pr.HeadRepoId)
+	if err != nil {
+		return err
+	}
+	return pr.HeadRepo.GetOwner()
+}
+
+// GetBaseRepo loads the base repository and its owner.
+func (pr *PullRequest) GetBaseRepo() (err error) {
+	pr.BaseRepo, err = GetRepositoryById(pr.BaseRepoId)
+	if err != nil {
+		return err
+	}
+	return pr.BaseRepo.GetOwner()
+}
+
+// GetMerger loads the user who merged the pull request.
+func (pr *PullRequest) GetMerger() (err error) {
+	if !pr.HasMerged {
+		return nil
+	}
+	pr.Merger, err = GetUserById(pr.MergerId)
+	if err == ErrUserNotExist {
+		pr.Merger = &User{Name: "FakeUser"}
+		return nil
+	}
+	return err
+}
+
+// HeadRefName returns the reference in base repository that tracks head branch.
+func (pr *PullRequest) HeadRefName() string {
+	return fmt.Sprintf("refs/pull/%d/head", pr.PullIndex)
+}
+
+// IsChecking returns true if the pull request is still waiting for mergeable check.
+func (pr *PullRequest) IsChecking() bool {
+	return pr.Status == PR_STATUS_CHECKING
+}
+
+// IsBranchMissing returns true if the pull request cannot be checked
+// because its head repository, head or base branch has been deleted.
+func (pr *PullRequest) IsBranchMissing() bool {
+	return pr.Status == PR_STATUS_BRANCH_MISSING
+}
+
+// CanAutoMerge returns true if the pull request can be merged without conflicts.
+func (pr *PullRequest) CanAutoMerge() bool {
+	return pr.Status == PR_STATUS_MERGEABLE
+}
+
+// HeadCommitId returns the commit ID that head reference of pull request points to.
+func (pr *PullRequest) HeadCommitId() (string, error) {
+	if pr.BaseRepo == nil {
+		if err := pr.GetBaseRepo(); err != nil {
+			return "", err
+		}
+	}
+	gitRepo, err := git.OpenRepository(RepoPath(pr.BaseRepo.Owner.Name, pr.BaseRepo.Name))
+	if err != nil {
+		return "", err
+	}
+	return gitRepo.GetCommitIdOfRef(pr.HeadRefName())
+}
+
+// fetchHead fetches head branch into base repository as pull request reference.
+func (pr *PullRequest) fetchHead() error {
+	if pr.HeadRepo == nil {
+		if err := pr.GetHeadRepo(); err != nil {
+			return err
+		}
+	}
+	if pr.BaseRepo == nil {
+		if err := pr.GetBaseRepo(); err != nil {
+			return err
+		}
+	}
+
+	headRepoPath := RepoPath(pr.HeadRepo.Owner.Name, pr.HeadRepo.Name)
+	baseRepoPath := RepoPath(pr.BaseRepo.Owner.Name, pr.BaseRepo.Name)
+	if _, stderr, err := process.ExecDir(-1, baseRepoPath,
+		fmt.Sprintf("PullRequest.fetchHead(git fetch): %s", baseRepoPath),
+		"git", "fetch", "-f", headRepoPath,
+		"+refs/heads/"+pr.HeadBranch+":"+pr.HeadRefName()); err != nil {
+		return errors.New("git fetch: " + stderr)
+	}
+	return nil
+}
+
+// prepareMergeRepo clones base branch into given temporary path,
+// and merges head of pull request without committing.
+func (pr *PullRequest) prepareMergeRepo(tmpPath string) (err error) {
+	baseRepoPath := RepoPath(pr.BaseRepo.Owner.Name, pr.BaseRepo.Name)
+
+	var stderr string
+	if _, stderr, err = process.ExecTimeout(5*time.Minute,
+		fmt.Sprintf("PullRequest.prepareMergeRepo(git clone): %s", tmpPath),
+		"git", "clone", "-b", pr.BaseBranch, baseRepoPath, tmpPath); err != nil {
+		return errors.New("git clone: " + stderr)
+	}
+
+	if _, stderr, err = process.ExecDir(-1, tmpPath,
+		fmt.Sprintf("PullRequest.prepareMergeRepo(git fetch): %s", tmpPath),
+		"git", "fetch", "origin", pr.HeadRefName()); err != nil {
+		return errors.New("git fetch: " + stderr)
+	}
+
+	if _, stderr, err = process.ExecDir(-1, tmpPath,
+		fmt.Sprintf("PullRequest.prepareMergeRepo(git merge): %s", tmpPath),
+		"git", "merge", "--no-ff", "--no-commit", "FETCH_HEAD"); err != nil {
+		return ErrPullRequestNotMergeable
+	}
+	return nil
+}
+
+// isBranchMissing returns true if head repository, head or base branch
+// of the pull request does not exist.
+func (pr *PullRequest) isBranchMissing() (bool, error) {
+	if pr.HeadRepo == nil {
+		if err := pr.GetHeadRepo(); err == ErrRepoNotExist {
+			return true, nil
+		} else if err != nil {
+			return false, fmt.Errorf("GetHeadRepo: %v", err)
+		}
+	}
+	if pr.BaseRepo == nil {
+		if err := pr.GetBaseRepo(); err != nil {
+			return false, fmt.Errorf("GetBaseRepo: %v", err)
+		}
+	}
+
+	headRepo, err := git.OpenRepository(RepoPath(pr.HeadRepo.Owner.Name, pr.HeadRepo.Name))
+	if err != nil {
+		return false, fmt.Errorf("OpenRepository: %v", err)
+	}
+	baseRepo, err := git.OpenRepository(RepoPath(pr.BaseRepo.Owner.Name, pr.BaseRepo.Name))
+	if err != nil {
+		return false, fmt.Errorf("OpenRepository: %v", err)
+	}
+	return !headRepo.IsBranchExist(pr.HeadBranch) || !baseRepo.IsBranchExist(pr.BaseBranch), nil
+}
+
+// UpdatePatch fetches latest head branch, then recalculates merge base
+// and mergeable status of the pull request.
+func (pr *PullRequest) UpdatePatch() (err error) {
+	if pr.HasMerged {
+		return nil
+	}
+
+	// Pull request is checked again once the missing branch is pushed.
+	isMissing, err := pr.isBranchMissing()
+	if err != nil {
+		return fmt.Errorf("isBranchMissing: %v", err)
+	} else if isMissing {
+		pr.Status = PR_STATUS_BRANCH_MISSING
+		return UpdatePullRequest(pr)
+	}
+
+	if err = pr.fetchHead(); err != nil {
+		return fmt.Errorf("fetchHead: %v", err)
+	}
+
+	gitRepo, err := git.OpenRepository(RepoPath(pr.BaseRepo.Owner.Name, pr.BaseRepo.Name))
+	if err != nil {
+		return fmt.Errorf("OpenRepository: %v", err)
+	}
+	pr.MergeBase, err = gitRepo.GetMergeBase("refs/heads/"+pr.BaseBranch, pr.HeadRefName())
+	if err != nil {
+		return fmt.Errorf("GetMergeBase: %v", err)
+	}
+
+	tmpPath := filepath.Join(os.TempDir(), "gogs-pull", com.ToStr(time.Now().Nanosecond()))
+	os.MkdirAll(filepath.Dir(tmpPath), os.ModePerm)
+	defer os.RemoveAll(tmpPath)
+
+	pr.Status = PR_STATUS_MERGEABLE
+	if err = pr.prepareMergeRepo(tmpPath); err != nil {
+		if err != ErrPullRequestNotMergeable {
+			return fmt.Errorf("prepareMergeRepo: %v", err)
+		}
+		pr.Status = PR_STATUS_CONFLICT
+	}
+	return UpdatePullRequest(pr)
+}
+
+// Merge merges pull request to base branch on behalf of given user.
+func (pr *PullRequest) Merge(doer *User) (err error) {
+	if pr.HasMerged {
+		return ErrPullRequestHasMerged
+	}
+	if pr.Issue == nil {
+		if err = pr.GetIssue(); err != nil {
+			return err
+		}
+	}
+	if err = pr.UpdatePatch(); err != nil {
+		return err
+	} else if !pr.CanAutoMerge() {
+		return ErrPullRequestNotMergeable
+	}
+
+	// Merge commit is always a fast-forward, only whitelist needs to be checked.
+	pb, err := GetProtectBranchOfRepoByName(pr.BaseRepoId, pr.BaseBranch)
+	if err != nil {
+		if err != ErrProtectBranchNotExist {
+			return fmt.Errorf("GetProtectBranchOfRepoByName: %v", err)
+		}
+	} else if !pb.CanUserPush(doer.Id) {
+		return ErrBranchProtected{pr.BaseBranch, PROTECT_REASON_NOT_ALLOWED}
+	}
+
+	baseRepoPath := RepoPath(pr.BaseRepo.Owner.Name, pr.BaseRepo.Name)
+	gitRepo, err := git.OpenRepository(baseRepoPath)
+	if err != nil {
+		return fmt.Errorf("OpenRepository: %v", err)
+	}
+	oldCommitId, err := gitRepo.GetCommitIdOfBranch(pr.BaseBranch)
+	if err != nil {
+		return fmt.Errorf("GetCommitIdOfBranch: %v", err)
+	}
+
+	tmpPath := filepath.Join(os.TempDir(), "gogs-pull", com.ToStr(time.Now().Nanosecond()))
+	os.MkdirAll(filepath.Dir(tmpPath), os.ModePerm)
+	defer os.RemoveAll(tmpPath)
+
+	if err = pr.prepareMergeRepo(tmpPath); err != nil {
+		return err
+	}
+
+	sig := doer.NewGitSig()
+	var stderr string
+	if _, stderr, err = process.ExecDir(-1, tmpPath,
+		fmt.Sprintf("PullRequest.Merge(git commit): %s", tmpPath),
+		"git", "-c", "user.name="+sig.Name, "-c", "user.email="+sig.Email,
+		"commit", fmt.Sprintf("--author=%s <%s>", sig.Name, sig.Email),
+		"-m", fmt.Sprintf("Merge branch '%s' of %s/%s into %s",
+			pr.HeadBranch, pr.HeadUserName, pr.HeadRepo.Name, pr.BaseBranch)); err != nil {
+		return errors.New("git commit: " + stderr)
+	}
+
+	stdout, stderr, err := process.ExecDir(-1, tmpPath,
+		fmt.Sprintf("PullRequest.Merge(git rev-parse): %s", tmpPath),
+		"git", "rev-parse", "HEAD")
+	if err != nil {
+		return errors.New("git rev-parse: " + stderr)
+	}
+	pr.MergedCommitId = strings.TrimSpace(stdout)
+
+	if _, stderr, err = process.ExecDir(-1, tmpPath,
+		fmt.Sprintf("PullRequest.Merge(git push): %s", tmpPath),
+		"git", "push", "origin", pr.BaseBranch); err != nil {
+		return errors.New("git push: " + stderr)
+	}
+
+	pr.HasMerged = true
+	pr.MergerId = doer.Id
+	pr.Merger = doer
+	pr.Merged = time.Now()
+	if err = UpdatePullRequest(pr); err != nil {
+		return fmt.Errorf("UpdatePullRequest: %v", err)
+	}
+	if err = ChangePullRequestStatus(pr.Issue, doer, true); err != nil {
+		return fmt.Errorf("ChangePullRequestStatus: %v", err)
+	}
+
+	if err = NotifyWatchers(&Action{
+		ActUserId:    doer.Id,
+		ActUserName:  doer.Name,
+		ActEmail:     doer.Email,
+		OpType:       MERGE_PULL_REQUEST,
+		Content:      fmt.Sprintf("%d|%s", pr.Issue.Index, pr.Issue.Name),
+		RepoId:       pr.BaseRepo.Id,
+		RepoUserName: pr.BaseRepo.Owner.Name,
+		RepoName:     pr.BaseRepo.Name,
+		IsPrivate:    pr.BaseRepo.IsPrivate,
+	}); err != nil {
+		log.Error(4, "NotifyWatchers: %v", err)
+	}
+
+	// Go through normal update process, so feeds and webhooks are triggered.
+	return Update("refs/heads/"+pr.BaseBranch, oldCommitId, pr.MergedCommitId,
+		doer.Name, pr.BaseRepo.Owner.Name, pr.BaseRepo.Name, doer.Id)
+}
+
+// NewPullRequest creates new pull request with its issue for repository.
+func NewPullRequest(repo *Repository, pull *Issue, pr *PullRequest) (err error) {
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+
+	pull.IsPull = true
+	if _, err = sess.Insert(pull); err != nil {
+		sess.Rollback()
+		return err
+	}
+
+	rawSql := "UPDATE `repository` SET num_pulls = num_pulls + 1 WHERE id = ?"
+	if _, err = sess.Exec(rawSql, repo.Id); err != nil {
+		sess.Rollback()
+		return err
+	}
+
+	pr.PullId = pull.Id
+	pr.PullIndex = pull.Index
+	pr.Status = PR_STATUS_CHECKING
+	if _, err = sess.Insert(pr); err != nil {
+		sess.Rollback()
+		return err
+	}
+
+	if err = sess.Commit(); err != nil {
+		return err
+	}
+
+	pr.Issue = pull
+	if err = pr.UpdatePatch(); err != nil {
+		log.Error(4, "UpdatePatch[%d]: %v", pr.Id, err)
+	}
+	return nil
+}
+
+// filterOpenPullRequests returns pull requests whose issues are still open.
+func filterOpenPullRequests(prs []*PullRequest) ([]*PullRequest, error) {
+	opens := make([]*PullRequest, 0, len(prs))
+	for _, pr := range prs {
+		if err := pr.GetIssue(); err != nil {
+			if err == ErrIssueNotExist {
+				continue
+			}
+			return nil, err
+		}
+		if !pr.Issue.IsClosed {
+			opens = append(opens, pr)
+		}
+	}
+	return opens, nil
+}
+
+// GetUnmergedPullRequest returns a pull request that is open and has not been merged
+// by given head/base and repository/branch.
+func GetUnmergedPullRequest(headRepoId, baseRepoId int64, headBranch, baseBranch string) (*PullRequest, error) {
+	prs := make([]*PullRequest, 0, 1)
+	if err := x.Where("head_repo_id=? AND head_branch=? AND base_repo_id=? AND base_branch=? AND has_merged=?",
+		headRepoId, headBranch, baseRepoId, baseBranch, false).Find(&prs); err != nil {
+		return nil, err
+	}
+
+	prs, err := filterOpenPullRequests(prs)
+	if err != nil {
+		return nil, err
+	} else if len(prs) == 0 {
+		return nil, ErrPullRequestNotExist
+	}
+	return prs[0], nil
+}
+
+// GetUnmergedPullRequestsByBranch returns all pull requests that are open and have not been merged,
+// and whose head or base branch is given branch of repository.
+func GetUnmergedPullRequestsByBranch(repoId int64, branch string) ([]*PullRequest, error) {
+	prs := make([]*PullRequest, 0, 2)
+	if err := x.Where("((head_repo_id=? AND head_branch=?) OR (base_repo_id=? AND base_branch=?)) AND has_merged=?",
+		repoId, branch, repoId, branch, false).Find(&prs); err != nil {
+		return nil, err
+	}
+	return filterOpenPullRequests(prs)
+}
+
+// GetPullRequestByPullId returns pull request by given issue ID.
+func GetPullRequestByPullId(pullId int64) (*PullRequest, error) {
+	pr := &PullRequest{PullId: pullId}
+	has, err := x.Get(pr)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, ErrPullRequestNotExist
+	}
+	return pr, nil
+}
+
+// GetPulls returns a list of pull requests of given repository and status.
+func GetPulls(repoId int64, page int, isClosed bool) ([]*Issue, error) {
+	pulls := make([]*Issue, 0, 20)
+	err := x.Limit(20, (page-1)*20).Where("repo_id=?", repoId).And("is_pull=?", true).
+		And("is_closed=?", isClosed).Desc("created").Find(&pulls)
+	return pulls, err
+}
+
+// UpdatePullRequest updates all information of given pull request.
+func UpdatePullRequest(pr *PullRequest) error {
+	_, err := x.Id(pr.Id).AllCols().Update(pr)
+	return err
+}
+
+// ChangePullRequestStatus closes or reopens the issue of pull request,
+// and updates corresponding counters.
+func ChangePullRequestStatus(pull *Issue, doer *User, isClosed bool) (err error) {
+	if pull.IsClosed == isClosed {
+		return nil
+	}
+
+	pull.IsClosed = isClosed
+	if err = UpdateIssue(pull); err != nil {
+		return err
+	} else if err = UpdateIssueUserPairsByStatus(pull.Id, isClosed); err != nil {
+		return err
+	}
+
+	cmtType := CLOSE
+	if !isClosed {
+		cmtType = REOPEN
+	}
+	_, err = CreateComment(doer.Id, pull.RepoId, pull.Id, 0, 0, cmtType, "", nil)
+	return err
+}
+
+const (
+	// PULL_REQUEST_POLL_INTERVAL is how often web server looks for pull requests
+	// that were marked as checking by other processes such as serv command.
+	PULL_REQUEST_POLL_INTERVAL = 5 * time.Second
+	// PULL_REQUEST_RETRY_INTERVAL is how long a pull request that failed to be tested
+	// waits before it is tested again.
+	PULL_REQUEST_RETRY_INTERVAL = 10 * time.Minute
+)
+
+var (
+	// pullRequestQueue holds IDs of pull requests that wait to be tested by web server.
+	pullRequestQueue = make(chan int64, 1000)
+
+	pullRequestsLock    sync.Mutex
+	pullRequestsTesting = make(map[int64]bool)
+	// pullRequestsFailed records when tests of pull requests failed last time.
+	pullRequestsFailed = make(map[int64]time.Time)
+)
+
+// AddTestPullRequestTask marks all pull requests that are related to given branch
+// of repository as checking and queues them to be tested in background.
+func AddTestPullRequestTask(repoId int64, branch string) {
+	prs, err := GetUnmergedPullRequestsByBranch(repoId, branch)
+	if err != nil {
+		log.Error(4, "GetUnmergedPullRequestsByBranch[%d:%s]: %v", repoId, branch, err)
+		return
+	}
+
+	for _, pr := range prs {
+		pr.Status = PR_STATUS_CHECKING
+		if _, err = x.Id(pr.Id).Cols("status").Update(pr); err != nil {
+			log.Error(4, "Update status[%d]: %v", pr.Id, err)
+			continue
+		}
+
+		// New push may have fixed what made previous test fail.
+		pullRequestsLock.Lock()
+		delete(pullRequestsFailed, pr.Id)
+		pullRequestsLock.Unlock()
+
+		// Queue is not consumed by other processes such as serv command, pull requests
+		// that are not queued are picked up by next run of CheckPullRequests.
+		select {
+		case pullRequestQueue <- pr.Id:
+		default:
+		}
+	}
+}
+
+// testPullRequest updates patch of pull request that is still waiting to be checked,
+// it does nothing if the pull request is being tested already.
+func testPullRequest(id int64) {
+	pullRequestsLock.Lock()
+	if pullRequestsTesting[id] || time.Since(pullRequestsFailed[id]) < PULL_REQUEST_RETRY_INTERVAL {
+		pullRequestsLock.Unlock()
+		return
+	}
+	pullRequestsTesting[id] = true
+	pullRequestsLock.Unlock()
+
+	defer func() {
+		pullRequestsLock.Lock()
+		delete(pullRequestsTesting, id)
+		pullRequestsLock.Unlock()
+	}()
+
+	pr := new(PullRequest)
+	has, err := x.Id(id).Get(pr)
+	if err != nil {
+		log.Error(4, "Get pull request[%d]: %v", id, err)
+		return
+	} else if !has || pr.HasMerged || pr.Status != PR_STATUS_CHECKING {
+		return
+	}
+
+	if err = pr.UpdatePatch(); err != nil {
+		log.Error(4, "UpdatePatch[%d]: %v", pr.Id, err)
+		pullRequestsLock.Lock()
+		pullRequestsFailed[id] = time.Now()
+		pullRequestsLock.Unlock()
+		return
+	}
+
+	pullRequestsLock.Lock()
+	delete(pullRequestsFailed, id)
+	pullRequestsLock.Unlock()
+}
+
+// CheckPullRequests tests all pull requests that are waiting to be checked.
+func CheckPullRequests() {
+	prs := make([]*PullRequest, 0, 10)
+	if err := x.Where("status=? AND has_merged=?", PR_STATUS_CHECKING, false).Find(&prs); err != nil {
+		log.Error(4, "Find checking pull requests: %v", err)
+		return
+	}
+	for _, pr := range prs {
+		testPullRequest(pr.Id)
+	}
+}
+
+// TestPullRequests checks pull requests that were left unchecked, then keeps
+// testing pull requests from the queue. Database is polled as well, so pushes
+// through serv command are tested soon.
+func TestPullRequests() {
+	CheckPullRequests()
+
+	ticker := time.NewTicker(PULL_REQUEST_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case id := <-pullRequestQueue:
+			testPullRequest(id)
+		case <-ticker.C:
+			CheckPullRequests()
+		}
+	}
+}
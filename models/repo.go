@@ -125,8 +125,9 @@ type Repository struct {
 	OwnerId             int64 `xorm:"UNIQUE(s)"`
 	Owner               *User `xorm:"-"`
 	ForkId              int64
-	LowerName           string `xorm:"UNIQUE(s) INDEX NOT NULL"`
-	Name                string `xorm:"INDEX NOT NULL"`
+	ForkRepo            *Repository `xorm:"-"`
+	LowerName           string      `xorm:"UNIQUE(s) INDEX NOT NULL"`
+	Name                string      `xorm:"INDEX NOT NULL"`
 	Description         string
 	Website             string
 	NumWatches          int
@@ -149,6 +150,7 @@ type Repository struct {
 	IsBare              bool
 	IsGoget             bool
 	DefaultBranch       string
+	LanguagesCommitId   string    `xorm:"VARCHAR(40)"` // Commit of default branch that languages were computed for.
 	Created             time.Time `xorm:"CREATED"`
 	Updated             time.Time `xorm:"UPDATED"`
 }
@@ -158,6 +160,25 @@ func (repo *Repository) GetOwner() (err error) {
 	return err
 }
 
+// NextIssueIndex returns the index for next issue or pull request,
+// they share the same sequence in one repository.
+func (repo *Repository) NextIssueIndex() int64 {
+	return int64(repo.NumIssues+repo.NumPulls) + 1
+}
+
+// GetForkRepo loads the repository that this repository is forked from.
+func (repo *Repository) GetForkRepo() (err error) {
+	if !repo.IsFork {
+		return nil
+	}
+
+	repo.ForkRepo, err = GetRepositoryById(repo.ForkId)
+	if err != nil {
+		return err
+	}
+	return repo.ForkRepo.GetOwner()
+}
+
 func (repo *Repository) GetMirror() (err error) {
 	repo.Mirror, err = GetMirror(repo.Id)
 	return err
@@ -187,8 +208,8 @@ func IsRepositoryExist(u *User, repoName string) (bool, error) {
 }
 
 var (
-	illegalEquals  = []string{"debug", "raw", "install", "api", "avatar", "user", "org", "help", "stars", "issues", "pulls", "commits", "repo", "template", "admin", "new"}
-	illegalSuffixs = []string{".git"}
+	illegalEquals  = []string{"debug", "raw", "install", "api", "avatar", "user", "org", "help", "stars", "issues", "pulls", "commits", "repo", "template", "admin", "new", "explore"}
+	illegalSuffixs = []string{".git", ".wiki"}
 )
 
 // IsLegalName returns false if name contains illegal characters.
@@ -727,11 +748,22 @@ func TransferOwnership(u *User, newOwner string, repo *Repository) (err error) {
 	}
 
 	// Change repository directory name.
+	git.CloseCatFileProcesses(RepoPath(u.Name, repo.Name))
 	if err = os.Rename(RepoPath(u.Name, repo.Name), RepoPath(newUser.Name, repo.Name)); err != nil {
 		sess.Rollback()
 		return err
 	}
 
+	// Move wiki along with repository.
+	wikiPath := WikiPath(u.Name, repo.Name)
+	if com.IsDir(wikiPath) {
+		git.CloseCatFileProcesses(wikiPath)
+		if err = os.Rename(wikiPath, WikiPath(newUser.Name, repo.Name)); err != nil {
+			sess.Rollback()
+			return err
+		}
+	}
+
 	if err = sess.Commit(); err != nil {
 		return err
 	}
@@ -779,11 +811,21 @@ func ChangeRepositoryName(userName, oldRepoName, newRepoName string) (err error)
 	}
 
 	// Change repository directory name.
+	git.CloseCatFileProcesses(RepoPath(userName, oldRepoName))
 	if err = os.Rename(RepoPath(userName, oldRepoName), RepoPath(userName, newRepoName)); err != nil {
 		sess.Rollback()
 		return err
 	}
 
+	wikiPath := WikiPath(userName, oldRepoName)
+	if com.IsDir(wikiPath) {
+		git.CloseCatFileProcesses(wikiPath)
+		if err = os.Rename(wikiPath, WikiPath(userName, newRepoName)); err != nil {
+			sess.Rollback()
+			return err
+		}
+	}
+
 	return sess.Commit()
 }
 
@@ -876,6 +918,24 @@ func DeleteRepository(uid, repoId int64, userName string) error {
 		sess.Rollback()
 		return err
 	}
+	if _, err = sess.Delete(&PullRequest{BaseRepoId: repoId}); err != nil {
+		sess.Rollback()
+		return err
+	}
+	// Pull requests from the repository to others cannot be checked or merged any more.
+	if _, err = sess.Exec("UPDATE `pull_request` SET status = ? WHERE head_repo_id = ? AND has_merged = ?",
+		PR_STATUS_BRANCH_MISSING, repoId, false); err != nil {
+		sess.Rollback()
+		return err
+	}
+	if _, err = sess.Delete(&ProtectBranch{RepoId: repoId}); err != nil {
+		sess.Rollback()
+		return err
+	}
+	if _, err = sess.Delete(&RepoLanguage{RepoId: repoId}); err != nil {
+		sess.Rollback()
+		return err
+	}
 
 	// Delete comments.
 	if err = x.Iterate(&Issue{RepoId: repoId}, func(idx int, bean interface{}) error {
@@ -899,11 +959,41 @@ func DeleteRepository(uid, repoId int64, userName string) error {
 		sess.Rollback()
 		return err
 	}
+
+	if repo.IsFork {
+		if _, err = sess.Exec("UPDATE `repository` SET num_forks = num_forks - 1 WHERE id = ?", repo.ForkId); err != nil {
+			sess.Rollback()
+			return err
+		}
+	}
+	// Forks become independent repositories once their base repository is deleted.
+	if _, err = sess.Exec("UPDATE `repository` SET fork_id = 0, is_fork = ? WHERE fork_id = ?", false, repoId); err != nil {
+		sess.Rollback()
+		return err
+	}
+
+	git.CloseCatFileProcesses(RepoPath(userName, repo.Name))
 	if err = os.RemoveAll(RepoPath(userName, repo.Name)); err != nil {
 		sess.Rollback()
 		return err
 	}
-	return sess.Commit()
+	git.CloseCatFileProcesses(WikiPath(userName, repo.Name))
+	if err = os.RemoveAll(WikiPath(userName, repo.Name)); err != nil {
+		sess.Rollback()
+		return err
+	}
+	if err = DeleteRepoIndex(repoId); err != nil {
+		log.Error(4, "DeleteRepoIndex(%d): %v", repoId, err)
+	}
+	if err = sess.Commit(); err != nil {
+		return err
+	}
+
+	// LFS objects may be shared with other repositories, so they are unlinked after the deletion.
+	if err = deleteLFSObjectsOfRepo(repoId); err != nil {
+		log.Error(4, "deleteLFSObjectsOfRepo(%d): %v", repoId, err)
+	}
+	return nil
 }
 
 // GetRepositoryByRef returns a Repository specified by a GFM reference.
@@ -1038,33 +1128,38 @@ func GetCollaborators(repoName string) (us []*User, err error) {
 }
 
 type SearchOption struct {
-	Keyword string
-	Uid     int64
-	Limit   int
+	Keyword  string
+	Uid      int64
+	Limit    int
+	Language string // Only repositories that contain code of the language.
 }
 
-// SearchRepositoryByName returns given number of repositories whose name contains keyword.
+// SearchRepositoryByName returns given number of repositories whose name contains keyword,
+// keyword can be empty when searching by language.
 func SearchRepositoryByName(opt SearchOption) (repos []*Repository, err error) {
-	// Prevent SQL inject.
 	opt.Keyword = strings.TrimSpace(opt.Keyword)
-	if len(opt.Keyword) == 0 {
-		return repos, nil
+	if len(opt.Keyword) > 0 {
+		opt.Keyword = strings.ToLower(strings.Split(opt.Keyword, " ")[0])
 	}
-
-	opt.Keyword = strings.Split(opt.Keyword, " ")[0]
-	if len(opt.Keyword) == 0 {
+	opt.Language = strings.ToLower(strings.TrimSpace(opt.Language))
+	if len(opt.Keyword) == 0 && len(opt.Language) == 0 {
 		return repos, nil
 	}
-	opt.Keyword = strings.ToLower(opt.Keyword)
 
 	repos = make([]*Repository, 0, opt.Limit)
 
 	// Append conditions.
-	sess := x.Limit(opt.Limit)
+	sess := x.Limit(opt.Limit).Where("1=1")
 	if opt.Uid > 0 {
-		sess.Where("owner_id=?", opt.Uid)
+		sess.And("owner_id=?", opt.Uid)
+	}
+	if len(opt.Keyword) > 0 {
+		sess.And("lower_name like ?", "%"+opt.Keyword+"%")
 	}
-	sess.And("lower_name like '%" + opt.Keyword + "%'").Find(&repos)
+	if len(opt.Language) > 0 {
+		sess.And("id IN (SELECT repo_id FROM repo_language WHERE lower_language=?)", opt.Language)
+	}
+	err = sess.Find(&repos)
 	return repos, err
 }
 
@@ -1172,6 +1267,115 @@ func IsStaring(uid, repoId int64) bool {
 	return has
 }
 
-func ForkRepository(repoName string, uid int64) {
+// ForkRepository forks given repository to user, the fork keeps same name as original repository.
+func ForkRepository(u *User, oldRepo *Repository) (*Repository, error) {
+	if oldRepo.OwnerId == u.Id {
+		return nil, ErrRepoAlreadyExist
+	}
+
+	isExist, err := IsRepositoryExist(u, oldRepo.Name)
+	if err != nil {
+		return nil, err
+	} else if isExist {
+		return nil, ErrRepoAlreadyExist
+	}
 
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return nil, err
+	}
+
+	repo := &Repository{
+		OwnerId:     u.Id,
+		Owner:       u,
+		Name:        oldRepo.Name,
+		LowerName:   oldRepo.LowerName,
+		Description: oldRepo.Description,
+		IsPrivate:   oldRepo.IsPrivate,
+		IsBare:      oldRepo.IsBare,
+		IsFork:      true,
+		ForkId:      oldRepo.Id,
+	}
+
+	if _, err = sess.Insert(repo); err != nil {
+		sess.Rollback()
+		return nil, err
+	}
+
+	access := &Access{
+		UserName: u.LowerName,
+		RepoName: path.Join(u.LowerName, repo.LowerName),
+		Mode:     WRITABLE,
+	}
+	if _, err = sess.Insert(access); err != nil {
+		sess.Rollback()
+		return nil, err
+	}
+
+	if _, err = sess.Exec(
+		"UPDATE `user` SET num_repos = num_repos + 1 WHERE id = ?", u.Id); err != nil {
+		sess.Rollback()
+		return nil, err
+	}
+
+	if _, err = sess.Exec(
+		"UPDATE `repository` SET num_forks = num_forks + 1 WHERE id = ?", oldRepo.Id); err != nil {
+		sess.Rollback()
+		return nil, err
+	}
+
+	oldRepoPath := RepoPath(oldRepo.Owner.Name, oldRepo.Name)
+	repoPath := RepoPath(u.Name, repo.Name)
+	if _, stderr, err := process.ExecTimeout(10*time.Minute,
+		fmt.Sprintf("ForkRepository(git clone): %s/%s", u.Name, repo.Name),
+		"git", "clone", "--bare", oldRepoPath, repoPath); err != nil {
+		sess.Rollback()
+		os.RemoveAll(repoPath)
+		return nil, errors.New("ForkRepository(git clone): " + stderr)
+	}
+
+	// hook/post-update
+	if err = createHookUpdate(filepath.Join(repoPath, "hooks", "update"),
+		fmt.Sprintf(TPL_UPDATE_HOOK, setting.ScriptType, "\""+appPath+"\"")); err != nil {
+		sess.Rollback()
+		os.RemoveAll(repoPath)
+		return nil, err
+	}
+
+	if _, stderr, err := process.ExecDir(-1,
+		repoPath, fmt.Sprintf("ForkRepository(git update-server-info): %s", repoPath),
+		"git", "update-server-info"); err != nil {
+		sess.Rollback()
+		os.RemoveAll(repoPath)
+		return nil, errors.New("ForkRepository(git update-server-info): " + stderr)
+	}
+
+	if err = sess.Commit(); err != nil {
+		os.RemoveAll(repoPath)
+		return nil, err
+	}
+
+	if err = WatchRepo(u.Id, repo.Id, true); err != nil {
+		log.Error(4, "WatchRepo: %v", err)
+	}
+	if err = NewRepoAction(u, repo); err != nil {
+		log.Error(4, "NewRepoAction: %v", err)
+	}
+	return repo, nil
+}
+
+// GetForks returns all the forks of given repository.
+func GetForks(repo *Repository) ([]*Repository, error) {
+	forks := make([]*Repository, 0, repo.NumForks)
+	if err := x.Find(&forks, &Repository{ForkId: repo.Id}); err != nil {
+		return nil, err
+	}
+
+	for _, fork := range forks {
+		if err := fork.GetOwner(); err != nil {
+			return nil, err
+		}
+	}
+	return forks, nil
 }
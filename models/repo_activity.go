@@ -0,0 +1,188 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gogits/gogs/modules/git"
+)
+
+// ActivityPeriods contains names of supported periods of activity statistics,
+// zero duration means all history.
+var ActivityPeriods = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"week", 7 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"quarter", 91 * 24 * time.Hour},
+	{"year", 365 * 24 * time.Hour},
+	{"all", 0},
+}
+
+// WeekActivity represents commits that were authored in a week.
+type WeekActivity struct {
+	Start     time.Time
+	Commits   int
+	Additions int
+	Deletions int
+	Percent   int // Relative to the busiest week.
+}
+
+// Contributor represents commits of an author, User is nil
+// when e-mail of author does not belong to any user.
+type Contributor struct {
+	Name      string
+	Email     string
+	User      *User `json:"-"`
+	Commits   int
+	Additions int
+	Deletions int
+	Percent   int // Relative to the top contributor.
+}
+
+// PunchCardCell represents commits that were authored in an hour of a day of week.
+type PunchCardCell struct {
+	Commits int
+	Size    int // Relative to the busiest hour, from 0 to 100.
+}
+
+// RepoActivity represents activity statistics of repository in a period.
+type RepoActivity struct {
+	Since             time.Time
+	TotalCommits      int
+	TotalAdditions    int
+	TotalDeletions    int
+	TotalContributors int
+	Weeks             []*WeekActivity
+	Contributors      []*Contributor
+	// PunchCard is indexed by day of week from Sunday and hour of day.
+	PunchCard [7][24]*PunchCardCell
+}
+
+type contributorSlice []*Contributor
+
+func (s contributorSlice) Len() int      { return len(s) }
+func (s contributorSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s contributorSlice) Less(i, j int) bool {
+	if s[i].Commits != s[j].Commits {
+		return s[i].Commits > s[j].Commits
+	}
+	return s[i].Additions+s[i].Deletions > s[j].Additions+s[j].Deletions
+}
+
+// weekStart returns the beginning of Sunday of week of given time in UTC.
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return t.AddDate(0, 0, -int(t.Weekday()))
+}
+
+// GetRepoActivity computes activity statistics of history of given commit since given time,
+// zero time means all history.
+func GetRepoActivity(gitRepo *git.Repository, commit *git.Commit, since time.Time) (*RepoActivity, error) {
+	stats, err := gitRepo.GetCommitStats(commit.Id.String(), since)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &RepoActivity{
+		Since:        since,
+		TotalCommits: len(stats),
+		Weeks:        make([]*WeekActivity, 0, 10),
+		Contributors: make([]*Contributor, 0, 10),
+	}
+	for day := range act.PunchCard {
+		for hour := range act.PunchCard[day] {
+			act.PunchCard[day][hour] = new(PunchCardCell)
+		}
+	}
+	if len(stats) == 0 {
+		return act, nil
+	}
+
+	// Commits are in reverse chronological order, weeks are filled
+	// from the oldest one so that weeks without commits are shown.
+	first := weekStart(stats[len(stats)-1].When)
+	if !since.IsZero() && weekStart(since).Before(first) {
+		first = weekStart(since)
+	}
+	for w := first; !w.After(weekStart(time.Now())); w = w.AddDate(0, 0, 7) {
+		act.Weeks = append(act.Weeks, &WeekActivity{Start: w})
+	}
+
+	contributors := make(map[string]*Contributor)
+	for _, stat := range stats {
+		act.TotalAdditions += stat.Additions
+		act.TotalDeletions += stat.Deletions
+
+		idx := int(weekStart(stat.When).Sub(first).Hours() / (24 * 7))
+		if idx >= 0 && idx < len(act.Weeks) {
+			act.Weeks[idx].Commits++
+			act.Weeks[idx].Additions += stat.Additions
+			act.Weeks[idx].Deletions += stat.Deletions
+		}
+
+		// Punch card uses local time of author.
+		act.PunchCard[stat.When.Weekday()][stat.When.Hour()].Commits++
+
+		c, ok := contributors[stat.AuthorEmail]
+		if !ok {
+			c = &Contributor{Name: stat.AuthorName, Email: stat.AuthorEmail}
+			contributors[stat.AuthorEmail] = c
+			act.Contributors = append(act.Contributors, c)
+		}
+		c.Commits++
+		c.Additions += stat.Additions
+		c.Deletions += stat.Deletions
+	}
+	sort.Sort(contributorSlice(act.Contributors))
+	act.TotalContributors = len(act.Contributors)
+
+	maxCommits := 0
+	for _, w := range act.Weeks {
+		if w.Commits > maxCommits {
+			maxCommits = w.Commits
+		}
+	}
+	for _, w := range act.Weeks {
+		if maxCommits > 0 {
+			w.Percent = w.Commits * 100 / maxCommits
+		}
+	}
+	for _, c := range act.Contributors {
+		c.Percent = c.Commits * 100 / act.Contributors[0].Commits
+	}
+
+	maxCommits = 0
+	for day := range act.PunchCard {
+		for _, cell := range act.PunchCard[day] {
+			if cell.Commits > maxCommits {
+				maxCommits = cell.Commits
+			}
+		}
+	}
+	for day := range act.PunchCard {
+		for _, cell := range act.PunchCard[day] {
+			cell.Size = cell.Commits * 100 / maxCommits
+		}
+	}
+	return act, nil
+}
+
+// LoadContributorUsers maps e-mails of contributors to user accounts.
+func (act *RepoActivity) LoadContributorUsers() error {
+	for _, c := range act.Contributors {
+		u, err := GetUserByEmail(c.Email)
+		if err == nil {
+			c.User = u
+		} else if err != ErrUserNotExist {
+			return err
+		}
+	}
+	return nil
+}
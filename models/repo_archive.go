@@ -0,0 +1,116 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+var (
+	archiveLock     sync.Mutex
+	archiveCreating = make(map[string]*sync.WaitGroup)
+)
+
+// archiveCachePath returns path of cached archive of given commit, format and directory.
+func archiveCachePath(repoPath, commitId string, archiveType git.ArchiveType, treePath string) string {
+	name := commitId
+	if len(treePath) > 0 {
+		name += "-" + base.EncodeMd5(treePath)
+	}
+	return filepath.Join(repoPath, "archives", archiveType.String(), name+archiveType.Ext())
+}
+
+// GetArchive returns path of archive of given directory of commit, empty tree path
+// means the whole repository. Archives are cached on disk, concurrent requests for
+// an archive that is being created wait for it instead of creating it again.
+func GetArchive(repoPath string, commit *git.Commit, archiveType git.ArchiveType, treePath string) (string, error) {
+	archivePath := archiveCachePath(repoPath, commit.Id.String(), archiveType, treePath)
+	for {
+		if com.IsFile(archivePath) {
+			// Update modification time so archives that are still in use are not evicted.
+			now := time.Now()
+			os.Chtimes(archivePath, now, now)
+			return archivePath, nil
+		}
+
+		archiveLock.Lock()
+		if wg, ok := archiveCreating[archivePath]; ok {
+			archiveLock.Unlock()
+			wg.Wait()
+			continue
+		}
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		archiveCreating[archivePath] = wg
+		archiveLock.Unlock()
+
+		err := createArchive(commit, archiveType, treePath, archivePath)
+
+		archiveLock.Lock()
+		delete(archiveCreating, archivePath)
+		archiveLock.Unlock()
+		wg.Done()
+
+		if err != nil {
+			return "", err
+		}
+		return archivePath, nil
+	}
+}
+
+// createArchive creates archive into a temporary file first,
+// so that incomplete archive is never served.
+func createArchive(commit *git.Commit, archiveType git.ArchiveType, treePath, archivePath string) error {
+	if err := os.MkdirAll(filepath.Dir(archivePath), os.ModePerm); err != nil {
+		return fmt.Errorf("MkdirAll: %v", err)
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d.tmp", archivePath, time.Now().UnixNano())
+	if err := commit.CreateTreeArchive(tmpPath, archiveType, treePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("CreateTreeArchive: %v", err)
+	}
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Rename: %v", err)
+	}
+	return nil
+}
+
+// DeleteOldRepositoryArchives deletes cached archives of all repositories
+// that have not been downloaded for longer than configured age.
+func DeleteOldRepositoryArchives() {
+	dirs, err := filepath.Glob(filepath.Join(setting.RepoRootPath, "*", "*.git", "archives"))
+	if err != nil {
+		log.Error(4, "DeleteOldRepositoryArchives(Glob): %v", err)
+		return
+	}
+
+	olderThan := time.Now().Add(-time.Duration(setting.RepoArchiveCacheMaxAge) * time.Hour)
+	for _, dir := range dirs {
+		if err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || info.ModTime().After(olderThan) {
+				return nil
+			}
+			return os.Remove(path)
+		}); err != nil {
+			log.Error(4, "DeleteOldRepositoryArchives(%s): %v", dir, err)
+		}
+	}
+}
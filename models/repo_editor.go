@@ -0,0 +1,367 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/process"
+)
+
+var (
+	ErrRepoFileAlreadyExist = errors.New("Repository file already exist")
+	ErrRepoFilePathIllegal  = errors.New("Repository file path is illegal")
+	ErrRepoFileOutdated     = errors.New("Repository file has been changed by others")
+	ErrRepoFileNoChange     = errors.New("Repository file has no change")
+)
+
+// CleanTreePath cleans given path of file in repository,
+// it returns an empty string if the path is illegal.
+func CleanTreePath(treePath string) string {
+	treePath = strings.Trim(path.Clean("/"+strings.Replace(treePath, "\\", "/", -1)), "/")
+	for _, name := range strings.Split(treePath, "/") {
+		if name == ".git" || name == ".." {
+			return ""
+		}
+	}
+	return treePath
+}
+
+// hasSymlinkInPath returns true if any existing component of tree path in given
+// working copy is a symbolic link. Symbolic links are committed by users and may
+// point outside of working copy, so files must never be written through them.
+func hasSymlinkInPath(root, treeName string) bool {
+	p := root
+	for _, name := range strings.Split(treeName, "/") {
+		if len(name) == 0 || name == "." {
+			continue
+		}
+		p = filepath.Join(p, name)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			// Components after a missing one do not exist either.
+			return !os.IsNotExist(err)
+		} else if fi.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// editorWorkingCopy represents a temporary working copy
+// that is used to make changes to repository from web editor.
+type editorWorkingCopy struct {
+	repo        *Repository
+	doer        *User
+	path        string
+	oldBranch   string
+	newBranch   string
+	oldCommitId string
+}
+
+func (repo *Repository) newEditorWorkingCopy(doer *User, oldBranch, newBranch, lastCommitId string) (_ *editorWorkingCopy, err error) {
+	if newBranch != oldBranch {
+		if !IsLegalReferenceName(newBranch) {
+			return nil, ErrReferenceNameIllegal
+		}
+	}
+
+	gitRepo, err := openRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	oldCommitId, err := gitRepo.GetCommitIdOfBranch(oldBranch)
+	if err != nil {
+		return nil, ErrBranchNotExist
+	}
+	if len(lastCommitId) > 0 && lastCommitId != oldCommitId {
+		return nil, ErrRepoFileOutdated
+	}
+
+	if newBranch != oldBranch {
+		if gitRepo.IsBranchExist(newBranch) {
+			return nil, ErrBranchAlreadyExist
+		}
+	}
+
+	// Commits of editor never rewrite history, so only whitelist needs to be checked.
+	pb, err := GetProtectBranchOfRepoByName(repo.Id, newBranch)
+	if err != nil {
+		if err != ErrProtectBranchNotExist {
+			return nil, fmt.Errorf("GetProtectBranchOfRepoByName: %v", err)
+		}
+	} else if !pb.CanUserPush(doer.Id) {
+		return nil, ErrBranchProtected{newBranch, PROTECT_REASON_NOT_ALLOWED}
+	}
+
+	wc := &editorWorkingCopy{
+		repo:        repo,
+		doer:        doer,
+		path:        filepath.Join(os.TempDir(), "gogs-editor", com.ToStr(time.Now().UnixNano())),
+		oldBranch:   oldBranch,
+		newBranch:   newBranch,
+		oldCommitId: oldCommitId,
+	}
+	os.MkdirAll(filepath.Dir(wc.path), os.ModePerm)
+
+	repoPath := RepoPath(repo.Owner.Name, repo.Name)
+	var stderr string
+	if _, stderr, err = process.ExecTimeout(5*time.Minute,
+		fmt.Sprintf("newEditorWorkingCopy(git clone): %s", repoPath),
+		"git", "clone", "-b", oldBranch, repoPath, wc.path); err != nil {
+		wc.Clean()
+		return nil, errors.New("git clone: " + stderr)
+	}
+
+	if newBranch != oldBranch {
+		if _, stderr, err = process.ExecDir(-1, wc.path,
+			fmt.Sprintf("newEditorWorkingCopy(git checkout): %s", wc.path),
+			"git", "checkout", "-b", newBranch); err != nil {
+			wc.Clean()
+			return nil, errors.New("git checkout: " + stderr)
+		}
+	}
+	return wc, nil
+}
+
+// Clean removes the working copy.
+func (wc *editorWorkingCopy) Clean() {
+	os.RemoveAll(wc.path)
+}
+
+// Commit commits all changes of the working copy, pushes them
+// to the repository and goes through normal update process.
+func (wc *editorWorkingCopy) Commit(message string) (err error) {
+	var stderr string
+	if _, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("editorWorkingCopy.Commit(git add): %s", wc.path),
+		"git", "add", "--all"); err != nil {
+		return errors.New("git add: " + stderr)
+	}
+
+	stdout, stderr, err := process.ExecDir(-1, wc.path,
+		fmt.Sprintf("editorWorkingCopy.Commit(git status): %s", wc.path),
+		"git", "status", "--porcelain")
+	if err != nil {
+		return errors.New("git status: " + stderr)
+	} else if len(strings.TrimSpace(stdout)) == 0 {
+		return ErrRepoFileNoChange
+	}
+
+	sig := wc.doer.NewGitSig()
+	if _, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("editorWorkingCopy.Commit(git commit): %s", wc.path),
+		"git", "-c", "user.name="+sig.Name, "-c", "user.email="+sig.Email,
+		"commit", fmt.Sprintf("--author=%s <%s>", sig.Name, sig.Email),
+		"-m", message); err != nil {
+		return errors.New("git commit: " + stderr)
+	}
+
+	stdout, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("editorWorkingCopy.Commit(git rev-parse): %s", wc.path),
+		"git", "rev-parse", "HEAD")
+	if err != nil {
+		return errors.New("git rev-parse: " + stderr)
+	}
+	newCommitId := strings.TrimSpace(stdout)
+
+	// Push is rejected by Git if the branch has been updated by others in the meantime.
+	if _, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("editorWorkingCopy.Commit(git push): %s", wc.path),
+		"git", "push", "origin", wc.newBranch); err != nil {
+		if strings.Contains(stderr, "non-fast-forward") || strings.Contains(stderr, "fetch first") {
+			return ErrRepoFileOutdated
+		}
+		return errors.New("git push: " + stderr)
+	}
+
+	oldCommitId := wc.oldCommitId
+	if wc.newBranch != wc.oldBranch {
+		oldCommitId = EMPTY_SHA
+	}
+	return Update("refs/heads/"+wc.newBranch, oldCommitId, newCommitId,
+		wc.doer.Name, wc.repo.Owner.Name, wc.repo.Name, wc.doer.Id)
+}
+
+// UpdateRepoFileOptions contains options to create or edit a file of repository.
+type UpdateRepoFileOptions struct {
+	LastCommitId string
+	OldBranch    string
+	NewBranch    string
+	OldTreeName  string
+	NewTreeName  string
+	Message      string
+	Content      string
+	IsNewFile    bool
+}
+
+// UpdateRepoFile creates or edits, and renames if needed, a file of repository.
+func (repo *Repository) UpdateRepoFile(doer *User, opts UpdateRepoFileOptions) (err error) {
+	newTreeName := CleanTreePath(opts.NewTreeName)
+	if len(newTreeName) == 0 {
+		return ErrRepoFilePathIllegal
+	}
+	oldTreeName := CleanTreePath(opts.OldTreeName)
+	if !opts.IsNewFile && len(oldTreeName) == 0 {
+		return ErrRepoFilePathIllegal
+	}
+
+	wc, err := repo.newEditorWorkingCopy(doer, opts.OldBranch, opts.NewBranch, opts.LastCommitId)
+	if err != nil {
+		return err
+	}
+	defer wc.Clean()
+
+	if hasSymlinkInPath(wc.path, newTreeName) ||
+		(!opts.IsNewFile && hasSymlinkInPath(wc.path, oldTreeName)) {
+		return ErrRepoFilePathIllegal
+	}
+
+	oldFilePath := filepath.Join(wc.path, oldTreeName)
+	filePath := filepath.Join(wc.path, newTreeName)
+	if opts.IsNewFile || oldTreeName != newTreeName {
+		if com.IsExist(filePath) {
+			return ErrRepoFileAlreadyExist
+		}
+	}
+	if !opts.IsNewFile {
+		if !com.IsFile(oldFilePath) {
+			return ErrRepoFileNotExist
+		}
+		if oldTreeName != newTreeName {
+			if err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+				return ErrRepoFilePathIllegal
+			}
+			if err = os.Rename(oldFilePath, filePath); err != nil {
+				return fmt.Errorf("Rename: %v", err)
+			}
+		}
+	} else if err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return ErrRepoFilePathIllegal
+	}
+
+	if err = ioutil.WriteFile(filePath, []byte(opts.Content), 0666); err != nil {
+		return fmt.Errorf("WriteFile: %v", err)
+	}
+	return wc.Commit(opts.Message)
+}
+
+// DeleteRepoFileOptions contains options to delete a file of repository.
+type DeleteRepoFileOptions struct {
+	LastCommitId string
+	OldBranch    string
+	NewBranch    string
+	TreeName     string
+	Message      string
+}
+
+// DeleteRepoFile deletes a file of repository.
+func (repo *Repository) DeleteRepoFile(doer *User, opts DeleteRepoFileOptions) (err error) {
+	treeName := CleanTreePath(opts.TreeName)
+	if len(treeName) == 0 {
+		return ErrRepoFilePathIllegal
+	}
+
+	wc, err := repo.newEditorWorkingCopy(doer, opts.OldBranch, opts.NewBranch, opts.LastCommitId)
+	if err != nil {
+		return err
+	}
+	defer wc.Clean()
+
+	// Symbolic link itself can be deleted, but not a file behind a linked directory.
+	if hasSymlinkInPath(wc.path, path.Dir(treeName)) {
+		return ErrRepoFilePathIllegal
+	}
+	filePath := filepath.Join(wc.path, treeName)
+	if fi, err := os.Lstat(filePath); err != nil || fi.IsDir() {
+		return ErrRepoFileNotExist
+	}
+	if err = os.Remove(filePath); err != nil {
+		return fmt.Errorf("Remove: %v", err)
+	}
+	return wc.Commit(opts.Message)
+}
+
+// UploadRepoFileOptions contains options to upload files into a directory of repository.
+type UploadRepoFileOptions struct {
+	LastCommitId string
+	OldBranch    string
+	NewBranch    string
+	TreeName     string
+	Message      string
+	Files        []*multipart.FileHeader
+}
+
+func copyUploadFile(header *multipart.FileHeader, filePath string) error {
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, file)
+	return err
+}
+
+// UploadRepoFiles uploads files into a directory of repository,
+// existing files with same names are overwritten.
+func (repo *Repository) UploadRepoFiles(doer *User, opts UploadRepoFileOptions) (err error) {
+	// Empty tree name means root directory.
+	treeName := CleanTreePath(opts.TreeName)
+	if len(opts.TreeName) > 0 && len(treeName) == 0 {
+		return ErrRepoFilePathIllegal
+	}
+
+	wc, err := repo.newEditorWorkingCopy(doer, opts.OldBranch, opts.NewBranch, opts.LastCommitId)
+	if err != nil {
+		return err
+	}
+	defer wc.Clean()
+
+	if hasSymlinkInPath(wc.path, treeName) {
+		return ErrRepoFilePathIllegal
+	}
+	dirPath := filepath.Join(wc.path, treeName)
+	if com.IsFile(dirPath) {
+		return ErrRepoFilePathIllegal
+	} else if err = os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return ErrRepoFilePathIllegal
+	}
+
+	for _, header := range opts.Files {
+		name := path.Base(CleanTreePath(header.Filename))
+		if len(name) == 0 || name == "." {
+			return ErrRepoFilePathIllegal
+		}
+		if hasSymlinkInPath(wc.path, path.Join(treeName, name)) {
+			return ErrRepoFilePathIllegal
+		}
+		filePath := filepath.Join(dirPath, name)
+		if com.IsDir(filePath) {
+			return ErrRepoFileAlreadyExist
+		}
+		if err = copyUploadFile(header, filePath); err != nil {
+			return fmt.Errorf("copyUploadFile: %v", err)
+		}
+	}
+	return wc.Commit(opts.Message)
+}
@@ -0,0 +1,490 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/indexer"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+const (
+	CODE_SEARCH_MAX_LINES    = 3
+	CODE_SEARCH_MAX_LINE_LEN = 200
+)
+
+// CodeSearchLine represents a line of file that matches the keyword.
+type CodeSearchLine struct {
+	Num     int
+	Content string
+}
+
+// CodeSearchResult represents a file that matches the keyword.
+type CodeSearchResult struct {
+	Repo    *Repository
+	Path    string
+	Lines   []*CodeSearchLine
+	IsExact bool // Whether the keyword appears as a whole.
+}
+
+type codeSearchResults []*CodeSearchResult
+
+func (s codeSearchResults) Len() int           { return len(s) }
+func (s codeSearchResults) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s codeSearchResults) Less(i, j int) bool { return s[i].IsExact && !s[j].IsExact }
+
+// CodeSearchOptions represents options of code search.
+type CodeSearchOptions struct {
+	Keyword string
+	RepoId  int64 // Only search in the repository if it is not zero.
+	User    *User // User who searches, nil for anonymous.
+	Limit   int
+}
+
+type repoIndex struct {
+	lock    sync.Mutex
+	index   *indexer.Index
+	modTime time.Time
+}
+
+var (
+	repoIndexesLock sync.Mutex
+	repoIndexes     = make(map[int64]*repoIndex)
+
+	// repoIndexUpdateLock makes updates of indexes sequential within the process.
+	repoIndexUpdateLock sync.Mutex
+)
+
+func repoIndexPath(repoId int64) string {
+	return filepath.Join(setting.CodeIndexPath, com.ToStr(repoId)+".idx")
+}
+
+// getRepoIndex returns index of repository, or nil if it is not indexed yet.
+// Index is loaded again once its file is changed, which may be done by serv command.
+func getRepoIndex(repoId int64) (*repoIndex, error) {
+	fpath := repoIndexPath(repoId)
+	fi, err := os.Stat(fpath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	repoIndexesLock.Lock()
+	defer repoIndexesLock.Unlock()
+
+	if ri, ok := repoIndexes[repoId]; ok && ri.modTime.Equal(fi.ModTime()) {
+		return ri, nil
+	}
+	idx, err := indexer.Load(fpath)
+	if err != nil {
+		return nil, err
+	}
+	ri := &repoIndex{index: idx, modTime: fi.ModTime()}
+	repoIndexes[repoId] = ri
+	return ri, nil
+}
+
+// readIndexableBlob returns content of blob, or nil if it is too large or binary.
+func readIndexableBlob(gitRepo *git.Repository, id string) ([]byte, error) {
+	size, err := gitRepo.GetBlobSize(id)
+	if err != nil {
+		return nil, err
+	} else if size > setting.CodeIndexMaxFileSize*1024 {
+		return nil, nil
+	}
+
+	data, err := gitRepo.GetBlobContent(id)
+	if err != nil {
+		return nil, err
+	}
+	head := data
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	if bytes.IndexByte(head, 0) > -1 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// UpdateRepoIndex brings code search index of repository to the head of default branch,
+// only files that changed since last indexed commit are read again.
+func UpdateRepoIndex(repo *Repository) error {
+	if !setting.CodeIndexerEnabled {
+		return nil
+	}
+	if repo.Owner == nil {
+		if err := repo.GetOwner(); err != nil {
+			return fmt.Errorf("GetOwner: %v", err)
+		}
+	}
+
+	gitRepo, err := git.OpenRepository(RepoPath(repo.Owner.Name, repo.Name))
+	if err != nil {
+		return fmt.Errorf("OpenRepository: %v", err)
+	}
+	if !gitRepo.IsBranchExist(repo.DefaultBranch) {
+		return nil
+	}
+	commitId, err := gitRepo.GetCommitIdOfBranch(repo.DefaultBranch)
+	if err != nil {
+		return fmt.Errorf("GetCommitIdOfBranch: %v", err)
+	}
+
+	repoIndexUpdateLock.Lock()
+	defer repoIndexUpdateLock.Unlock()
+
+	// Index is loaded on its own so that searches in the shared copy are not disturbed.
+	fpath := repoIndexPath(repo.Id)
+	idx, err := indexer.Load(fpath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Code search index of repository(%d) is broken and will be rebuilt: %v", repo.Id, err)
+		}
+		idx = indexer.New()
+	}
+	if idx.CommitId == commitId {
+		return nil
+	}
+
+	var changes []*git.FileChange
+	if len(idx.CommitId) > 0 {
+		// Previous commit may be gone after a force push, so index is rebuilt in that case.
+		if changes, err = gitRepo.GetFileChanges(idx.CommitId, commitId); err != nil {
+			idx = indexer.New()
+		}
+	}
+	if len(idx.CommitId) == 0 {
+		files, err := gitRepo.ListFiles(commitId)
+		if err != nil {
+			return fmt.Errorf("ListFiles: %v", err)
+		}
+		changes = make([]*git.FileChange, len(files))
+		for i, f := range files {
+			changes[i] = &git.FileChange{Path: f.Path, BlobId: f.BlobId}
+		}
+	}
+
+	for _, change := range changes {
+		if len(change.BlobId) == 0 {
+			idx.Remove(change.Path)
+			continue
+		}
+		data, err := readIndexableBlob(gitRepo, change.BlobId)
+		if err != nil {
+			return fmt.Errorf("readIndexableBlob(%s): %v", change.Path, err)
+		} else if data == nil {
+			idx.Remove(change.Path)
+			continue
+		}
+		idx.Add(change.Path, change.BlobId, data)
+	}
+	idx.CommitId = commitId
+	return idx.Save(fpath)
+}
+
+// DeleteRepoIndex deletes code search index of repository.
+func DeleteRepoIndex(repoId int64) error {
+	repoIndexesLock.Lock()
+	delete(repoIndexes, repoId)
+	repoIndexesLock.Unlock()
+
+	if err := os.Remove(repoIndexPath(repoId)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+var (
+	allRepoIndexesLock    sync.Mutex
+	isUpdatingRepoIndexes bool
+)
+
+// UpdateRepoIndexInBackground is like UpdateRepoIndex but returns immediately
+// in web server. Other processes exit before a goroutine is done, so index is
+// updated before return there.
+func UpdateRepoIndexInBackground(repo *Repository) {
+	if !setting.CodeIndexerEnabled {
+		return
+	}
+
+	update := func() {
+		if err := UpdateRepoIndex(repo); err != nil {
+			log.Error(4, "UpdateRepoIndex(%d): %v", repo.Id, err)
+		}
+	}
+	if !IsWebServer {
+		update()
+		return
+	}
+	go update()
+}
+
+// UpdateAllRepoIndexes updates code search indexes of all repositories,
+// it catches up with pushes that were not indexed and repositories indexed before.
+func UpdateAllRepoIndexes() {
+	if !setting.CodeIndexerEnabled {
+		return
+	}
+
+	allRepoIndexesLock.Lock()
+	if isUpdatingRepoIndexes {
+		allRepoIndexesLock.Unlock()
+		return
+	}
+	isUpdatingRepoIndexes = true
+	allRepoIndexesLock.Unlock()
+
+	defer func() {
+		allRepoIndexesLock.Lock()
+		isUpdatingRepoIndexes = false
+		allRepoIndexesLock.Unlock()
+	}()
+
+	// Processes saving an index for an hour are long gone.
+	if err := indexer.RemoveTempFiles(setting.CodeIndexPath, time.Hour); err != nil {
+		log.Error(4, "RemoveTempFiles: %v", err)
+	}
+
+	repos := make([]*Repository, 0, 10)
+	if err := x.Find(&repos); err != nil {
+		log.Error(4, "UpdateAllRepoIndexes: %v", err)
+		return
+	}
+	for _, repo := range repos {
+		if repo.IsBare {
+			continue
+		}
+		if err := UpdateRepoIndex(repo); err != nil {
+			log.Error(4, "UpdateRepoIndex(%d): %v", repo.Id, err)
+		}
+	}
+}
+
+// canReadRepository returns true if user is allowed to read repository.
+func canReadRepository(u *User, repo *Repository) (bool, error) {
+	if !repo.IsPrivate {
+		return true, nil
+	} else if u == nil {
+		return false, nil
+	} else if u.IsAdmin || u.Id == repo.OwnerId {
+		return true, nil
+	}
+
+	if repo.Owner == nil {
+		if err := repo.GetOwner(); err != nil {
+			return false, err
+		}
+	}
+	return HasAccess(u.Name, repo.Owner.Name+"/"+repo.Name, READABLE)
+}
+
+// getReadableRepositories returns all repositories that user is allowed to read.
+func getReadableRepositories(u *User) ([]*Repository, error) {
+	repos := make([]*Repository, 0, 10)
+	if u != nil && u.IsAdmin {
+		if err := x.Find(&repos); err != nil {
+			return nil, err
+		}
+		return repos, nil
+	}
+
+	if err := x.Where("is_private=?", false).Find(&repos); err != nil {
+		return nil, err
+	} else if u == nil {
+		return repos, nil
+	}
+
+	accesses := make([]*Access, 0, 10)
+	if err := x.Where("user_name=?", strings.ToLower(u.Name)).Find(&accesses); err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool)
+	for _, a := range accesses {
+		infos := strings.SplitN(a.RepoName, "/", 2)
+		if len(infos) != 2 {
+			continue
+		}
+		owner, err := GetUserByName(infos[0])
+		if err == ErrUserNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		repo, err := GetRepositoryByName(owner.Id, infos[1])
+		if err == ErrRepoNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if repo.IsPrivate && !seen[repo.Id] {
+			seen[repo.Id] = true
+			repo.Owner = owner
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+// matchLines returns lines of content that match the keyword, lines that contain
+// the keyword as a whole come first, and whether there is any such line.
+func matchLines(content []byte, keyword string, words []string) ([]*CodeSearchLine, bool) {
+	exact := make([]*CodeSearchLine, 0, CODE_SEARCH_MAX_LINES)
+	partial := make([]*CodeSearchLine, 0, CODE_SEARCH_MAX_LINES)
+	for i, line := range strings.Split(string(content), "\n") {
+		lower := strings.ToLower(line)
+		var lines *[]*CodeSearchLine
+		if strings.Contains(lower, keyword) {
+			lines = &exact
+		} else {
+			for _, word := range words {
+				if strings.Contains(lower, word) {
+					lines = &partial
+					break
+				}
+			}
+		}
+		if lines == nil || len(*lines) >= CODE_SEARCH_MAX_LINES {
+			continue
+		}
+
+		line = strings.TrimRight(line, "\r")
+		if len(line) > CODE_SEARCH_MAX_LINE_LEN {
+			line = line[:CODE_SEARCH_MAX_LINE_LEN] + "..."
+		}
+		*lines = append(*lines, &CodeSearchLine{i + 1, line})
+		if len(exact) >= CODE_SEARCH_MAX_LINES {
+			break
+		}
+	}
+
+	isExact := len(exact) > 0
+	for _, line := range partial {
+		if len(exact) >= CODE_SEARCH_MAX_LINES {
+			break
+		}
+		exact = append(exact, line)
+	}
+	sort.Sort(codeSearchLines(exact))
+	return exact, isExact
+}
+
+type codeSearchLines []*CodeSearchLine
+
+func (s codeSearchLines) Len() int           { return len(s) }
+func (s codeSearchLines) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s codeSearchLines) Less(i, j int) bool { return s[i].Num < s[j].Num }
+
+// searchRepoCode returns files of repository that match the keyword.
+func searchRepoCode(repo *Repository, keyword string, words []string, limit int) ([]*CodeSearchResult, error) {
+	ri, err := getRepoIndex(repo.Id)
+	if err != nil {
+		return nil, fmt.Errorf("getRepoIndex: %v", err)
+	} else if ri == nil {
+		return nil, nil
+	}
+
+	ri.lock.Lock()
+	paths := ri.index.Search(keyword)
+	blobIds := make([]string, len(paths))
+	for i, p := range paths {
+		blobIds[i] = ri.index.Files[p].BlobId
+	}
+	ri.lock.Unlock()
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	if repo.Owner == nil {
+		if err = repo.GetOwner(); err != nil {
+			return nil, fmt.Errorf("GetOwner: %v", err)
+		}
+	}
+	gitRepo, err := git.OpenRepository(RepoPath(repo.Owner.Name, repo.Name))
+	if err != nil {
+		return nil, fmt.Errorf("OpenRepository: %v", err)
+	}
+
+	results := make([]*CodeSearchResult, 0, len(paths))
+	for i, p := range paths {
+		if len(results) >= limit {
+			break
+		}
+		data, err := gitRepo.GetBlobContent(blobIds[i])
+		if err == git.ErrNotExist {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("GetBlobContent(%s): %v", p, err)
+		}
+		lines, isExact := matchLines(data, keyword, words)
+		results = append(results, &CodeSearchResult{
+			Repo:    repo,
+			Path:    p,
+			Lines:   lines,
+			IsExact: isExact,
+		})
+	}
+	return results, nil
+}
+
+// SearchCode searches indexed code of repositories that user is allowed to read,
+// files that contain the keyword as a whole come first.
+func SearchCode(opt *CodeSearchOptions) ([]*CodeSearchResult, error) {
+	keyword := strings.ToLower(strings.TrimSpace(opt.Keyword))
+	words := indexer.Tokenize(keyword)
+	if !setting.CodeIndexerEnabled || len(words) == 0 {
+		return []*CodeSearchResult{}, nil
+	}
+	if opt.Limit <= 0 {
+		opt.Limit = 10
+	}
+
+	var repos []*Repository
+	if opt.RepoId > 0 {
+		repo, err := GetRepositoryById(opt.RepoId)
+		if err != nil {
+			return nil, err
+		}
+		has, err := canReadRepository(opt.User, repo)
+		if err != nil {
+			return nil, err
+		} else if !has {
+			return []*CodeSearchResult{}, nil
+		}
+		repos = []*Repository{repo}
+	} else {
+		var err error
+		if repos, err = getReadableRepositories(opt.User); err != nil {
+			return nil, fmt.Errorf("getReadableRepositories: %v", err)
+		}
+	}
+
+	results := make([]*CodeSearchResult, 0, opt.Limit)
+	for _, repo := range repos {
+		if len(results) >= opt.Limit {
+			break
+		}
+		rs, err := searchRepoCode(repo, keyword, words, opt.Limit-len(results))
+		if err != nil {
+			return nil, fmt.Errorf("searchRepoCode(%d): %v", repo.Id, err)
+		}
+		results = append(results, rs...)
+	}
+	sort.Stable(codeSearchResults(results))
+	return results, nil
+}
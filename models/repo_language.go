@@ -0,0 +1,202 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/linguist"
+	"github.com/gogits/gogs/modules/log"
+)
+
+// RepoLanguage represents total size of files of a language in default branch of repository.
+type RepoLanguage struct {
+	Id            int64
+	RepoId        int64  `xorm:"UNIQUE(s) INDEX"`
+	Language      string `xorm:"UNIQUE(s)"`
+	LowerLanguage string `xorm:"INDEX"`
+	Size          int64
+	Updated       time.Time `xorm:"UPDATED"`
+
+	Percent float64 `xorm:"-"`
+}
+
+// Color returns color of language that is used in language bar.
+func (l *RepoLanguage) Color() string {
+	if lang := linguist.GetLanguage(l.Language); lang != nil {
+		return lang.Color
+	}
+	return "#ccc"
+}
+
+// GetRepoLanguages returns languages of repository from the largest one.
+func GetRepoLanguages(repoId int64) ([]*RepoLanguage, error) {
+	langs := make([]*RepoLanguage, 0, 5)
+	if err := x.Where("repo_id=?", repoId).Desc("size").Find(&langs); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, l := range langs {
+		total += l.Size
+	}
+	if total > 0 {
+		for _, l := range langs {
+			l.Percent = float64(l.Size) * 100 / float64(total)
+		}
+	}
+	return langs, nil
+}
+
+// languageStats walks tree recursively and adds sizes of files to languages they are written in.
+func languageStats(gitRepo *git.Repository, tree *git.Tree, treePath string, attrs []*linguist.Attribute, stats map[string]int64) error {
+	entries, err := tree.ListEntries(treePath)
+	if err != nil {
+		return err
+	}
+
+	for _, te := range entries {
+		entryPath := path.Join(treePath, te.Name())
+		switch {
+		case te.IsDir():
+			if linguist.IsVendoredWithAttributes(entryPath+"/", attrs) {
+				continue
+			}
+			subTree, err := gitRepo.GetTree(te.Id.String())
+			if err != nil {
+				return err
+			}
+			if err = languageStats(gitRepo, subTree, entryPath, attrs, stats); err != nil {
+				return err
+			}
+		case te.Type == git.BLOB && te.EntryMode() != git.ModeSymlink:
+			lang := linguist.DetectLanguage(entryPath)
+			if lang == nil || linguist.IsVendoredWithAttributes(entryPath, attrs) {
+				continue
+			}
+			stats[lang.Name] += te.Size()
+		}
+	}
+	return nil
+}
+
+// gitAttributes returns linguist attributes of ".gitattributes" file in root of commit.
+func gitAttributes(commit *git.Commit) []*linguist.Attribute {
+	blob, err := commit.GetBlobByPath(".gitattributes")
+	if err != nil {
+		return nil
+	}
+	rc, err := blob.Data()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil
+	}
+	return linguist.ParseAttributes(data)
+}
+
+// UpdateRepoLanguages computes language statistics of default branch of repository and saves them.
+func UpdateRepoLanguages(repo *Repository) error {
+	if repo.Owner == nil {
+		if err := repo.GetOwner(); err != nil {
+			return fmt.Errorf("GetOwner: %v", err)
+		}
+	}
+
+	gitRepo, err := git.OpenRepository(RepoPath(repo.Owner.Name, repo.Name))
+	if err != nil {
+		return fmt.Errorf("OpenRepository: %v", err)
+	}
+	if !gitRepo.IsBranchExist(repo.DefaultBranch) {
+		return nil
+	}
+	commit, err := gitRepo.GetCommitOfBranch(repo.DefaultBranch)
+	if err != nil {
+		return fmt.Errorf("GetCommitOfBranch: %v", err)
+	}
+
+	stats := make(map[string]int64)
+	if err = languageStats(gitRepo, &commit.Tree, "", gitAttributes(commit), stats); err != nil {
+		return fmt.Errorf("languageStats: %v", err)
+	}
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sess := x.NewSession()
+	defer sess.Close()
+	if err = sess.Begin(); err != nil {
+		return err
+	}
+
+	// Commit is recorded even if no language is detected, so statistics are not computed again.
+	repo.LanguagesCommitId = commit.Id.String()
+	if _, err = sess.Id(repo.Id).Cols("languages_commit_id").Update(repo); err != nil {
+		sess.Rollback()
+		return err
+	}
+	if _, err = sess.Delete(&RepoLanguage{RepoId: repo.Id}); err != nil {
+		sess.Rollback()
+		return err
+	}
+	for _, name := range names {
+		if _, err = sess.Insert(&RepoLanguage{
+			RepoId:        repo.Id,
+			Language:      name,
+			LowerLanguage: strings.ToLower(name),
+			Size:          stats[name],
+		}); err != nil {
+			sess.Rollback()
+			return err
+		}
+	}
+	return sess.Commit()
+}
+
+var (
+	repoLanguagesLock     sync.Mutex
+	repoLanguagesUpdating = make(map[int64]bool)
+)
+
+// UpdateRepoLanguagesInBackground is like UpdateRepoLanguages but returns immediately
+// in web server, so that pushes and page views do not wait for statistics to be computed.
+// Other processes exit before a goroutine is done, so statistics are computed before return there.
+func UpdateRepoLanguagesInBackground(repo *Repository) {
+	if !IsWebServer {
+		if err := UpdateRepoLanguages(repo); err != nil {
+			log.Error(4, "UpdateRepoLanguages(%d): %v", repo.Id, err)
+		}
+		return
+	}
+
+	repoLanguagesLock.Lock()
+	if repoLanguagesUpdating[repo.Id] {
+		repoLanguagesLock.Unlock()
+		return
+	}
+	repoLanguagesUpdating[repo.Id] = true
+	repoLanguagesLock.Unlock()
+
+	go func() {
+		if err := UpdateRepoLanguages(repo); err != nil {
+			log.Error(4, "UpdateRepoLanguages(%d): %v", repo.Id, err)
+		}
+
+		repoLanguagesLock.Lock()
+		delete(repoLanguagesUpdating, repo.Id)
+		repoLanguagesLock.Unlock()
+	}()
+}
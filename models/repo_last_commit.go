@@ -0,0 +1,124 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/macaron-contrib/cache"
+
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+// lastCommitCache keeps IDs of last commits of directory entries.
+// Commit never changes, so cached results never become stale.
+var lastCommitCache cache.Cache
+
+// NewLastCommitCache initializes last commit cache with configured cache adapter.
+func NewLastCommitCache() (err error) {
+	if setting.LastCommitCacheTTL <= 0 {
+		return nil
+	}
+
+	lastCommitCache, err = cache.NewCacher(setting.CacheAdapter, cache.Options{
+		Adapter:  setting.CacheAdapter,
+		Interval: setting.CacheInternal,
+		Conn:     setting.CacheConn,
+	})
+	return err
+}
+
+func lastCommitCacheKey(repoPath, commitId, treePath string) string {
+	return "last_commit_" + base.EncodeMd5(repoPath+":"+commitId+":"+treePath)
+}
+
+// getCachedLastCommits returns cached last commits of entries,
+// or nil if cache does not have all of them.
+func getCachedLastCommits(gitRepo *git.Repository, key string, entries git.Entries) map[string]*git.Commit {
+	val, ok := lastCommitCache.Get(key).(string)
+	if !ok {
+		return nil
+	}
+
+	ids := make(map[string]string)
+	if err := json.Unmarshal([]byte(val), &ids); err != nil {
+		return nil
+	}
+
+	commits := make(map[string]*git.Commit, len(entries))
+	for _, te := range entries {
+		id, ok := ids[te.Name()]
+		if !ok {
+			return nil
+		}
+		commit, err := gitRepo.GetCommit(id)
+		if err != nil {
+			return nil
+		}
+		commits[te.Name()] = commit
+	}
+	return commits
+}
+
+// GetLastCommitsOfEntries returns the last commits that changed given entries
+// of directory of commit, keyed by entry name.
+func GetLastCommitsOfEntries(gitRepo *git.Repository, commit *git.Commit, treePath string, entries git.Entries) (map[string]*git.Commit, error) {
+	if lastCommitCache == nil {
+		return commit.GetLastCommitsOfEntries(treePath, entries)
+	}
+
+	key := lastCommitCacheKey(gitRepo.Path, commit.Id.String(), treePath)
+	if commits := getCachedLastCommits(gitRepo, key, entries); commits != nil {
+		return commits, nil
+	}
+
+	commits, err := commit.GetLastCommitsOfEntries(treePath, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(commits))
+	for name, c := range commits {
+		ids[name] = c.Id.String()
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	if err = lastCommitCache.Put(key, string(data), int64(setting.LastCommitCacheTTL)); err != nil {
+		log.Error(4, "GetLastCommitsOfEntries(Put): %v", err)
+	}
+	return commits, nil
+}
+
+// fillLastCommitCache caches last commits of entries of root directory of
+// given commit, so the first visit of repository after push is fast.
+func fillLastCommitCache(repoPath, commitId string) {
+	if lastCommitCache == nil {
+		return
+	}
+
+	gitRepo, err := git.OpenRepository(repoPath)
+	if err != nil {
+		log.Error(4, "fillLastCommitCache(OpenRepository): %v", err)
+		return
+	}
+	commit, err := gitRepo.GetCommit(commitId)
+	if err != nil {
+		log.Error(4, "fillLastCommitCache(GetCommit): %v", err)
+		return
+	}
+	entries, err := commit.ListEntries("")
+	if err != nil {
+		log.Error(4, "fillLastCommitCache(ListEntries): %v", err)
+		return
+	}
+	if _, err = GetLastCommitsOfEntries(gitRepo, commit, "", entries); err != nil {
+		log.Error(4, "fillLastCommitCache(GetLastCommitsOfEntries): %v", err)
+	}
+}
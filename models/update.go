@@ -15,6 +15,14 @@ import (
 	"github.com/gogits/gogs/modules/log"
 )
 
+// Environment variables that are passed to update hook by serv and HTTP handler,
+// so that hook is able to know who is pushing to which repository.
+const (
+	ENV_AUTH_USER_ID    = "GOGS_AUTH_USER_ID"
+	ENV_REPO_OWNER_NAME = "GOGS_REPO_OWNER_NAME"
+	ENV_REPO_NAME       = "GOGS_REPO_NAME"
+)
+
 type UpdateTask struct {
 	Id          int64
 	Uuid        string `xorm:"index"`
@@ -61,6 +69,19 @@ func Update(refName, oldCommitId, newCommitId, userName, repoUserName, repoName
 	isDel := strings.HasPrefix(newCommitId, "0000000")
 	if isDel {
 		log.GitLogger.Info("del rev", refName, "from", userName+"/"+repoName+".git", "by", userId)
+
+		// Pull requests of deleted branch are marked as missing branch by their tests.
+		if strings.HasPrefix(refName, "refs/heads/") {
+			ru, err := GetUserByName(repoUserName)
+			if err != nil {
+				return fmt.Errorf("runUpdate.GetUserByName: %v", err)
+			}
+			repo, err := GetRepositoryByName(ru.Id, repoName)
+			if err != nil {
+				return fmt.Errorf("runUpdate.GetRepositoryByName userId: %v", err)
+			}
+			AddTestPullRequestTask(repo.Id, strings.TrimPrefix(refName, "refs/heads/"))
+		}
 		return nil
 	}
 
@@ -112,6 +133,19 @@ func Update(refName, oldCommitId, newCommitId, userName, repoUserName, repoName
 		return fmt.Errorf("runUpdate GetCommit of newCommitId: %v", err)
 	}
 
+	// Language statistics and code search index follow default branch.
+	if git.RefEndName(refName) == repos.DefaultBranch {
+		UpdateRepoLanguagesInBackground(repos)
+		UpdateRepoIndexInBackground(repos)
+	}
+
+	// Prepare tree listing of new commit in background for pushes over HTTP and
+	// built-in SSH server. Pushes through serv are prepared by the first visit,
+	// since serv has no access to cache of web server and exits right away.
+	if IsWebServer {
+		go fillLastCommitCache(f, newCommitId)
+	}
+
 	var l *list.List
 	// if a new branch
 	if isNew {
@@ -155,5 +189,10 @@ func Update(refName, oldCommitId, newCommitId, userName, repoUserName, repoName
 		repos.Id, repoUserName, repoName, refName, &base.PushCommits{l.Len(), commits}, oldCommitId, newCommitId); err != nil {
 		return fmt.Errorf("runUpdate.models.CommitRepoAction: %s/%s:%v", repoUserName, repoName, err)
 	}
+
+	// Recheck pull requests that are related to pushed branch.
+	if strings.HasPrefix(refName, "refs/heads/") {
+		AddTestPullRequestTask(repos.Id, strings.TrimPrefix(refName, "refs/heads/"))
+	}
 	return nil
 }
@@ -341,6 +341,7 @@ func ChangeUserName(u *User, newUserName string) (err error) {
 	}
 
 	// Change user directory name.
+	git.CloseCatFileProcesses("")
 	if err = os.Rename(UserPath(u.LowerName), UserPath(newUserName)); err != nil {
 		sess.Rollback()
 		return err
@@ -0,0 +1,349 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/process"
+)
+
+var (
+	ErrWikiPageAlreadyExist = errors.New("Wiki page already exist")
+	ErrWikiPageNotExist     = errors.New("Wiki page does not exist")
+	ErrWikiPageNameIllegal  = errors.New("Wiki page name is illegal")
+	ErrWikiOutdated         = errors.New("Wiki has been changed by others")
+)
+
+const (
+	// WIKI_BRANCH is the only branch of wiki repository that pages are read from.
+	WIKI_BRANCH = "master"
+	// WIKI_HOME_PAGE is the page that is shown at root of wiki.
+	WIKI_HOME_PAGE = "Home"
+	// WIKI_SIDEBAR_PAGE is the page that is shown next to other pages if exists.
+	WIKI_SIDEBAR_PAGE = "_Sidebar"
+)
+
+// Names of wiki pages that conflict with routes.
+var wikiReservedNames = []string{"_pages", "_new"}
+
+// WikiPath returns wiki repository path by given user and repository name.
+func WikiPath(userName, repoName string) string {
+	return filepath.Join(UserPath(userName), strings.ToLower(repoName)+".wiki.git")
+}
+
+// WikiPath returns path of wiki repository, owner must be loaded.
+func (repo *Repository) WikiPath() string {
+	return WikiPath(repo.Owner.Name, repo.Name)
+}
+
+// HasWiki returns true if wiki repository has been created.
+func (repo *Repository) HasWiki() bool {
+	return com.IsDir(repo.WikiPath())
+}
+
+// InitWiki creates an empty wiki repository if it does not exist.
+func (repo *Repository) InitWiki() error {
+	if repo.HasWiki() {
+		return nil
+	}
+
+	wikiPath := repo.WikiPath()
+	if _, stderr, err := process.Exec(fmt.Sprintf("InitWiki(git init): %s", wikiPath),
+		"git", "init", "--bare", wikiPath); err != nil {
+		return errors.New("git init: " + stderr)
+	}
+	if _, stderr, err := process.ExecDir(-1, wikiPath, fmt.Sprintf("InitWiki(git symbolic-ref): %s", wikiPath),
+		"git", "symbolic-ref", "HEAD", "refs/heads/"+WIKI_BRANCH); err != nil {
+		return errors.New("git symbolic-ref: " + stderr)
+	}
+	return nil
+}
+
+// ToWikiPageURL returns name of wiki page that is used in links and file names.
+func ToWikiPageURL(name string) string {
+	return strings.Replace(strings.TrimSpace(name), " ", "-", -1)
+}
+
+// ToWikiPageName returns name of wiki page to be displayed by given name in link.
+func ToWikiPageName(urlName string) string {
+	return strings.Replace(urlName, "-", " ", -1)
+}
+
+// WikiPageFileName returns name of file that stores content of wiki page.
+func WikiPageFileName(name string) string {
+	return ToWikiPageURL(name) + ".md"
+}
+
+// IsLegalWikiPageName returns false if name cannot be used as name of wiki page.
+func IsLegalWikiPageName(name string) bool {
+	urlName := ToWikiPageURL(name)
+	if len(urlName) == 0 || urlName[0] == '.' || strings.ContainsAny(urlName, "/\\?#%") {
+		return false
+	}
+	for _, reserved := range wikiReservedNames {
+		if strings.ToLower(urlName) == reserved {
+			return false
+		}
+	}
+	return true
+}
+
+// WikiPage represents a page of wiki.
+type WikiPage struct {
+	Name    string
+	URL     string
+	Updated time.Time // Only loaded by LoadWikiPagesUpdated.
+}
+
+type WikiPages []*WikiPage
+
+func (ps WikiPages) Len() int      { return len(ps) }
+func (ps WikiPages) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps WikiPages) Less(i, j int) bool {
+	return strings.ToLower(ps[i].Name) < strings.ToLower(ps[j].Name)
+}
+
+// OpenWikiRepository returns wiki repository and latest commit of it,
+// commit is nil if wiki does not exist or has no page yet.
+func (repo *Repository) OpenWikiRepository() (*git.Repository, *git.Commit, error) {
+	if !repo.HasWiki() {
+		return nil, nil, nil
+	}
+
+	wikiRepo, err := git.OpenRepository(repo.WikiPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("OpenRepository: %v", err)
+	}
+	if !wikiRepo.IsBranchExist(WIKI_BRANCH) {
+		return wikiRepo, nil, nil
+	}
+	commit, err := wikiRepo.GetCommitOfBranch(WIKI_BRANCH)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetCommitOfBranch: %v", err)
+	}
+	return wikiRepo, commit, nil
+}
+
+// GetWikiPages returns all pages of wiki at given commit, pages whose names
+// start with underscore such as sidebar are left out.
+func GetWikiPages(commit *git.Commit) ([]*WikiPage, error) {
+	entries, err := commit.ListEntries("")
+	if err != nil {
+		return nil, fmt.Errorf("ListEntries: %v", err)
+	}
+
+	pages := make(WikiPages, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
+			continue
+		}
+		urlName := strings.TrimSuffix(entry.Name(), ".md")
+		if len(urlName) == 0 || urlName[0] == '_' {
+			continue
+		}
+		pages = append(pages, &WikiPage{
+			Name: ToWikiPageName(urlName),
+			URL:  urlName,
+		})
+	}
+	sort.Sort(pages)
+	return pages, nil
+}
+
+// LoadWikiPagesUpdated loads time of last change of each page at given commit.
+func LoadWikiPagesUpdated(commit *git.Commit, pages []*WikiPage) error {
+	for _, page := range pages {
+		lastCommit, err := commit.GetCommitOfRelPath(page.URL + ".md")
+		if err != nil {
+			return fmt.Errorf("GetCommitOfRelPath(%s): %v", page.URL, err)
+		}
+		page.Updated = lastCommit.Author.When
+	}
+	return nil
+}
+
+// wikiWorkingCopy represents a temporary working copy
+// that is used to make changes to wiki from web.
+type wikiWorkingCopy struct {
+	repo *Repository
+	doer *User
+	path string
+}
+
+func (repo *Repository) newWikiWorkingCopy(doer *User, lastCommitId string) (_ *wikiWorkingCopy, err error) {
+	if err = repo.InitWiki(); err != nil {
+		return nil, fmt.Errorf("InitWiki: %v", err)
+	}
+
+	wikiPath := repo.WikiPath()
+	oldCommitId := ""
+	if git.IsBranchExist(wikiPath, WIKI_BRANCH) {
+		wikiRepo, err := git.OpenRepository(wikiPath)
+		if err != nil {
+			return nil, fmt.Errorf("OpenRepository: %v", err)
+		}
+		if oldCommitId, err = wikiRepo.GetCommitIdOfBranch(WIKI_BRANCH); err != nil {
+			return nil, fmt.Errorf("GetCommitIdOfBranch: %v", err)
+		}
+	}
+	if len(lastCommitId) > 0 && lastCommitId != oldCommitId {
+		return nil, ErrWikiOutdated
+	}
+
+	wc := &wikiWorkingCopy{
+		repo: repo,
+		doer: doer,
+		path: filepath.Join(os.TempDir(), "gogs-wiki", com.ToStr(time.Now().UnixNano())),
+	}
+	os.MkdirAll(filepath.Dir(wc.path), os.ModePerm)
+
+	// Cloning an empty wiki gives an empty working copy that the first page is committed to.
+	var stderr string
+	if _, stderr, err = process.ExecTimeout(5*time.Minute,
+		fmt.Sprintf("newWikiWorkingCopy(git clone): %s", wikiPath),
+		"git", "clone", wikiPath, wc.path); err != nil {
+		wc.Clean()
+		return nil, errors.New("git clone: " + stderr)
+	}
+	return wc, nil
+}
+
+// Clean removes the working copy.
+func (wc *wikiWorkingCopy) Clean() {
+	os.RemoveAll(wc.path)
+}
+
+// Commit commits all changes of the working copy and pushes them to wiki.
+func (wc *wikiWorkingCopy) Commit(message string) (err error) {
+	var stderr string
+	if _, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("wikiWorkingCopy.Commit(git add): %s", wc.path),
+		"git", "add", "--all"); err != nil {
+		return errors.New("git add: " + stderr)
+	}
+
+	stdout, stderr, err := process.ExecDir(-1, wc.path,
+		fmt.Sprintf("wikiWorkingCopy.Commit(git status): %s", wc.path),
+		"git", "status", "--porcelain")
+	if err != nil {
+		return errors.New("git status: " + stderr)
+	} else if len(strings.TrimSpace(stdout)) == 0 {
+		return ErrRepoFileNoChange
+	}
+
+	sig := wc.doer.NewGitSig()
+	if _, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("wikiWorkingCopy.Commit(git commit): %s", wc.path),
+		"git", "-c", "user.name="+sig.Name, "-c", "user.email="+sig.Email,
+		"commit", fmt.Sprintf("--author=%s <%s>", sig.Name, sig.Email),
+		"-m", message); err != nil {
+		return errors.New("git commit: " + stderr)
+	}
+
+	// Push is rejected by Git if the wiki has been updated by others in the meantime.
+	if _, stderr, err = process.ExecDir(-1, wc.path,
+		fmt.Sprintf("wikiWorkingCopy.Commit(git push): %s", wc.path),
+		"git", "push", "origin", "HEAD:refs/heads/"+WIKI_BRANCH); err != nil {
+		if strings.Contains(stderr, "non-fast-forward") || strings.Contains(stderr, "fetch first") {
+			return ErrWikiOutdated
+		}
+		return errors.New("git push: " + stderr)
+	}
+	return nil
+}
+
+// UpdateWikiPageOptions contains options to create or edit a wiki page.
+type UpdateWikiPageOptions struct {
+	LastCommitId string
+	OldName      string
+	NewName      string
+	Content      string
+	Message      string
+	IsNewPage    bool
+}
+
+// UpdateWikiPage creates or edits, and renames if needed, a wiki page.
+// Wiki repository is created when the first page is added.
+func (repo *Repository) UpdateWikiPage(doer *User, opts UpdateWikiPageOptions) (err error) {
+	if !IsLegalWikiPageName(opts.NewName) {
+		return ErrWikiPageNameIllegal
+	}
+	if !opts.IsNewPage && !IsLegalWikiPageName(opts.OldName) {
+		return ErrWikiPageNameIllegal
+	}
+
+	wc, err := repo.newWikiWorkingCopy(doer, opts.LastCommitId)
+	if err != nil {
+		return err
+	}
+	defer wc.Clean()
+
+	// Page files are committed by users and must not be written through symbolic links.
+	if hasSymlinkInPath(wc.path, WikiPageFileName(opts.NewName)) ||
+		(!opts.IsNewPage && hasSymlinkInPath(wc.path, WikiPageFileName(opts.OldName))) {
+		return ErrWikiPageNameIllegal
+	}
+
+	oldFilePath := filepath.Join(wc.path, WikiPageFileName(opts.OldName))
+	filePath := filepath.Join(wc.path, WikiPageFileName(opts.NewName))
+	if opts.IsNewPage || oldFilePath != filePath {
+		if com.IsExist(filePath) {
+			return ErrWikiPageAlreadyExist
+		}
+	}
+	if !opts.IsNewPage {
+		if !com.IsFile(oldFilePath) {
+			return ErrWikiPageNotExist
+		}
+		if oldFilePath != filePath {
+			if err = os.Rename(oldFilePath, filePath); err != nil {
+				return fmt.Errorf("Rename: %v", err)
+			}
+		}
+	}
+
+	if err = ioutil.WriteFile(filePath, []byte(opts.Content), 0666); err != nil {
+		return fmt.Errorf("WriteFile: %v", err)
+	}
+	return wc.Commit(opts.Message)
+}
+
+// DeleteWikiPage deletes a wiki page.
+func (repo *Repository) DeleteWikiPage(doer *User, name, message string) (err error) {
+	if !IsLegalWikiPageName(name) {
+		return ErrWikiPageNameIllegal
+	} else if !repo.HasWiki() {
+		return ErrWikiPageNotExist
+	}
+
+	wc, err := repo.newWikiWorkingCopy(doer, "")
+	if err != nil {
+		return err
+	}
+	defer wc.Clean()
+
+	if hasSymlinkInPath(wc.path, WikiPageFileName(name)) {
+		return ErrWikiPageNameIllegal
+	}
+	filePath := filepath.Join(wc.path, WikiPageFileName(name))
+	if !com.IsFile(filePath) {
+		return ErrWikiPageNotExist
+	}
+	if err = os.Remove(filePath); err != nil {
+		return fmt.Errorf("Remove: %v", err)
+	}
+	return wc.Commit(message)
+}
@@ -61,6 +61,66 @@ func (f *RepoSettingForm) Validate(ctx *macaron.Context, errs *binding.Errors, l
 	validate(errs, ctx.Data, f, l)
 }
 
+type CreateBranchForm struct {
+	BranchName string `form:"branch_name" binding:"Required;MaxSize(100)"`
+	StartPoint string `form:"start_point" binding:"Required"`
+}
+
+func (f *CreateBranchForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
+type ProtectBranchForm struct {
+	DisableForcePush bool   `form:"disable_force_push"`
+	DisableDeletion  bool   `form:"disable_deletion"`
+	EnableWhitelist  bool   `form:"enable_whitelist"`
+	WhitelistUsers   string `form:"whitelist_users"`
+	WhitelistTeams   string `form:"whitelist_teams"`
+}
+
+func (f *ProtectBranchForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
+type EditRepoFileForm struct {
+	TreeName      string `form:"tree_name" binding:"Required;MaxSize(500)"`
+	Content       string `form:"content"`
+	CommitSummary string `form:"commit_summary" binding:"MaxSize(100)"`
+	CommitMessage string `form:"commit_message"`
+	CommitChoice  string `form:"commit_choice" binding:"Required;MaxSize(50)"`
+	NewBranchName string `form:"new_branch_name" binding:"MaxSize(100)"`
+	LastCommitId  string `form:"last_commit"`
+}
+
+func (f *EditRepoFileForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
+type DeleteRepoFileForm struct {
+	CommitSummary string `form:"commit_summary" binding:"MaxSize(100)"`
+	CommitMessage string `form:"commit_message"`
+	CommitChoice  string `form:"commit_choice" binding:"Required;MaxSize(50)"`
+	NewBranchName string `form:"new_branch_name" binding:"MaxSize(100)"`
+	LastCommitId  string `form:"last_commit"`
+}
+
+func (f *DeleteRepoFileForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
+type UploadRepoFileForm struct {
+	TreeName      string `form:"tree_name" binding:"MaxSize(500)"`
+	CommitSummary string `form:"commit_summary" binding:"MaxSize(100)"`
+	CommitMessage string `form:"commit_message"`
+	CommitChoice  string `form:"commit_choice" binding:"Required;MaxSize(50)"`
+	NewBranchName string `form:"new_branch_name" binding:"MaxSize(100)"`
+	LastCommitId  string `form:"last_commit"`
+}
+
+func (f *UploadRepoFileForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
 //  __      __      ___.   .__    .__            __
 // /  \    /  \ ____\_ |__ |  |__ |  |__   ____ |  | __
 // \   \/\/   // __ \| __ \|  |  \|  |  \ /  _ \|  |/ /
@@ -113,6 +173,31 @@ func (f *CreateIssueForm) Validate(ctx *macaron.Context, errs *binding.Errors, l
 	validate(errs, ctx.Data, f, l)
 }
 
+type CreatePullRequestForm struct {
+	Title      string `form:"title" binding:"Required;MaxSize(50)"`
+	Content    string `form:"content"`
+	BaseBranch string `form:"base" binding:"Required"`
+	HeadRepo   string `form:"head_repo" binding:"Required"`
+	HeadBranch string `form:"head" binding:"Required"`
+}
+
+func (f *CreatePullRequestForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
+type CreateLineCommentForm struct {
+	BeforeCommitId string `form:"before"`
+	CommitId       string `form:"commit" binding:"Required"`
+	TreePath       string `form:"path" binding:"Required"`
+	Line           int64  `form:"line" binding:"Required"`
+	Content        string `form:"content" binding:"Required"`
+	RedirectTo     string `form:"redirect_to"`
+}
+
+func (f *CreateLineCommentForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
+
 //    _____  .__.__                   __
 //   /     \ |__|  |   ____   _______/  |_  ____   ____   ____
 //  /  \ /  \|  |  | _/ __ \ /  ___/\   __\/  _ \ /    \_/ __ \
@@ -177,3 +262,21 @@ type EditReleaseForm struct {
 func (f *EditReleaseForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
 	validate(errs, ctx.Data, f, l)
 }
+
+//  __      __.__ __   .__
+// /  \    /  \__|  | _|__|
+// \   \/\/   /  |  |/ /  |
+//  \        /|  |    <|  |
+//   \__/\  / |__|__|_ \__|
+//        \/          \/
+
+type NewWikiForm struct {
+	Title        string `form:"title" binding:"Required;MaxSize(100)"`
+	Content      string `form:"content" binding:"Required"`
+	Message      string `form:"message"`
+	LastCommitId string `form:"last_commit"`
+}
+
+func (f *NewWikiForm) Validate(ctx *macaron.Context, errs *binding.Errors, l i18n.Locale) {
+	validate(errs, ctx.Data, f, l)
+}
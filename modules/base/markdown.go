@@ -7,11 +7,13 @@ package base
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"net/http"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/gogits/gfm"
 )
@@ -36,11 +38,14 @@ func isLink(link []byte) bool {
 	return false
 }
 
+var MarkdownFileExtensions = []string{".md", ".markdown", ".mdown", ".mkd"}
+
 func IsMarkdownFile(name string) bool {
-	name = strings.ToLower(name)
-	switch filepath.Ext(name) {
-	case ".md", ".markdown", ".mdown", ".mkd":
-		return true
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, markdownExt := range MarkdownFileExtensions {
+		if ext == markdownExt {
+			return true
+		}
 	}
 	return false
 }
@@ -90,16 +95,96 @@ func (options *CustomRender) Link(out *bytes.Buffer, link []byte, title []byte,
 }
 
 var (
-	MentionPattern    = regexp.MustCompile(`@[0-9a-zA-Z_]{1,}`)
-	commitPattern     = regexp.MustCompile(`(\s|^)https?.*commit/[0-9a-zA-Z]+(#+[0-9a-zA-Z-]*)?`)
-	issueFullPattern  = regexp.MustCompile(`(\s|^)https?.*issues/[0-9]+(#+[0-9a-zA-Z-]*)?`)
-	issueIndexPattern = regexp.MustCompile(`#[0-9]+`)
+	MentionPattern   = regexp.MustCompile(`@[0-9a-zA-Z_]{1,}`)
+	commitPattern    = regexp.MustCompile(`(\s|^)https?.*commit/[0-9a-zA-Z]+(#+[0-9a-zA-Z-]*)?`)
+	issueFullPattern = regexp.MustCompile(`(\s|^)https?.*issues/[0-9]+(#+[0-9a-zA-Z-]*)?`)
+	// issueRefPattern matches "#12" and "owner/repo#12" that are not part of a word.
+	issueRefPattern = regexp.MustCompile(`(^|[\s(\[{,;:])(?:([0-9a-zA-Z_.-]+)/([0-9a-zA-Z_.-]+))?#([0-9]+)\b`)
+	shaPattern      = regexp.MustCompile(`(^|[\s(\[{,;:])([0-9a-f]{7,40})\b`)
+
+	taskItemPattern    = regexp.MustCompile(`^\s*(?:[-*+]|[0-9]+\.)\s+\[([ xX])\]\s`)
+	taskListPattern    = regexp.MustCompile(`<li>(\s*<p>)?\[([ xX])\]\s`)
+	headingPattern     = regexp.MustCompile(`(?s)<h([1-6])>(.*?)</h[1-6]>`)
+	htmlTagPattern     = regexp.MustCompile(`<[^>]*>`)
+	tocPlaceholder     = []byte("<p>[TOC]</p>")
+	codeBlockPrefix    = []byte("```")
+	inlineCodeBoundary = []byte("`")
 )
 
-func RenderSpecialLink(rawBytes []byte, urlPrefix string) []byte {
+// MarkdownOptions represents options of rendering Markdown.
+type MarkdownOptions struct {
+	// UrlPrefix is link of repository that issue references and commits belong to.
+	UrlPrefix string
+	// LinkPrefix is prefix of relative links, UrlPrefix is used when it is empty.
+	LinkPrefix string
+	// GetFullCommitId returns full id of commit of given abbreviated id, or empty string
+	// if there is no such commit. Commit ids in text are not linked when it is nil.
+	GetFullCommitId func(shortId string) string
+}
+
+// replaceRefs replaces matches of pattern with result of repl that receives submatches,
+// matches that are targets of Markdown links such as "[text](#12)" are left alone.
+func replaceRefs(src []byte, pattern *regexp.Regexp, repl func(sm [][]byte) []byte) []byte {
+	buf := new(bytes.Buffer)
+	last := 0
+	for _, loc := range pattern.FindAllSubmatchIndex(src, -1) {
+		buf.Write(src[last:loc[0]])
+		last = loc[1]
+		if loc[0] > 0 && src[loc[0]-1] == ']' && src[loc[0]] == '(' {
+			buf.Write(src[loc[0]:loc[1]])
+			continue
+		}
+
+		sm := make([][]byte, len(loc)/2)
+		for i := range sm {
+			if loc[2*i] >= 0 {
+				sm[i] = src[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		buf.Write(repl(sm))
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
+
+// renderLineLinks links mentions, issue references and commit ids in a line of text,
+// text in inline code is left alone.
+func renderLineLinks(line []byte, opts *MarkdownOptions) []byte {
+	parts := bytes.Split(line, inlineCodeBoundary)
+	for i := 0; i < len(parts); i += 2 {
+		part := parts[i]
+		ms := MentionPattern.FindAll(part, -1)
+		for _, m := range ms {
+			part = bytes.Replace(part, m,
+				[]byte(fmt.Sprintf(`<a href="/user/%s">%s</a>`, m[1:], m)), -1)
+		}
+
+		part = replaceRefs(part, issueRefPattern, func(sm [][]byte) []byte {
+			if len(sm[2]) > 0 {
+				return []byte(fmt.Sprintf(`%s<a href="/%s/%s/issues/%s">%s/%s#%s</a>`,
+					sm[1], sm[2], sm[3], sm[4], sm[2], sm[3], sm[4]))
+			}
+			return []byte(fmt.Sprintf(`%s<a href="%s/issues/%s">#%s</a>`, sm[1], opts.UrlPrefix, sm[4], sm[4]))
+		})
+
+		if opts.GetFullCommitId != nil {
+			part = replaceRefs(part, shaPattern, func(sm [][]byte) []byte {
+				id := opts.GetFullCommitId(string(sm[2]))
+				if len(id) == 0 {
+					return sm[0]
+				}
+				return []byte(fmt.Sprintf(`%s<code><a href="%s/commit/%s">%s</a></code>`,
+					sm[1], opts.UrlPrefix, id, ShortSha(id)))
+			})
+		}
+		parts[i] = part
+	}
+	return bytes.Join(parts, inlineCodeBoundary)
+}
+
+func renderSpecialLinks(rawBytes []byte, opts *MarkdownOptions) []byte {
 	buf := bytes.NewBufferString("")
 	inCodeBlock := false
-	codeBlockPrefix := []byte("```")
 	lineBreak := []byte("\n")
 	tab := []byte("\t")
 	lines := bytes.Split(rawBytes, lineBreak)
@@ -109,11 +194,7 @@ func RenderSpecialLink(rawBytes []byte, urlPrefix string) []byte {
 		}
 
 		if !inCodeBlock && !bytes.HasPrefix(line, tab) {
-			ms := MentionPattern.FindAll(line, -1)
-			for _, m := range ms {
-				line = bytes.Replace(line, m,
-					[]byte(fmt.Sprintf(`<a href="/user/%s">%s</a>`, m[1:], m)), -1)
-			}
+			line = renderLineLinks(line, opts)
 		}
 
 		buf.Write(line)
@@ -143,14 +224,112 @@ func RenderSpecialLink(rawBytes []byte, urlPrefix string) []byte {
 		rawBytes = bytes.Replace(rawBytes, m, []byte(fmt.Sprintf(
 			` <a href="%s">#%s</a>`, m, ShortSha(string(m[i+7:j])))), -1)
 	}
-	ms = issueIndexPattern.FindAll(rawBytes, -1)
-	for _, m := range ms {
-		rawBytes = bytes.Replace(rawBytes, m, []byte(fmt.Sprintf(
-			`<a href="%s/issues/%s">%s</a>`, urlPrefix, m[1:], m)), -1)
-	}
 	return rawBytes
 }
 
+func RenderSpecialLink(rawBytes []byte, urlPrefix string) []byte {
+	return renderSpecialLinks(rawBytes, &MarkdownOptions{UrlPrefix: urlPrefix})
+}
+
+// TaskCount returns numbers of completed and all tasks of task lists in Markdown.
+func TaskCount(content string) (done, total int) {
+	inCodeBlock := false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "```") {
+			inCodeBlock = !inCodeBlock
+		}
+		if inCodeBlock {
+			continue
+		}
+		if m := taskItemPattern.FindStringSubmatch(line); m != nil {
+			total++
+			if m[1] != " " {
+				done++
+			}
+		}
+	}
+	return done, total
+}
+
+// renderTaskLists turns list items that start with "[ ]" or "[x]" into checkboxes.
+func renderTaskLists(body []byte) []byte {
+	return taskListPattern.ReplaceAllFunc(body, func(m []byte) []byte {
+		sm := taskListPattern.FindSubmatch(m)
+		checked := ""
+		if sm[2][0] != ' ' {
+			checked = " checked"
+		}
+		return []byte(fmt.Sprintf(`<li class="task-list-item">%s<input type="checkbox"%s> `, sm[1], checked))
+	})
+}
+
+type markdownHeading struct {
+	level int
+	id    string
+	title string
+}
+
+// headingSlug returns lower-cased words of heading joined by dashes.
+func headingSlug(title string) string {
+	slug := make([]rune, 0, len(title))
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			slug = append(slug, r)
+		case unicode.IsSpace(r):
+			slug = append(slug, '-')
+		}
+	}
+	if len(slug) == 0 {
+		return "section"
+	}
+	return string(slug)
+}
+
+// renderHeadingAnchors gives headings stable ids with anchor links,
+// it returns headings in order for table of contents.
+func renderHeadingAnchors(body []byte) ([]byte, []*markdownHeading) {
+	headings := make([]*markdownHeading, 0, 10)
+	slugs := make(map[string]int)
+	body = headingPattern.ReplaceAllFunc(body, func(m []byte) []byte {
+		sm := headingPattern.FindSubmatch(m)
+		title := html.UnescapeString(string(htmlTagPattern.ReplaceAll(sm[2], nil)))
+
+		// Headings with same title are told apart by number suffix.
+		slug := headingSlug(title)
+		if n, ok := slugs[slug]; ok {
+			slugs[slug] = n + 1
+			slug = fmt.Sprintf("%s-%d", slug, n+1)
+		} else {
+			slugs[slug] = 0
+		}
+		id := USER_CONTENT_ID_PREFIX + slug
+
+		headings = append(headings, &markdownHeading{int(sm[1][0] - '0'), id, title})
+		return []byte(fmt.Sprintf(`<h%s id="%s"><a class="anchor" href="#%s"><span class="octicon octicon-link"></span></a>%s</h%s>`,
+			sm[1], id, id, sm[2], sm[1]))
+	})
+	return body, headings
+}
+
+// renderTOC replaces "[TOC]" paragraphs with list of headings.
+func renderTOC(body []byte, headings []*markdownHeading) []byte {
+	if !bytes.Contains(body, tocPlaceholder) {
+		return body
+	}
+
+	buf := bytes.NewBufferString(`<ul class="markdown-toc">`)
+	for _, h := range headings {
+		fmt.Fprintf(buf, `<li class="toc-level-%d"><a href="#%s">%s</a></li>`,
+			h.level, h.id, html.EscapeString(h.title))
+	}
+	buf.WriteString("</ul>")
+	if len(headings) == 0 {
+		buf.Reset()
+	}
+	return bytes.Replace(body, tocPlaceholder, buf.Bytes(), -1)
+}
+
 func RenderRawMarkdown(body []byte, urlPrefix string) []byte {
 	htmlFlags := 0
 	// htmlFlags |= gfm.HTML_USE_XHTML
@@ -183,10 +362,23 @@ func RenderRawMarkdown(body []byte, urlPrefix string) []byte {
 	return body
 }
 
+// RenderMarkdownWithOptions renders Markdown with special links, task lists,
+// heading anchors and table of contents, the result is sanitized.
+func RenderMarkdownWithOptions(rawBytes []byte, opts *MarkdownOptions) []byte {
+	body := renderSpecialLinks(rawBytes, opts)
+	linkPrefix := opts.LinkPrefix
+	if len(linkPrefix) == 0 {
+		linkPrefix = opts.UrlPrefix
+	}
+	body = RenderRawMarkdown(body, linkPrefix)
+	body = renderTaskLists(body)
+	body, headings := renderHeadingAnchors(body)
+	body = renderTOC(body, headings)
+	return Sanitize(body)
+}
+
 func RenderMarkdown(rawBytes []byte, urlPrefix string) []byte {
-	body := RenderSpecialLink(rawBytes, urlPrefix)
-	body = RenderRawMarkdown(body, urlPrefix)
-	return body
+	return RenderMarkdownWithOptions(rawBytes, &MarkdownOptions{UrlPrefix: urlPrefix})
 }
 
 func RenderMarkdownString(raw, urlPrefix string) string {
@@ -0,0 +1,282 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package base
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// Ids of elements in user content must have this prefix,
+// so that they do not clash with ids of page.
+const USER_CONTENT_ID_PREFIX = "user-content-"
+
+var (
+	// allowedTags maps tags that are kept to their allowed attributes.
+	allowedTags = map[string][]string{
+		"a": {"href", "name"}, "abbr": nil, "b": nil, "blockquote": nil, "br": nil,
+		"caption": nil, "code": nil, "col": {"span"}, "colgroup": {"span"}, "dd": nil,
+		"del": nil, "details": nil, "div": nil, "dl": nil, "dt": nil, "em": nil,
+		"figcaption": nil, "figure": nil, "h1": {"id"}, "h2": {"id"}, "h3": {"id"}, "h4": {"id"},
+		"h5": {"id"}, "h6": {"id"}, "hr": nil, "i": nil, "img": {"src", "alt", "width", "height"},
+		"input": {"type", "checked"}, "ins": nil, "kbd": nil, "li": {"value"}, "ol": {"start", "type"}, "p": nil,
+		"pre": nil, "q": nil, "s": nil, "samp": nil, "section": nil, "span": nil,
+		"strike": nil, "strong": nil, "sub": nil, "summary": nil, "sup": nil,
+		"table": nil, "tbody": nil, "td": {"colspan", "rowspan"}, "tfoot": nil,
+		"th": {"colspan", "rowspan"}, "thead": nil, "tr": nil, "tt": nil, "u": nil,
+		"ul": nil, "var": nil,
+	}
+	// globalAttrs are allowed for all tags that are kept.
+	globalAttrs = []string{"class", "title", "align", "lang", "dir"}
+	// Content of these tags is removed along with them.
+	droppedTags = map[string]bool{
+		"script": true, "style": true, "head": true, "title": true,
+		"iframe": true, "object": true, "embed": true, "textarea": true,
+	}
+	voidTags = map[string]bool{"br": true, "col": true, "hr": true, "img": true, "input": true}
+
+	allowedSchemes = []string{"http", "https", "mailto", "ftp"}
+)
+
+type htmlAttr struct {
+	name, value string
+}
+
+type htmlTag struct {
+	name        string
+	attrs       []htmlAttr
+	isClosing   bool
+	isSelfClose bool
+}
+
+func isTagNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// parseTag parses tag at beginning of data, it returns nil if data
+// does not start with a complete tag, and length of the tag.
+func parseTag(data []byte) (*htmlTag, int) {
+	i := 1
+	tag := new(htmlTag)
+	if i < len(data) && data[i] == '/' {
+		tag.isClosing = true
+		i++
+	}
+	start := i
+	for i < len(data) && isTagNameChar(data[i]) {
+		i++
+	}
+	if i == start || !(data[start] >= 'a' && data[start] <= 'z' || data[start] >= 'A' && data[start] <= 'Z') {
+		return nil, 0
+	}
+	tag.name = strings.ToLower(string(data[start:i]))
+
+	for i < len(data) {
+		switch {
+		case isSpace(data[i]):
+			i++
+			continue
+		case data[i] == '>':
+			return tag, i + 1
+		case data[i] == '/':
+			tag.isSelfClose = true
+			i++
+			continue
+		}
+
+		start = i
+		for i < len(data) && !isSpace(data[i]) && data[i] != '=' && data[i] != '>' && data[i] != '/' {
+			i++
+		}
+		attr := htmlAttr{name: strings.ToLower(string(data[start:i]))}
+		for i < len(data) && isSpace(data[i]) {
+			i++
+		}
+		if i < len(data) && data[i] == '=' {
+			i++
+			for i < len(data) && isSpace(data[i]) {
+				i++
+			}
+			if i < len(data) && (data[i] == '"' || data[i] == '\'') {
+				end := bytes.IndexByte(data[i+1:], data[i])
+				if end < 0 {
+					return nil, 0
+				}
+				attr.value = string(data[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				start = i
+				for i < len(data) && !isSpace(data[i]) && data[i] != '>' {
+					i++
+				}
+				attr.value = string(data[start:i])
+			}
+		}
+		tag.attrs = append(tag.attrs, attr)
+	}
+	return nil, 0
+}
+
+// isSafeURL returns true if URL is relative or uses an allowed scheme.
+func isSafeURL(link string) bool {
+	link = strings.ToLower(strings.TrimSpace(link))
+	colon := strings.IndexByte(link, ':')
+	if colon < 0 || strings.IndexAny(link[:colon], "/?#") > -1 {
+		return true
+	}
+	for _, scheme := range allowedSchemes {
+		if link[:colon] == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedTag(name string) bool {
+	_, ok := allowedTags[name]
+	return ok
+}
+
+func isCheckbox(tag *htmlTag) bool {
+	for _, attr := range tag.attrs {
+		if attr.name == "type" {
+			return strings.ToLower(attr.value) == "checkbox"
+		}
+	}
+	return false
+}
+
+func isAllowedAttr(tag, attr string) bool {
+	for _, name := range globalAttrs {
+		if name == attr {
+			return true
+		}
+	}
+	for _, name := range allowedTags[tag] {
+		if name == attr {
+			return true
+		}
+	}
+	return false
+}
+
+func writeOpenTag(buf *bytes.Buffer, tag *htmlTag) {
+	buf.WriteString("<" + tag.name)
+	for _, attr := range tag.attrs {
+		if !isAllowedAttr(tag.name, attr.name) {
+			continue
+		}
+		value := html.UnescapeString(attr.value)
+		if (attr.name == "href" || attr.name == "src") && !isSafeURL(value) {
+			continue
+		} else if attr.name == "id" && !strings.HasPrefix(value, USER_CONTENT_ID_PREFIX) {
+			continue
+		}
+		buf.WriteString(" " + attr.name + `="` + html.EscapeString(value) + `"`)
+	}
+	switch tag.name {
+	case "a":
+		buf.WriteString(` rel="nofollow"`)
+	case "input":
+		// Only checkboxes of task lists are kept, they can not be changed.
+		buf.WriteString(` disabled`)
+	}
+	buf.WriteByte('>')
+}
+
+// Sanitize removes tags and attributes of HTML that are not allowed,
+// and closes tags that are left open so that page layout is kept.
+func Sanitize(rawBytes []byte) []byte {
+	buf := new(bytes.Buffer)
+	opened := make([]string, 0, 10)
+	dropping := "" // Tag that content is being removed.
+
+	for i := 0; i < len(rawBytes); {
+		if rawBytes[i] != '<' {
+			end := bytes.IndexByte(rawBytes[i:], '<')
+			if end < 0 {
+				end = len(rawBytes) - i
+			}
+			if len(dropping) == 0 {
+				buf.Write(bytes.Replace(rawBytes[i:i+end], []byte(">"), []byte("&gt;"), -1))
+			}
+			i += end
+			continue
+		}
+
+		// Comments, doctypes and processing instructions are removed.
+		if bytes.HasPrefix(rawBytes[i:], []byte("<!--")) {
+			// "<!-->" and "<!--->" are empty comments.
+			if rest := rawBytes[i+4:]; bytes.HasPrefix(rest, []byte(">")) {
+				i += 5
+				continue
+			} else if bytes.HasPrefix(rest, []byte("->")) {
+				i += 6
+				continue
+			}
+			end := bytes.Index(rawBytes[i+4:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		} else if i+1 < len(rawBytes) && (rawBytes[i+1] == '!' || rawBytes[i+1] == '?') {
+			end := bytes.IndexByte(rawBytes[i:], '>')
+			if end < 0 {
+				break
+			}
+			i += end + 1
+			continue
+		}
+
+		tag, n := parseTag(rawBytes[i:])
+		if tag == nil {
+			if len(dropping) == 0 {
+				buf.WriteString("&lt;")
+			}
+			i++
+			continue
+		}
+		i += n
+
+		switch {
+		case len(dropping) > 0:
+			if tag.isClosing && tag.name == dropping {
+				dropping = ""
+			}
+		case droppedTags[tag.name]:
+			if !tag.isClosing && !tag.isSelfClose {
+				dropping = tag.name
+			}
+		case !isAllowedTag(tag.name), tag.name == "input" && !isCheckbox(tag):
+		case tag.isClosing:
+			// Only tags that are open are closed, inner ones are closed as well.
+			for j := len(opened) - 1; j >= 0; j-- {
+				if opened[j] == tag.name {
+					for k := len(opened) - 1; k >= j; k-- {
+						buf.WriteString("</" + opened[k] + ">")
+					}
+					opened = opened[:j]
+					break
+				}
+			}
+		default:
+			writeOpenTag(buf, tag)
+			if !voidTags[tag.name] && !tag.isSelfClose {
+				opened = append(opened, tag.name)
+			}
+		}
+	}
+
+	for j := len(opened) - 1; j >= 0; j-- {
+		buf.WriteString("</" + opened[j] + ">")
+	}
+	return buf.Bytes()
+}
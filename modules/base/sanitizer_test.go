@@ -0,0 +1,90 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package base
+
+import (
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		// Allowed tags and attributes.
+		{`<p class="x" onclick="alert(1)">a</p>`, `<p class="x">a</p>`},
+		{`<a href="https://gogs.io/">a</a>`, `<a href="https://gogs.io/" rel="nofollow">a</a>`},
+		{`<a href="/user/repo:x">a</a>`, `<a href="/user/repo:x" rel="nofollow">a</a>`},
+		{`<img src="/img.png" alt="a" style="x">`, `<img src="/img.png" alt="a">`},
+		{`<a title='"><script>alert(1)</script>'>a</a>`, `<a title="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;" rel="nofollow">a</a>`},
+		{`<blink>a</blink>`, `a`},
+
+		// Dangerous schemes, also when they are encoded or split.
+		{`<a href="javascript:alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href=" JavaScript:alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href=javascript:alert(1)>a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href="&#106;avascript:alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href="&#x6A;avascript&#x3A;alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href="javascript&colon;alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href="javascript&#0000058alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{"<a href=\"java\tscript:alert(1)\">a</a>", `<a rel="nofollow">a</a>`},
+		{`<a href="java&#9;script:alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<a href="java&#10;script:alert(1)">a</a>`, `<a rel="nofollow">a</a>`},
+		{`<img src="javascript:alert(1)">`, `<img>`},
+		{`<img src="data:text/html;base64,PHNjcmlwdD4=">`, `<img>`},
+
+		// Tags with unterminated quotes are not tags.
+		{`<a href="/x>a</a>`, `&lt;a href="/x&gt;a`},
+		{`<img src='/x alt=a>b`, `&lt;img src='/x alt=a&gt;b`},
+
+		// Content of dropped tags is removed, nested or broken ones do not escape.
+		{`<script>alert(1)</script>a`, `a`},
+		{`<SCRIPT>alert(1)</SCRIPT >a`, `a`},
+		{`<script><script>alert(1)</script>a</script>`, `a`},
+		{`<scr<script>ipt>alert(1)</script>`, `ipt&gt;alert(1)`},
+		{`<style><img src=x onerror=alert(1)></style>a`, `a`},
+		{`<script>alert(1)`, ``},
+
+		// Comments, doctypes and processing instructions.
+		{`a<!-- <script>alert(1)</script> -->b`, `ab`},
+		{`a<!-->b`, `ab`},
+		{`a<!--->b`, `ab`},
+		{`a<!-- b`, `a`},
+		{`<!DOCTYPE html>a`, `a`},
+		{`<!>a`, `a`},
+		{`a<! b`, `a`},
+		{`<?xml version="1.0"?>a`, `a`},
+
+		// Only checkboxes are allowed, and they are disabled.
+		{`<input type="checkbox" checked>`, `<input type="checkbox" checked="" disabled>`},
+		{`<input type="CHECKBOX">`, `<input type="CHECKBOX" disabled>`},
+		{`<input type="text" value="a">`, ``},
+		{`<input type="hidden" name="a">`, ``},
+		{`<input>`, ``},
+
+		// Ids must be prefixed.
+		{`<h1 id="user-content-a">a</h1>`, `<h1 id="user-content-a">a</h1>`},
+		{`<h1 id="a">a</h1>`, `<h1>a</h1>`},
+		{`<h2 id="content">a</h2>`, `<h2>a</h2>`},
+
+		// Stray brackets in text.
+		{`a < b > c`, `a &lt; b &gt; c`},
+		{`1<2`, `1&lt;2`},
+		{`a<`, `a&lt;`},
+		{`<<b>a</b>`, `&lt;<b>a</b>`},
+		{`a > b`, `a &gt; b`},
+		{`</>a`, `&lt;/&gt;a`},
+
+		// Tags are balanced.
+		{`<b><i>a`, `<b><i>a</i></b>`},
+		{`<b><i>a</b>b`, `<b><i>a</i></b>b`},
+		{`a</div>`, `a`},
+		{`<br/><hr>`, `<br><hr>`},
+	}
+	for _, test := range tests {
+		if actual := string(Sanitize([]byte(test.input))); actual != test.expected {
+			t.Errorf("Sanitize(%q): expected %q, got %q", test.input, test.expected, actual)
+		}
+	}
+}
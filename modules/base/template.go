@@ -125,10 +125,14 @@ func ActionIcon(opType int) string {
 		return "git-commit"
 	case 6: // Create issue.
 		return "issue-opened"
+	case 7: // Create pull request.
+		return "git-pull-request"
 	case 8: // Transfer repository.
 		return "share"
 	case 10: // Comment issue.
 		return "comment"
+	case 11: // Merge pull request.
+		return "git-merge"
 	default:
 		return "invalid type"
 	}
@@ -144,6 +148,10 @@ const (
 	TPL_TRANSFER_REPO = `<a href="/user/%s">%s</a> transfered repository <code>%s</code> to <a href="/%s">%s</a>`
 	TPL_PUSH_TAG      = `<a href="/user/%s">%s</a> pushed tag <a href="/%s/src/%s" rel="nofollow">%s</a> at <a href="/%s">%s</a>`
 	TPL_COMMENT_ISSUE = `<a href="/user/%s">%s</a> commented on issue <a href="/%s/issues/%s">%s#%s</a>
+<div><img src="%s?s=16" alt="user-avatar"/> %s</div>`
+	TPL_CREATE_PULL_REQUEST = `<a href="/user/%s">%s</a> opened pull request <a href="/%s/pulls/%s">%s#%s</a>
+<div><img src="%s?s=16" alt="user-avatar"/> %s</div>`
+	TPL_MERGE_PULL_REQUEST = `<a href="/user/%s">%s</a> merged pull request <a href="/%s/pulls/%s">%s#%s</a>
 <div><img src="%s?s=16" alt="user-avatar"/> %s</div>`
 )
 
@@ -199,6 +207,10 @@ func ActionDesc(act Actioner) string {
 		infos := strings.SplitN(content, "|", 2)
 		return fmt.Sprintf(TPL_CREATE_ISSUE, actUserName, actUserName, repoLink, infos[0], repoLink, infos[0],
 			AvatarLink(email), infos[1])
+	case 7: // Create pull request.
+		infos := strings.SplitN(content, "|", 2)
+		return fmt.Sprintf(TPL_CREATE_PULL_REQUEST, actUserName, actUserName, repoLink, infos[0], repoLink, infos[0],
+			AvatarLink(email), infos[1])
 	case 8: // Transfer repository.
 		newRepoLink := content + "/" + repoName
 		return fmt.Sprintf(TPL_TRANSFER_REPO, actUserName, actUserName, repoLink, newRepoLink, newRepoLink)
@@ -208,6 +220,10 @@ func ActionDesc(act Actioner) string {
 		infos := strings.SplitN(content, "|", 2)
 		return fmt.Sprintf(TPL_COMMENT_ISSUE, actUserName, actUserName, repoLink, infos[0], repoLink, infos[0],
 			AvatarLink(email), infos[1])
+	case 11: // Merge pull request.
+		infos := strings.SplitN(content, "|", 2)
+		return fmt.Sprintf(TPL_MERGE_PULL_REQUEST, actUserName, actUserName, repoLink, infos[0], repoLink, infos[0],
+			AvatarLink(email), infos[1])
 	default:
 		return "invalid type"
 	}
@@ -215,7 +231,7 @@ func ActionDesc(act Actioner) string {
 
 func DiffTypeToStr(diffType int) string {
 	diffTypes := map[int]string{
-		1: "add", 2: "modify", 3: "del",
+		1: "add", 2: "modify", 3: "del", 4: "rename", 5: "copy",
 	}
 	return diffTypes[diffType]
 }
@@ -16,6 +16,9 @@ var c = New()
 func NewCronContext() {
 	c.AddFunc("Update mirrors", "@every 1h", models.MirrorUpdate)
 	c.AddFunc("Deliver hooks", fmt.Sprintf("@every %dm", setting.WebhookTaskInterval), models.DeliverHooks)
+	c.AddFunc("Clean up repository archives", "@every 1h", models.DeleteOldRepositoryArchives)
+	c.AddFunc("Update code search indexes", "@every 24h", models.UpdateAllRepoIndexes)
+	c.AddFunc("Check pull requests", "@every 10m", models.CheckPullRequests)
 	c.Start()
 }
 
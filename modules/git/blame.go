@@ -0,0 +1,147 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogits/gogs/modules/process"
+)
+
+// BlameCommit represents a commit that lines of blame refer to.
+type BlameCommit struct {
+	Id        sha1
+	Author    *Signature
+	Committer *Signature
+	Summary   string
+	// Path of the file in the commit, it differs from current one if file was renamed.
+	Filename   string
+	IsBoundary bool
+}
+
+// BlamePart represents a range of consecutive lines of the file
+// that were last changed by the same commit.
+type BlamePart struct {
+	Commit    *BlameCommit
+	StartLine int // Line number of first line in the file, starts from 1.
+	Lines     []string
+}
+
+// EndLine returns line number of last line of the part.
+func (p *BlamePart) EndLine() int {
+	return p.StartLine + len(p.Lines) - 1
+}
+
+// parseBlameSignature sets fields of signature by given header key and value,
+// key is name of the header without "author" or "committer" prefix.
+func parseBlameSignature(sig *Signature, key, value string) {
+	switch key {
+	case "":
+		sig.Name = value
+	case "-mail":
+		sig.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+	case "-time":
+		seconds, _ := strconv.ParseInt(value, 10, 64)
+		sig.When = time.Unix(seconds, 0)
+	}
+}
+
+// ParseBlame parses output of "git blame --porcelain" into line ranges.
+func ParseBlame(data []byte) ([]*BlamePart, error) {
+	var (
+		commits = make(map[string]*BlameCommit)
+		parts   = make([]*BlamePart, 0, 10)
+		commit  *BlameCommit
+		curPart *BlamePart
+		curLine int
+	)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		// Content of the line.
+		if strings.HasPrefix(line, "\t") {
+			if commit == nil {
+				return nil, errors.New("blame: line content without header")
+			}
+			if curPart == nil || curPart.Commit != commit || curPart.EndLine()+1 != curLine {
+				curPart = &BlamePart{
+					Commit:    commit,
+					StartLine: curLine,
+				}
+				parts = append(parts, curPart)
+			}
+			curPart.Lines = append(curPart.Lines, line[1:])
+			continue
+		}
+
+		// Header of the line, which starts with commit ID.
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields[0]) == 40 && len(fields) == 2 {
+			nums := strings.Fields(fields[1])
+			if len(nums) < 2 {
+				return nil, fmt.Errorf("blame: invalid header line: %s", line)
+			}
+			var err error
+			if curLine, err = strconv.Atoi(nums[1]); err != nil {
+				return nil, fmt.Errorf("blame: invalid line number: %s", line)
+			}
+
+			var ok bool
+			if commit, ok = commits[fields[0]]; !ok {
+				id, err := NewIdFromString(fields[0])
+				if err != nil {
+					return nil, err
+				}
+				commit = &BlameCommit{
+					Id:        id,
+					Author:    new(Signature),
+					Committer: new(Signature),
+				}
+				commits[fields[0]] = commit
+			}
+			continue
+		}
+
+		// Information of the commit, which only appears the first time the commit is seen.
+		if commit == nil {
+			return nil, fmt.Errorf("blame: unexpected line: %s", line)
+		}
+		value := ""
+		if len(fields) == 2 {
+			value = fields[1]
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "author"):
+			parseBlameSignature(commit.Author, strings.TrimPrefix(fields[0], "author"), value)
+		case strings.HasPrefix(fields[0], "committer"):
+			parseBlameSignature(commit.Committer, strings.TrimPrefix(fields[0], "committer"), value)
+		case fields[0] == "summary":
+			commit.Summary = value
+		case fields[0] == "filename":
+			commit.Filename = value
+		case fields[0] == "boundary":
+			commit.IsBoundary = true
+		}
+	}
+	return parts, nil
+}
+
+// GetBlame returns blame of given file at given commit.
+func (repo *Repository) GetBlame(commitId, treePath string) ([]*BlamePart, error) {
+	stdout, stderr, err := process.ExecDir(-1, repo.Path,
+		fmt.Sprintf("GetBlame: %s", repo.Path),
+		"git", "blame", "--porcelain", commitId, "--", treePath)
+	if err != nil {
+		return nil, errors.New(stderr)
+	}
+	return ParseBlame([]byte(stdout))
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	blameCommit1 = "8552be36d33750c3dd6d892e898eefe3f4959799"
+	blameCommit2 = "c067e3bc05c4a62e7e9d1a6088e6baea9aef527a"
+)
+
+// Output of "git blame --porcelain" for a file that was renamed from "f" to "g",
+// the first commit is a boundary and its information only appears once.
+const blameOutput = blameCommit1 + " 1 1 2\n" +
+	"author Alice\n" +
+	"author-mail <alice@example.com>\n" +
+	"author-time 1420070405\n" +
+	"author-tz +0000\n" +
+	"committer Bob\n" +
+	"committer-mail <bob@example.com>\n" +
+	"committer-time 1420070406\n" +
+	"committer-tz +0000\n" +
+	"summary add f\n" +
+	"boundary\n" +
+	"filename f\n" +
+	"\tone\n" +
+	blameCommit1 + " 2 2\n" +
+	"\t\n" +
+	blameCommit2 + " 3 3 1\n" +
+	"author Alice\n" +
+	"author-mail <alice@example.com>\n" +
+	"author-time 1420070407\n" +
+	"author-tz +0000\n" +
+	"committer Alice\n" +
+	"committer-mail <alice@example.com>\n" +
+	"committer-time 1420070407\n" +
+	"committer-tz +0000\n" +
+	"summary rename and change\n" +
+	"previous " + blameCommit1 + " f\n" +
+	"filename g\n" +
+	"\tTWO\n" +
+	blameCommit1 + " 4 4 1\n" +
+	"\tthree\n" +
+	blameCommit2 + " 5 5 1\n" +
+	"\t\tfour\n"
+
+func TestParseBlame(t *testing.T) {
+	parts, err := ParseBlame([]byte(blameOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		commitId   string
+		startLine  int
+		lines      []string
+		endLine    int
+		summary    string
+		filename   string
+		isBoundary bool
+	}{
+		{blameCommit1, 1, []string{"one", ""}, 2, "add f", "f", true},
+		{blameCommit2, 3, []string{"TWO"}, 3, "rename and change", "g", false},
+		{blameCommit1, 4, []string{"three"}, 4, "add f", "f", true},
+		{blameCommit2, 5, []string{"\tfour"}, 5, "rename and change", "g", false},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("expected %d parts, got %d", len(expected), len(parts))
+	}
+	for i, e := range expected {
+		p := parts[i]
+		if p.Commit.Id.String() != e.commitId {
+			t.Errorf("part %d: expected commit %s, got %s", i, e.commitId, p.Commit.Id)
+		}
+		if p.StartLine != e.startLine || p.EndLine() != e.endLine {
+			t.Errorf("part %d: expected lines %d-%d, got %d-%d", i, e.startLine, e.endLine, p.StartLine, p.EndLine())
+		}
+		if !reflect.DeepEqual(p.Lines, e.lines) {
+			t.Errorf("part %d: expected content %q, got %q", i, e.lines, p.Lines)
+		}
+		if p.Commit.Summary != e.summary || p.Commit.Filename != e.filename || p.Commit.IsBoundary != e.isBoundary {
+			t.Errorf("part %d: unexpected commit information %+v", i, p.Commit)
+		}
+	}
+
+	// Parts of the same commit share its information.
+	if parts[0].Commit != parts[2].Commit {
+		t.Error("parts of the same commit have different commit objects")
+	}
+	c := parts[0].Commit
+	if c.Author.Name != "Alice" || c.Author.Email != "alice@example.com" || c.Author.When.Unix() != 1420070405 {
+		t.Errorf("unexpected author %+v", c.Author)
+	}
+	if c.Committer.Name != "Bob" || c.Committer.Email != "bob@example.com" || c.Committer.When.Unix() != 1420070406 {
+		t.Errorf("unexpected committer %+v", c.Committer)
+	}
+}
+
+func TestParseBlameInvalid(t *testing.T) {
+	for _, data := range []string{
+		"\tcontent without header\n",
+		"author Alice\n",
+		blameCommit1 + " 1\n\tone\n",
+		blameCommit1 + " 1 x 1\n\tone\n",
+		"zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz 1 1 1\n\tone\n",
+	} {
+		if _, err := ParseBlame([]byte(data)); err == nil {
+			t.Errorf("ParseBlame(%q): expected error", data)
+		}
+	}
+
+	parts, err := ParseBlame(nil)
+	if err != nil || len(parts) != 0 {
+		t.Errorf("ParseBlame(nil): expected no parts, got %d parts and error %v", len(parts), err)
+	}
+}
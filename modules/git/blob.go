@@ -7,9 +7,13 @@ package git
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/process"
 )
 
 type Blob struct {
@@ -24,3 +28,14 @@ func (b *Blob) Data() (io.Reader, error) {
 	}
 	return bytes.NewBuffer(stdout), nil
 }
+
+// DataPipeline writes content of blob to given writer as Git reads it,
+// so that large files are not held in memory.
+func (b *Blob) DataPipeline(w io.Writer) error {
+	stderr, err := process.ExecDirWriter(10*time.Minute, b.repo.Path, w,
+		fmt.Sprintf("Blob.DataPipeline: %s", b.Id), "git", "cat-file", "blob", b.Id.String())
+	if err != nil {
+		return fmt.Errorf("git cat-file blob: %v - %s", err, stderr)
+	}
+	return nil
+}
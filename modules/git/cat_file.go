@@ -0,0 +1,309 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogits/gogs/modules/process"
+)
+
+var (
+	// CatFileIdleTimeout is the duration that an idle "git cat-file" process
+	// is kept alive for later reads before it is stopped.
+	CatFileIdleTimeout = 5 * time.Minute
+	// CatFileMaxIdle is the maximum number of idle processes of each kind per repository.
+	CatFileMaxIdle = 4
+	// CatFileRequestTimeout is the duration that a single read may take
+	// before the process is killed.
+	CatFileRequestTimeout = time.Minute
+)
+
+// catFileProcess represents a long-lived "git cat-file --batch" or
+// "git cat-file --batch-check" process of a repository.
+type catFileProcess struct {
+	repoPath   string
+	isCheck    bool
+	generation int64
+	cmd        *exec.Cmd
+	pid        int64
+	stdin      io.WriteCloser
+	stdout     *bufio.Reader
+	lastUsed   time.Time
+}
+
+func newCatFileProcess(repoPath string, isCheck bool, generation int64) (*catFileProcess, error) {
+	mode := "--batch"
+	if isCheck {
+		mode = "--batch-check"
+	}
+	cmd := exec.Command("git", "cat-file", mode)
+	cmd.Dir = repoPath
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git cat-file %s: %v", mode, err)
+	}
+
+	return &catFileProcess{
+		repoPath:   repoPath,
+		isCheck:    isCheck,
+		generation: generation,
+		cmd:        cmd,
+		pid:        process.Add(fmt.Sprintf("git cat-file %s: %s", mode, repoPath), cmd),
+		stdin:      stdin,
+		stdout:     bufio.NewReader(stdout),
+	}, nil
+}
+
+// Close stops the process, Git exits once its standard input is closed.
+func (p *catFileProcess) Close() {
+	p.stdin.Close()
+	p.cmd.Wait()
+	process.Remove(p.pid)
+}
+
+// startTimer kills the process if current read does not finish in time,
+// so that reads fail instead of hanging. Caller must stop the timer.
+func (p *catFileProcess) startTimer() *time.Timer {
+	return time.AfterFunc(CatFileRequestTimeout, func() {
+		p.cmd.Process.Kill()
+	})
+}
+
+// request asks for given object and reads the header of response,
+// it returns full id, type and size of object.
+// The process is still usable when ErrNotExist is returned.
+func (p *catFileProcess) request(name string) (string, ObjectType, int64, error) {
+	timer := p.startTimer()
+	defer timer.Stop()
+
+	if _, err := io.WriteString(p.stdin, name+"\n"); err != nil {
+		return "", "", 0, err
+	}
+	line, err := p.stdout.ReadString('\n')
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// Response is "<id> <type> <size>", "<name> missing" or "<name> ambiguous".
+	fields := strings.Fields(line)
+	if len(fields) == 2 && (fields[1] == "missing" || fields[1] == "ambiguous") {
+		return "", "", 0, ErrNotExist
+	} else if len(fields) != 3 {
+		return "", "", 0, fmt.Errorf("git cat-file: unexpected response: %s", line)
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("git cat-file: invalid size: %s", line)
+	}
+	return fields[0], ObjectType(fields[1]), size, nil
+}
+
+// readContent reads content of object that follows the header of response.
+func (p *catFileProcess) readContent(size int64) ([]byte, error) {
+	timer := p.startTimer()
+	defer timer.Stop()
+
+	// Content is followed by a newline.
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(p.stdout, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+type catFileKey struct {
+	repoPath string
+	isCheck  bool
+}
+
+var (
+	catFileLock     sync.Mutex
+	catFileIdle     = make(map[catFileKey][]*catFileProcess)
+	catFileCleanJob sync.Once
+
+	// Generation is increased whenever processes are closed, processes that were
+	// started before repository was closed are not put back to pool.
+	catFileGeneration  int64
+	catFileClosedRepos = make(map[string]int64)
+	catFileClosedAll   int64
+)
+
+// isStale returns true if processes of repository have been closed after
+// the process was started, caller must hold catFileLock.
+func (p *catFileProcess) isStale() bool {
+	return p.generation < catFileClosedAll || p.generation < catFileClosedRepos[p.repoPath]
+}
+
+// getCatFileProcess returns an idle process of repository, or starts a new one.
+func getCatFileProcess(repoPath string, isCheck bool) (*catFileProcess, error) {
+	catFileCleanJob.Do(func() {
+		go cleanIdleCatFileProcesses()
+	})
+
+	key := catFileKey{repoPath, isCheck}
+	catFileLock.Lock()
+	if ps := catFileIdle[key]; len(ps) > 0 {
+		p := ps[len(ps)-1]
+		catFileIdle[key] = ps[:len(ps)-1]
+		catFileLock.Unlock()
+		return p, nil
+	}
+	generation := catFileGeneration
+	catFileLock.Unlock()
+
+	return newCatFileProcess(repoPath, isCheck, generation)
+}
+
+// putCatFileProcess puts the process back to pool for later reads.
+func putCatFileProcess(p *catFileProcess) {
+	p.lastUsed = time.Now()
+
+	key := catFileKey{p.repoPath, p.isCheck}
+	catFileLock.Lock()
+	if !p.isStale() && len(catFileIdle[key]) < CatFileMaxIdle {
+		catFileIdle[key] = append(catFileIdle[key], p)
+		p = nil
+	}
+	catFileLock.Unlock()
+
+	if p != nil {
+		p.Close()
+	}
+}
+
+// cleanIdleCatFileProcesses stops processes that have been idle for too long.
+func cleanIdleCatFileProcesses() {
+	for {
+		time.Sleep(time.Minute)
+
+		expired := make([]*catFileProcess, 0, 5)
+		catFileLock.Lock()
+		for key, ps := range catFileIdle {
+			alive := ps[:0]
+			for _, p := range ps {
+				if time.Since(p.lastUsed) > CatFileIdleTimeout {
+					expired = append(expired, p)
+				} else {
+					alive = append(alive, p)
+				}
+			}
+			if len(alive) == 0 {
+				delete(catFileIdle, key)
+			} else {
+				catFileIdle[key] = alive
+			}
+		}
+		catFileLock.Unlock()
+
+		for _, p := range expired {
+			p.Close()
+		}
+	}
+}
+
+// CloseCatFileProcesses stops idle "git cat-file" processes of given repository,
+// or of all repositories if path is empty, processes in use are stopped when
+// they are put back. It should be called before a repository is moved or deleted.
+func CloseCatFileProcesses(repoPath string) {
+	closed := make([]*catFileProcess, 0, 5)
+	catFileLock.Lock()
+	catFileGeneration++
+	if len(repoPath) == 0 {
+		catFileClosedAll = catFileGeneration
+	} else {
+		catFileClosedRepos[repoPath] = catFileGeneration
+	}
+	for key, ps := range catFileIdle {
+		if len(repoPath) == 0 || key.repoPath == repoPath {
+			closed = append(closed, ps...)
+			delete(catFileIdle, key)
+		}
+	}
+	catFileLock.Unlock()
+
+	for _, p := range closed {
+		p.Close()
+	}
+}
+
+// catFileObject returns type and content of given object.
+func (repo *Repository) catFileObject(id string) (ObjectType, []byte, error) {
+	p, err := getCatFileProcess(repo.Path, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, typ, size, err := p.request(id)
+	if err != nil {
+		if err == ErrNotExist {
+			putCatFileProcess(p)
+		} else {
+			p.Close()
+		}
+		return "", nil, err
+	}
+
+	data, err := p.readContent(size)
+	if err != nil {
+		p.Close()
+		return "", nil, err
+	}
+	putCatFileProcess(p)
+	return typ, data, nil
+}
+
+// catFileObjectInfo returns type and size of given object.
+func (repo *Repository) catFileObjectInfo(id string) (ObjectType, int64, error) {
+	p, err := getCatFileProcess(repo.Path, true)
+	if err != nil {
+		return "", 0, err
+	}
+
+	_, typ, size, err := p.request(id)
+	if err != nil && err != ErrNotExist {
+		p.Close()
+		return "", 0, err
+	}
+	putCatFileProcess(p)
+	return typ, size, err
+}
+
+// GetFullCommitId returns full id of commit that given abbreviated id refers to,
+// ErrNotExist is returned when there is no such commit or the abbreviation is ambiguous.
+func (repo *Repository) GetFullCommitId(shortId string) (string, error) {
+	p, err := getCatFileProcess(repo.Path, true)
+	if err != nil {
+		return "", err
+	}
+
+	id, typ, _, err := p.request(shortId)
+	if err != nil && err != ErrNotExist {
+		p.Close()
+		return "", err
+	}
+	putCatFileProcess(p)
+	if err != nil {
+		return "", err
+	} else if typ != COMMIT {
+		return "", ErrNotExist
+	}
+	return id, nil
+}
@@ -73,8 +73,14 @@ func (c *Commit) CommitsCount() (int, error) {
 	return c.repo.commitsCount(c.Id)
 }
 
-func (c *Commit) SearchCommits(keyword string) (*list.List, error) {
-	return c.repo.searchCommits(c.Id, keyword)
+// SearchCommits returns a page of commits in history that match options.
+func (c *Commit) SearchCommits(opts *SearchCommitsOptions, page int) (*list.List, error) {
+	return c.repo.searchCommits(c.Id, opts, page)
+}
+
+// SearchCommitsCount returns number of commits in history that match options.
+func (c *Commit) SearchCommitsCount(opts *SearchCommitsOptions) (int, error) {
+	return c.repo.searchCommitsCount(c.Id, opts)
 }
 
 func (c *Commit) CommitsByRange(page int) (*list.List, error) {
@@ -6,6 +6,7 @@ package git
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Unknwon/com"
 )
@@ -15,20 +16,74 @@ type ArchiveType int
 const (
 	ZIP ArchiveType = iota + 1
 	TARGZ
+	TAR
+	TARBZ2
+	TARXZ
 )
 
-func (c *Commit) CreateArchive(path string, archiveType ArchiveType) error {
-	var format string
-	switch archiveType {
+// ArchiveTypes contains all supported archive types.
+var ArchiveTypes = []ArchiveType{ZIP, TARGZ, TAR, TARBZ2, TARXZ}
+
+// String returns format name of archive type that "git archive" accepts.
+func (t ArchiveType) String() string {
+	switch t {
 	case ZIP:
-		format = "zip"
+		return "zip"
 	case TARGZ:
-		format = "tar.gz"
+		return "tar.gz"
+	case TAR:
+		return "tar"
+	case TARBZ2:
+		return "tar.bz2"
+	case TARXZ:
+		return "tar.xz"
+	}
+	return ""
+}
+
+// Ext returns file extension of archive type.
+func (t ArchiveType) Ext() string {
+	return "." + t.String()
+}
+
+// ParseArchiveName splits name into name without extension and archive type,
+// e.g. "v1.0.tar.gz" becomes "v1.0" and TARGZ.
+func ParseArchiveName(name string) (string, ArchiveType, bool) {
+	for _, t := range ArchiveTypes {
+		if strings.HasSuffix(name, t.Ext()) {
+			return strings.TrimSuffix(name, t.Ext()), t, true
+		}
+	}
+	return name, 0, false
+}
+
+func (c *Commit) CreateArchive(path string, archiveType ArchiveType) error {
+	return c.CreateTreeArchive(path, archiveType, "")
+}
+
+// CreateTreeArchive creates archive of given directory of commit,
+// empty tree path means the whole repository.
+func (c *Commit) CreateTreeArchive(path string, archiveType ArchiveType, treePath string) error {
+	args := make([]string, 0, 8)
+	switch archiveType {
+	case ZIP, TARGZ, TAR:
+	case TARBZ2:
+		// Git only compresses tar.gz by itself, other formats are
+		// piped through compressors that are configured as tar filters.
+		args = append(args, "-c", "tar.tar.bz2.command=bzip2 -c")
+	case TARXZ:
+		args = append(args, "-c", "tar.tar.xz.command=xz -c")
 	default:
 		return fmt.Errorf("unknown format: %v", archiveType)
 	}
 
-	_, stderr, err := com.ExecCmdDir(c.repo.Path, "git", "archive", "--format="+format, "-o", path, c.Id.String())
+	rev := c.Id.String()
+	if len(treePath) > 0 {
+		rev += ":" + treePath
+	}
+	args = append(args, "archive", "--format="+archiveType.String(), "-o", path, rev)
+
+	_, stderr, err := com.ExecCmdDir(c.repo.Path, "git", args...)
 	if err != nil {
 		return fmt.Errorf("%s", stderr)
 	}
@@ -0,0 +1,212 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Unknwon/com"
+)
+
+// GraphLine is a line of commit graph that goes from a column of a row
+// to a column of the next row.
+type GraphLine struct {
+	From  int
+	To    int
+	Color int
+}
+
+// GraphRow is a commit with its position in commit graph, lines of row
+// connect it and commits that are still expected to the next row.
+type GraphRow struct {
+	Commit *Commit
+	Column int
+	Color  int
+	Lines  []*GraphLine
+}
+
+// Graph represents a page of commit graph.
+type Graph struct {
+	Rows []*GraphRow
+	// Lines from the last row of previous page into the first row.
+	Incoming []*GraphLine
+	HasMore  bool
+}
+
+// graphLane is a column of graph that waits for given commit.
+type graphLane struct {
+	id    sha1
+	color int
+}
+
+func findGraphLane(lanes []*graphLane, id sha1) int {
+	for i, l := range lanes {
+		if l != nil && l.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func freeGraphLane(lanes []*graphLane) ([]*graphLane, int) {
+	for i, l := range lanes {
+		if l == nil {
+			return lanes, i
+		}
+	}
+	return append(lanes, nil), len(lanes)
+}
+
+// layoutGraph assigns columns to commits that are in topological order,
+// in the same way as "git log --graph" does.
+func layoutGraph(commits []*Commit) []*GraphRow {
+	rows := make([]*GraphRow, 0, len(commits))
+	lanes := make([]*graphLane, 0, 5)
+	nextColor := 0
+	var prev *GraphRow
+	for _, c := range commits {
+		// Branches that wait for this commit join into the leftmost one.
+		col := -1
+		for i, l := range lanes {
+			if l == nil || l.id != c.Id {
+				continue
+			}
+			if col < 0 {
+				col = i
+				continue
+			}
+			if prev != nil {
+				for _, line := range prev.Lines {
+					if line.To == i {
+						line.To = col
+					}
+				}
+			}
+			lanes[i] = nil
+		}
+
+		row := &GraphRow{Commit: c}
+		if col < 0 {
+			// Nothing expects this commit, it is a head of branch.
+			lanes, col = freeGraphLane(lanes)
+			row.Color = nextColor
+			nextColor++
+		} else {
+			row.Color = lanes[col].color
+		}
+		row.Column = col
+		lanes[col] = nil
+
+		// Lanes that just pass by this commit.
+		for i, l := range lanes {
+			if l != nil {
+				row.Lines = append(row.Lines, &GraphLine{i, i, l.color})
+			}
+		}
+
+		for n, pid := range c.parents {
+			to := findGraphLane(lanes, pid)
+			// First parent stays in the column unless a lane on the left waits for it,
+			// a lane on the right that waits for it joins when the parent is reached.
+			if n == 0 && (to < 0 || to > col) {
+				to = col
+				lanes[col] = &graphLane{pid, row.Color}
+			} else if to < 0 {
+				lanes, to = freeGraphLane(lanes)
+				lanes[to] = &graphLane{pid, nextColor}
+				nextColor++
+			}
+			row.Lines = append(row.Lines, &GraphLine{col, to, lanes[to].color})
+		}
+
+		for len(lanes) > 0 && lanes[len(lanes)-1] == nil {
+			lanes = lanes[:len(lanes)-1]
+		}
+		rows = append(rows, row)
+		prev = row
+	}
+	return rows
+}
+
+// MAX_GRAPH_COMMITS is the maximum number of commits that commit graph goes through,
+// because layout of every page has to walk all commits before it.
+const MAX_GRAPH_COMMITS = 5000
+
+// GetCommitGraph returns given page of commit graph of revisions,
+// all branches are included if no revision is given. Layout of a page
+// depends on all commits before it, so their parents are loaded as well.
+// Pages beyond MAX_GRAPH_COMMITS are empty.
+func (repo *Repository) GetCommitGraph(revs []string, page, pageSize int) (*Graph, error) {
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if start >= MAX_GRAPH_COMMITS {
+		return new(Graph), nil
+	}
+	end := start + pageSize
+	if end > MAX_GRAPH_COMMITS {
+		end = MAX_GRAPH_COMMITS
+	}
+
+	// One more commit tells if there is next page, and completes lines of the last row.
+	args := []string{"log", "--date-order", "--format=%H %P", "--max-count=" + com.ToStr(end+1)}
+	if len(revs) == 0 {
+		args = append(args, "--branches")
+	} else {
+		args = append(args, revs...)
+	}
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", append(args, "--")...)
+	if err != nil {
+		return nil, errors.New(stderr)
+	}
+
+	// Only commits of the page are loaded in full, others need just parents for layout.
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	commits := make([]*Commit, 0, len(lines))
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if i >= start && i < end {
+			c, err := repo.GetCommit(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			commits = append(commits, c)
+			continue
+		}
+
+		c := &Commit{parents: make([]sha1, 0, len(fields)-1)}
+		if c.Id, err = NewIdFromString(fields[0]); err != nil {
+			return nil, err
+		}
+		for _, pid := range fields[1:] {
+			id, err := NewIdFromString(pid)
+			if err != nil {
+				return nil, err
+			}
+			c.parents = append(c.parents, id)
+		}
+		commits = append(commits, c)
+	}
+
+	graph := new(Graph)
+	rows := layoutGraph(commits)
+	if len(rows) > end {
+		graph.HasMore = end < MAX_GRAPH_COMMITS
+		rows = rows[:end]
+	}
+	if start > len(rows) {
+		start = len(rows)
+	}
+	if start > 0 {
+		graph.Incoming = rows[start-1].Lines
+	}
+	graph.Rows = rows[start:]
+	return graph, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// graphCommit returns a commit that only has ID and parents,
+// IDs are made by repeating given character.
+func graphCommit(t *testing.T, id string, parents ...string) *Commit {
+	c := new(Commit)
+	var err error
+	if c.Id, err = NewIdFromString(strings.Repeat(id, 40)); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parents {
+		pid, err := NewIdFromString(strings.Repeat(p, 40))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.parents = append(c.parents, pid)
+	}
+	return c
+}
+
+// formatGraphRow formats row as "column/color: from->to/color ...".
+func formatGraphRow(row *GraphRow) string {
+	lines := make([]string, len(row.Lines))
+	for i, l := range row.Lines {
+		lines[i] = fmt.Sprintf("%d->%d/%d", l.From, l.To, l.Color)
+	}
+	return fmt.Sprintf("%d/%d: %s", row.Column, row.Color, strings.Join(lines, " "))
+}
+
+func TestLayoutGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		commits  [][]string // Commit ID followed by its parents, in date order.
+		expected []string
+	}{
+		{
+			"linear",
+			[][]string{{"a", "b"}, {"b", "c"}, {"c"}},
+			[]string{"0/0: 0->0/0", "0/0: 0->0/0", "0/0: "},
+		},
+		{
+			// *   a
+			// |\
+			// * | b
+			// | * c
+			// |/
+			// * d
+			"merge",
+			[][]string{{"a", "b", "c"}, {"b", "d"}, {"c", "d"}, {"d"}},
+			[]string{"0/0: 0->0/0 0->1/1", "0/0: 1->1/1 0->0/0", "1/1: 0->0/0 1->0/0", "0/0: "},
+		},
+		{
+			// * a
+			// | * b
+			// |/
+			// * c
+			// * d
+			"two heads",
+			[][]string{{"a", "c"}, {"b", "c"}, {"c", "d"}, {"d"}},
+			[]string{"0/0: 0->0/0", "1/1: 0->0/0 1->0/0", "0/0: 0->0/0", "0/0: "},
+		},
+		{
+			// *   a
+			// |\
+			// | * b
+			// * | c
+			// |/
+			// * d
+			// Lane of merged branch is freed and reused by a new head.
+			// * e
+			"merge then new head",
+			[][]string{{"a", "c", "b"}, {"b", "d"}, {"c", "d"}, {"d"}, {"e"}},
+			[]string{"0/0: 0->0/0 0->1/1", "1/1: 0->0/0 1->1/1", "0/0: 1->0/1 0->0/0", "0/0: ", "0/2: "},
+		},
+		{
+			// Parents that are not in the list keep their lanes.
+			"octopus",
+			[][]string{{"a", "b", "c", "d"}},
+			[]string{"0/0: 0->0/0 0->1/1 0->2/2"},
+		},
+	}
+
+	for _, test := range tests {
+		commits := make([]*Commit, len(test.commits))
+		for i, ids := range test.commits {
+			commits[i] = graphCommit(t, ids[0], ids[1:]...)
+		}
+
+		rows := layoutGraph(commits)
+		if len(rows) != len(test.expected) {
+			t.Errorf("%s: expected %d rows, got %d", test.name, len(test.expected), len(rows))
+			continue
+		}
+		for i, row := range rows {
+			if row.Commit != commits[i] {
+				t.Errorf("%s: row %d has commit %s", test.name, i, row.Commit.Id)
+			}
+			if actual := formatGraphRow(row); actual != test.expected[i] {
+				t.Errorf("%s: row %d: expected %q, got %q", test.name, i, test.expected[i], actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// GetLastCommitsOfEntries returns the last commits that changed given entries
+// of directory, keyed by entry name. Unlike calling GetCommitOfRelPath for each
+// entry, history is walked only once and the walk stops as soon as
+// all entries are resolved.
+func (c *Commit) GetLastCommitsOfEntries(treePath string, entries Entries) (map[string]*Commit, error) {
+	ids, err := c.repo.getLastCommitIdsOfEntries(c.Id, treePath, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make(map[string]*Commit, len(entries))
+	for _, te := range entries {
+		var commit *Commit
+		if id, ok := ids[te.Name()]; ok {
+			commit, err = c.repo.getCommit(id)
+		} else {
+			// Path was not found in simplified history, ask Git directly.
+			commit, err = c.repo.getCommitOfRelPath(c.Id, path.Join(treePath, te.Name()))
+		}
+		if err != nil {
+			return nil, err
+		}
+		commits[te.Name()] = commit
+	}
+	return commits, nil
+}
+
+// getLastCommitIdsOfEntries walks history of directory and records the first commit
+// that changed each of entries. Output of "git log -z -m --name-only" is a sequence of
+// NUL-terminated tokens, the format puts an empty token before every commit ID and
+// its parents. A merge commit is repeated for each of its parents, and like
+// "git log -- <entry>", it only counts as a change of entries that differ from
+// all parents. Changes discarded by a merge may still be reported.
+func (repo *Repository) getLastCommitIdsOfEntries(id sha1, treePath string, entries Entries) (map[string]sha1, error) {
+	remain := make(map[string]bool, len(entries))
+	for _, te := range entries {
+		remain[te.Name()] = true
+	}
+	ids := make(map[string]sha1, len(entries))
+	if len(remain) == 0 {
+		return ids, nil
+	}
+
+	args := []string{"log", "-z", "-m", "--name-only", "--format=%x00%H %P", id.String()}
+	prefix := ""
+	if len(treePath) > 0 {
+		prefix = strings.TrimSuffix(treePath, "/") + "/"
+		args = append(args, "--", prefix)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo.Path
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	// History does not have to be read to the end.
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	var (
+		current    sha1
+		numParents int
+		// Number of diffs against parents of current commit that contain each entry.
+		changes = make(map[string]int)
+	)
+	// record resolves entries that current commit changed against all of its parents.
+	record := func() {
+		for name, n := range changes {
+			if n >= numParents {
+				ids[name] = current
+				delete(remain, name)
+			}
+		}
+		changes = make(map[string]int)
+	}
+
+	rd := bufio.NewReader(stdout)
+	isCommitNext := false
+	// Names of current diff, an entry may have many changed files.
+	seen := make(map[string]bool)
+	for len(remain) > 0 {
+		token, err := rd.ReadString(0)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSuffix(token, "\x00")
+
+		if len(token) == 0 {
+			isCommitNext = true
+			continue
+		} else if isCommitNext {
+			isCommitNext = false
+			fields := strings.Fields(token)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("invalid commit line %q", token)
+			}
+			commitId, err := NewIdFromString(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid commit ID %q: %v", fields[0], err)
+			}
+			if commitId != current {
+				record()
+				current = commitId
+				numParents = len(fields) - 1
+				if numParents == 0 {
+					numParents = 1
+				}
+			}
+			seen = make(map[string]bool)
+			continue
+		}
+
+		// Names are relative to root of repository.
+		name := strings.TrimPrefix(strings.TrimPrefix(token, "\n"), prefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		if remain[name] && !seen[name] {
+			seen[name] = true
+			changes[name]++
+		}
+	}
+	record()
+	return ids, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit runs Git in dir with fixed identity and commit time, and returns its output.
+func runGit(t *testing.T, dir, date string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=gogs", "GIT_AUTHOR_EMAIL=gogs@localhost", "GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=gogs", "GIT_COMMITTER_EMAIL=gogs@localhost", "GIT_COMMITTER_DATE="+date)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v - %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	fpath := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newMergeRepository creates a repository whose commit "init" adds dir/a, dir/b,
+// dir/sub/c and top, then commit "master" changes dir/b and commit "side" changes
+// dir/a on another branch, and commit "merge" merges side into master.
+func newMergeRepository(t *testing.T) (string, map[string]string) {
+	dir, err := ioutil.TempDir("", "gogs-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const date = "2015-01-01T00:00:0"
+	runGit(t, dir, date+"0", "init", "-q")
+	writeFile(t, dir, "dir/a", "1")
+	writeFile(t, dir, "dir/b", "1")
+	writeFile(t, dir, "dir/sub/c", "1")
+	writeFile(t, dir, "top", "1")
+	runGit(t, dir, date+"1", "add", "-A")
+	runGit(t, dir, date+"1", "commit", "-q", "-m", "init")
+	runGit(t, dir, date+"1", "branch", "side")
+
+	writeFile(t, dir, "dir/b", "2")
+	runGit(t, dir, date+"2", "commit", "-q", "-a", "-m", "master")
+
+	runGit(t, dir, date+"3", "checkout", "-q", "side")
+	writeFile(t, dir, "dir/a", "2")
+	runGit(t, dir, date+"3", "commit", "-q", "-a", "-m", "side")
+
+	runGit(t, dir, date+"4", "checkout", "-q", "-")
+	runGit(t, dir, date+"4", "merge", "-q", "--no-ff", "-m", "merge", "side")
+
+	commits := make(map[string]string)
+	for _, line := range strings.Split(runGit(t, dir, date+"4", "log", "--format=%s %H"), "\n") {
+		fields := strings.Fields(line)
+		commits[fields[0]] = fields[1]
+	}
+	return dir, commits
+}
+
+func TestGetLastCommitIdsOfEntries(t *testing.T) {
+	dir, commits := newMergeRepository(t)
+	defer os.RemoveAll(dir)
+
+	repo, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := NewIdFromString(commits["merge"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		treePath string
+		expected map[string]string // Entry name to subject of its last commit.
+	}{
+		// Directory differs from both parents of merge, while each file
+		// only differs from one of them.
+		{"", map[string]string{"dir": "merge", "top": "init"}},
+		{"dir", map[string]string{"a": "side", "b": "master", "sub": "init"}},
+		{"dir/", map[string]string{"a": "side", "b": "master", "sub": "init"}},
+		{"dir/sub", map[string]string{"c": "init"}},
+	}
+	for _, test := range tests {
+		entries := make(Entries, 0, len(test.expected))
+		for name := range test.expected {
+			entries = append(entries, &TreeEntry{name: name})
+		}
+
+		ids, err := repo.getLastCommitIdsOfEntries(head, test.treePath, entries)
+		if err != nil {
+			t.Fatalf("%q: %v", test.treePath, err)
+		}
+		if len(ids) != len(test.expected) {
+			t.Errorf("%q: expected %d entries, got %d", test.treePath, len(test.expected), len(ids))
+		}
+		for name, subject := range test.expected {
+			if id, ok := ids[name]; !ok {
+				t.Errorf("%q: %s is not resolved", test.treePath, name)
+			} else if id.String() != commits[subject] {
+				t.Errorf("%q: expected last commit of %s to be %s, got %s", test.treePath, name, subject, id)
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/Unknwon/com"
@@ -36,3 +37,38 @@ func (repo *Repository) GetBranches() ([]string, error) {
 	}
 	return branches, nil
 }
+
+// CreateBranch creates a new branch that starts from given commit ID.
+func (repo *Repository) CreateBranch(branchName, commitId string) error {
+	_, stderr, err := com.ExecCmdDir(repo.Path, "git", "branch", branchName, commitId)
+	if err != nil {
+		return errors.New(stderr)
+	}
+	return nil
+}
+
+// DeleteBranch deletes given branch even if it has not been merged.
+func (repo *Repository) DeleteBranch(branchName string) error {
+	_, stderr, err := com.ExecCmdDir(repo.Path, "git", "branch", "-D", branchName)
+	if err != nil {
+		return errors.New(stderr)
+	}
+	return nil
+}
+
+// GetAheadBehind returns the number of commits that head is ahead of
+// and behind base.
+func (repo *Repository) GetAheadBehind(base, head string) (ahead, behind int, err error) {
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", "rev-list",
+		"--left-right", "--count", base+"..."+head)
+	if err != nil {
+		return 0, 0, errors.New(stderr)
+	}
+	fields := strings.Fields(stdout)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("invalid output of rev-list: %s", stdout)
+	}
+	behind, _ = com.StrTo(fields[0]).Int()
+	ahead, _ = com.StrTo(fields[1]).Int()
+	return ahead, behind, nil
+}
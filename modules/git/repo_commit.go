@@ -8,8 +8,11 @@ import (
 	"bytes"
 	"container/list"
 	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Unknwon/com"
 )
@@ -26,6 +29,16 @@ func (repo *Repository) GetCommitIdOfBranch(branchName string) (string, error) {
 	return repo.getCommitIdOfRef("refs/heads/" + branchName)
 }
 
+// GetCommitIdOfRevision returns the commit ID that given revision resolves to,
+// revision can be a branch, a tag or a commit ID.
+func (repo *Repository) GetCommitIdOfRevision(rev string) (string, error) {
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return "", errors.New(stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
 // get branch's last commit or a special commit by id string
 func (repo *Repository) GetCommitOfBranch(branchName string) (*Commit, error) {
 	commitId, err := repo.GetCommitIdOfBranch(branchName)
@@ -110,9 +123,21 @@ func (repo *Repository) getCommit(id sha1) (*Commit, error) {
 		repo.commitCache = make(map[sha1]*Commit, 10)
 	}
 
-	data, bytErr, err := com.ExecCmdDirBytes(repo.Path, "git", "cat-file", "-p", id.String())
+	typ, data, err := repo.catFileObject(id.String())
 	if err != nil {
-		return nil, errors.New(err.Error() + ": " + string(bytErr))
+		return nil, err
+	}
+	switch typ {
+	case COMMIT:
+	case TAG:
+		// Annotated tag points to the commit.
+		tag, err := parseTagData(data)
+		if err != nil {
+			return nil, err
+		}
+		return repo.getCommit(tag.Object)
+	default:
+		return nil, fmt.Errorf("object %s is a %s, not a commit", id, typ)
 	}
 
 	commit, err := parseCommitData(data)
@@ -256,13 +281,91 @@ func (repo *Repository) getCommitsBefore(id sha1) (*list.List, error) {
 	return l, err
 }
 
-func (repo *Repository) searchCommits(id sha1, keyword string) (*list.List, error) {
-	stdout, stderr, err := com.ExecCmdDirBytes(repo.Path, "git", "log", id.String(), "-100",
-		"-i", "--grep="+keyword, prettyLogFormat)
+// SearchCommitsOptions represents filters of commit search, commits must match
+// all filters that are given. Matching is case-insensitive.
+type SearchCommitsOptions struct {
+	Keyword      string // Text that message contains.
+	MessageRegex string // Extended regular expression that message matches.
+	Author       string // Text that name or e-mail of author contains.
+	Committer    string // Text that name or e-mail of committer contains.
+	Since        time.Time
+	Until        time.Time
+	Path         string // File or directory that commits change.
+}
+
+// IsEmpty returns true if no filter is given.
+func (opts *SearchCommitsOptions) IsEmpty() bool {
+	return len(opts.Keyword) == 0 && len(opts.MessageRegex) == 0 &&
+		len(opts.Author) == 0 && len(opts.Committer) == 0 &&
+		opts.Since.IsZero() && opts.Until.IsZero() && len(opts.Path) == 0
+}
+
+// args returns arguments of git log and git rev-list for options,
+// plain text is quoted because all patterns are extended regular expressions.
+func (opts *SearchCommitsOptions) args() []string {
+	args := []string{"--regexp-ignore-case", "--extended-regexp", "--all-match"}
+	if len(opts.Keyword) > 0 {
+		args = append(args, "--grep="+regexp.QuoteMeta(opts.Keyword))
+	}
+	if len(opts.MessageRegex) > 0 {
+		args = append(args, "--grep="+opts.MessageRegex)
+	}
+	if len(opts.Author) > 0 {
+		args = append(args, "--author="+regexp.QuoteMeta(opts.Author))
+	}
+	if len(opts.Committer) > 0 {
+		args = append(args, "--committer="+regexp.QuoteMeta(opts.Committer))
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since="+opts.Since.Format("2006-01-02 15:04:05 -0700"))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, "--until="+opts.Until.Format("2006-01-02 15:04:05 -0700"))
+	}
+	return args
+}
+
+// ErrInvalidSearchPattern represents a pattern of commit search that Git fails to compile,
+// patterns are POSIX extended regular expressions so they are only validated by Git.
+type ErrInvalidSearchPattern struct {
+	Message string
+}
+
+func (err ErrInvalidSearchPattern) Error() string {
+	return err.Message
+}
+
+// searchError returns ErrInvalidSearchPattern if Git rejects a pattern of search.
+func searchError(stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if strings.HasPrefix(stderr, "fatal: command line, '") {
+		return ErrInvalidSearchPattern{strings.TrimPrefix(stderr, "fatal: command line, ")}
+	}
+	return errors.New(stderr)
+}
+
+func (repo *Repository) searchCommitsCount(id sha1, opts *SearchCommitsOptions) (int, error) {
+	args := append([]string{"rev-list", "--count"}, opts.args()...)
+	args = append(args, id.String())
+	if len(opts.Path) > 0 {
+		args = append(args, "--", opts.Path)
+	}
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", args...)
 	if err != nil {
-		return nil, err
-	} else if len(stderr) > 0 {
-		return nil, errors.New(string(stderr))
+		return 0, searchError(stderr)
+	}
+	return com.StrTo(strings.TrimSpace(stdout)).Int()
+}
+
+func (repo *Repository) searchCommits(id sha1, opts *SearchCommitsOptions, page int) (*list.List, error) {
+	args := append([]string{"log"}, opts.args()...)
+	args = append(args, id.String(), "--skip="+com.ToStr((page-1)*50), "--max-count=50", prettyLogFormat)
+	if len(opts.Path) > 0 {
+		args = append(args, "--", opts.Path)
+	}
+	stdout, stderr, err := com.ExecCmdDirBytes(repo.Path, "git", args...)
+	if err != nil {
+		return nil, searchError(string(stderr))
 	}
 	return parsePrettyFormatLog(repo, stdout)
 }
@@ -0,0 +1,96 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Unknwon/com"
+)
+
+// TreeFile represents a regular file in tree of a revision.
+type TreeFile struct {
+	Path   string
+	BlobId string
+}
+
+// ListFiles returns all regular files in tree of revision recursively,
+// symbolic links and submodules are left out.
+func (repo *Repository) ListFiles(rev string) ([]*TreeFile, error) {
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", "ls-tree", "-r", "-z", rev)
+	if err != nil {
+		return nil, errors.New(stderr)
+	}
+
+	files := make([]*TreeFile, 0, 50)
+	// Each entry is "<mode> <type> <id>\t<path>".
+	for _, entry := range strings.Split(stdout, "\x00") {
+		tab := strings.IndexByte(entry, '\t')
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(entry[:tab])
+		if len(fields) != 3 || (fields[0] != "100644" && fields[0] != "100755") {
+			continue
+		}
+		files = append(files, &TreeFile{entry[tab+1:], fields[2]})
+	}
+	return files, nil
+}
+
+// FileChange represents a regular file that was changed between two revisions,
+// BlobId is empty if file was deleted.
+type FileChange struct {
+	Path   string
+	BlobId string
+}
+
+// GetFileChanges returns files that were added, modified or deleted between two revisions.
+// A file that was turned into symbolic link or submodule is reported as deleted.
+func (repo *Repository) GetFileChanges(before, after string) ([]*FileChange, error) {
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", "diff-tree", "-r", "-z", "--no-renames", before, after)
+	if err != nil {
+		return nil, errors.New(stderr)
+	}
+
+	// Output is ":<old mode> <new mode> <old id> <new id> <status>\x00<path>\x00" for each file.
+	changes := make([]*FileChange, 0, 10)
+	fields := strings.Split(stdout, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		info := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(info) != 5 {
+			return nil, errors.New("invalid diff-tree output: " + fields[i])
+		}
+		change := &FileChange{Path: fields[i+1]}
+		if info[1] == "100644" || info[1] == "100755" {
+			change.BlobId = info[3]
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// GetBlobContent returns content of blob.
+func (repo *Repository) GetBlobContent(id string) ([]byte, error) {
+	typ, data, err := repo.catFileObject(id)
+	if err != nil {
+		return nil, err
+	} else if typ != BLOB {
+		return nil, ErrNotExist
+	}
+	return data, nil
+}
+
+// GetBlobSize returns size of blob without reading its content.
+func (repo *Repository) GetBlobSize(id string) (int64, error) {
+	typ, size, err := repo.catFileObjectInfo(id)
+	if err != nil {
+		return 0, err
+	} else if typ != BLOB {
+		return 0, ErrNotExist
+	}
+	return size, nil
+}
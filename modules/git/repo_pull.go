@@ -0,0 +1,78 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+)
+
+// PullRequestInfo represents needed information for a pull request.
+type PullRequestInfo struct {
+	MergeBase string
+	Commits   *list.List
+}
+
+// GetCommitIdOfRef returns the commit ID that given full reference name points to.
+func (repo *Repository) GetCommitIdOfRef(refpath string) (string, error) {
+	return repo.getCommitIdOfRef(refpath)
+}
+
+// GetMergeBase returns the best common ancestor of given two revisions.
+func (repo *Repository) GetMergeBase(base, head string) (string, error) {
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", "merge-base", base, head)
+	if err != nil {
+		return "", errors.New(stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// CommitsBetweenIds returns a list of commits that are reachable from last
+// but not from before, newest first.
+func (repo *Repository) CommitsBetweenIds(last, before string) (*list.List, error) {
+	stdout, stderr, err := com.ExecCmdDirBytes(repo.Path, "git", "log",
+		before+".."+last, prettyLogFormat)
+	if err != nil {
+		return nil, errors.New(string(stderr))
+	}
+	return parsePrettyFormatLog(repo, stdout)
+}
+
+// GetPullRequestInfo generates and returns pull request information
+// between base and head branches of repositories.
+// The repository is treated as head, and basePath is path of base repository.
+func (repo *Repository) GetPullRequestInfo(basePath, baseBranch, headBranch string) (_ *PullRequestInfo, err error) {
+	remoteBranch := baseBranch
+	if repo.Path != basePath {
+		// Add a temporary remote to fetch base branch.
+		tmpRemote := com.ToStr(time.Now().UnixNano())
+		if _, stderr, err := com.ExecCmdDir(repo.Path, "git", "remote", "add", tmpRemote, basePath); err != nil {
+			return nil, fmt.Errorf("git remote add: %s", stderr)
+		}
+		defer com.ExecCmdDir(repo.Path, "git", "remote", "remove", tmpRemote)
+
+		if _, stderr, err := com.ExecCmdDir(repo.Path, "git", "fetch", tmpRemote, baseBranch); err != nil {
+			return nil, fmt.Errorf("git fetch: %s", stderr)
+		}
+		remoteBranch = "remotes/" + tmpRemote + "/" + baseBranch
+	}
+
+	prInfo := new(PullRequestInfo)
+	prInfo.MergeBase, err = repo.GetMergeBase(remoteBranch, headBranch)
+	if err != nil {
+		return nil, fmt.Errorf("GetMergeBase: %v", err)
+	}
+
+	prInfo.Commits, err = repo.CommitsBetweenIds(headBranch, prInfo.MergeBase)
+	if err != nil {
+		return nil, fmt.Errorf("CommitsBetweenIds: %v", err)
+	}
+	return prInfo, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package git
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+)
+
+// CommitStat represents author and size of changes of a commit.
+type CommitStat struct {
+	Id          string
+	AuthorName  string
+	AuthorEmail string
+	When        time.Time // In time zone of author.
+	Additions   int
+	Deletions   int
+}
+
+// parseCommitStats parses output of "git log --numstat" with format
+// "%x00%H%x00%an%x00%ae%x00%ai", header of each commit starts with NUL.
+func parseCommitStats(data string) ([]*CommitStat, error) {
+	stats := make([]*CommitStat, 0, 50)
+	var stat *CommitStat
+	for _, line := range strings.Split(data, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == 0 {
+			fields := strings.Split(line[1:], "\x00")
+			if len(fields) != 4 {
+				return nil, errors.New("invalid commit header: " + line)
+			}
+			when, err := time.Parse("2006-01-02 15:04:05 -0700", fields[3])
+			if err != nil {
+				return nil, err
+			}
+			stat = &CommitStat{
+				Id:          fields[0],
+				AuthorName:  fields[1],
+				AuthorEmail: strings.ToLower(fields[2]),
+				When:        when,
+			}
+			stats = append(stats, stat)
+			continue
+		} else if stat == nil {
+			return nil, errors.New("numstat without commit: " + line)
+		}
+
+		// "<additions>\t<deletions>\t<path>", both are "-" for binary files.
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		additions, _ := strconv.Atoi(fields[0])
+		deletions, _ := strconv.Atoi(fields[1])
+		stat.Additions += additions
+		stat.Deletions += deletions
+	}
+	return stats, nil
+}
+
+// GetCommitStats returns statistics of commits that are reachable from revision
+// and authored after given time, zero time means all commits. Merge commits are
+// left out because their changes are already counted in merged commits.
+func (repo *Repository) GetCommitStats(rev string, since time.Time) ([]*CommitStat, error) {
+	args := []string{"log", "--numstat", "--no-merges", "--no-renames", "--format=%x00%H%x00%an%x00%ae%x00%ai"}
+	if !since.IsZero() {
+		args = append(args, "--since="+com.ToStr(since.Unix()))
+	}
+	args = append(args, rev, "--")
+
+	stdout, stderr, err := com.ExecCmdDir(repo.Path, "git", args...)
+	if err != nil {
+		return nil, errors.New(stderr)
+	}
+	return parseCommitStats(stdout)
+}
@@ -38,6 +38,15 @@ func (repo *Repository) CreateTag(tagName, idStr string) error {
 	return nil
 }
 
+// DeleteTag deletes given tag.
+func (repo *Repository) DeleteTag(tagName string) error {
+	_, stderr, err := com.ExecCmdDir(repo.Path, "git", "tag", "-d", tagName)
+	if err != nil {
+		return errors.New(stderr)
+	}
+	return nil
+}
+
 func (repo *Repository) getTag(id sha1) (*Tag, error) {
 	if repo.tagCache != nil {
 		if t, ok := repo.tagCache[id]; ok {
@@ -47,14 +56,13 @@ func (repo *Repository) getTag(id sha1) (*Tag, error) {
 		repo.tagCache = make(map[sha1]*Tag, 10)
 	}
 
-	// Get tag type.
-	tp, stderr, err := com.ExecCmdDir(repo.Path, "git", "cat-file", "-t", id.String())
+	typ, data, err := repo.catFileObject(id.String())
 	if err != nil {
-		return nil, errors.New(stderr)
+		return nil, err
 	}
 
 	// Tag is a commit.
-	if ObjectType(tp) == COMMIT {
+	if typ == COMMIT {
 		tag := &Tag{
 			Id:     id,
 			Object: id,
@@ -66,11 +74,6 @@ func (repo *Repository) getTag(id sha1) (*Tag, error) {
 	}
 
 	// Tag with message.
-	data, bytErr, err := com.ExecCmdDirBytes(repo.Path, "git", "cat-file", "-p", id.String())
-	if err != nil {
-		return nil, errors.New(string(bytErr))
-	}
-
 	tag, err := parseTagData(data)
 	if err != nil {
 		return nil, err
@@ -4,12 +4,6 @@
 
 package git
 
-import (
-	"fmt"
-
-	"github.com/Unknwon/com"
-)
-
 // Find the tree object in the repository.
 func (repo *Repository) GetTree(idStr string) (*Tree, error) {
 	id, err := NewIdFromString(idStr)
@@ -20,12 +14,20 @@ func (repo *Repository) GetTree(idStr string) (*Tree, error) {
 }
 
 func (repo *Repository) getTree(id sha1) (*Tree, error) {
-	treePath := filepathFromSHA1(repo.Path, id.String())
-	if !com.IsFile(treePath) {
-		_, _, err := com.ExecCmdDir(repo.Path, "git", "ls-tree", id.String())
+	typ, _, err := repo.catFileObjectInfo(id.String())
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case TREE:
+	case COMMIT:
+		commit, err := repo.getCommit(id)
 		if err != nil {
-			return nil, fmt.Errorf("repo.getTree: %v", ErrNotExist)
+			return nil, err
 		}
+		id = commit.Tree.Id
+	default:
+		return nil, ErrNotExist
 	}
 
 	return NewTree(repo, id), nil
@@ -8,8 +8,6 @@ import (
 	"bytes"
 	"errors"
 	"strings"
-
-	"github.com/Unknwon/com"
 )
 
 var (
@@ -28,18 +26,20 @@ type Tree struct {
 	entriesParsed bool
 }
 
-// Parse tree information from the (uncompressed) raw
-// data from the tree object.
+// Parse tree information from the raw data of tree object,
+// each entry is "<mode> <name>\x00<20 bytes of ID>".
 func parseTreeData(tree *Tree, data []byte) ([]*TreeEntry, error) {
 	entries := make([]*TreeEntry, 0, 10)
-	l := len(data)
-	pos := 0
-	for pos < l {
+	for pos := 0; pos < len(data); {
 		entry := new(TreeEntry)
 		entry.ptree = tree
-		step := 6
+
+		step := bytes.IndexByte(data[pos:], ' ')
+		if step < 0 {
+			return nil, errors.New("invalid tree entry: missing mode")
+		}
 		switch string(data[pos : pos+step]) {
-		case "100644":
+		case "100644", "100664":
 			entry.mode = ModeBlob
 			entry.Type = BLOB
 		case "100755":
@@ -51,25 +51,23 @@ func parseTreeData(tree *Tree, data []byte) ([]*TreeEntry, error) {
 		case "160000":
 			entry.mode = ModeCommit
 			entry.Type = COMMIT
-		case "040000":
+		case "40000":
 			entry.mode = ModeTree
 			entry.Type = TREE
 		default:
 			return nil, errors.New("unknown type: " + string(data[pos:pos+step]))
 		}
-		pos += step + 6 // Skip string type of entry type.
+		pos += step + 1
 
-		step = 40
-		id, err := NewIdFromString(string(data[pos : pos+step]))
-		if err != nil {
-			return nil, err
+		step = bytes.IndexByte(data[pos:], 0)
+		if step < 0 || pos+step+21 > len(data) {
+			return nil, errors.New("invalid tree entry: incomplete data")
 		}
-		entry.Id = id
-		pos += step + 1 // Skip half of sha1.
-
-		step = bytes.IndexByte(data[pos:], '\n')
 		entry.name = string(data[pos : pos+step])
 		pos += step + 1
+
+		copy(entry.Id[:], data[pos:pos+20])
+		pos += 20
 		entries = append(entries, entry)
 	}
 	return entries, nil
@@ -107,12 +105,13 @@ func (t *Tree) ListEntries(relpath string) (Entries, error) {
 	}
 	t.entriesParsed = true
 
-	stdout, _, err := com.ExecCmdDirBytes(t.repo.Path,
-		"git", "ls-tree", t.Id.String())
+	typ, data, err := t.repo.catFileObject(t.Id.String())
 	if err != nil {
 		return nil, err
+	} else if typ != TREE {
+		return nil, ErrNotExist
 	}
-	t.entries, err = parseTreeData(t, stdout)
+	t.entries, err = parseTreeData(t, data)
 	return t.entries, err
 }
 
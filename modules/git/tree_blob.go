@@ -5,7 +5,6 @@
 package git
 
 import (
-	"fmt"
 	"path"
 	"strings"
 )
@@ -42,7 +41,7 @@ func (t *Tree) GetTreeEntryByPath(relpath string) (*TreeEntry, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf("GetTreeEntryByPath: %v", ErrNotExist)
+	return nil, ErrNotExist
 }
 
 func (t *Tree) GetBlobByPath(rpath string) (*Blob, error) {
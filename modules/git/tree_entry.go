@@ -6,9 +6,6 @@ package git
 
 import (
 	"sort"
-	"strings"
-
-	"github.com/Unknwon/com"
 )
 
 type EntryMode int
@@ -51,13 +48,13 @@ func (te *TreeEntry) Size() int64 {
 		return te.size
 	}
 
-	stdout, _, err := com.ExecCmdDir(te.ptree.repo.Path, "git", "cat-file", "-s", te.Id.String())
+	_, size, err := te.ptree.repo.catFileObjectInfo(te.Id.String())
 	if err != nil {
 		return 0
 	}
 
 	te.sized = true
-	te.size = com.StrTo(strings.TrimSpace(stdout)).MustInt64()
+	te.size = size
 	return te.size
 }
 
@@ -0,0 +1,231 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package indexer implements an inverted index of files of a repository
+// for full-text code search.
+package indexer
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	MIN_TOKEN_LEN = 2
+	MAX_TOKEN_LEN = 64
+
+	// TEMP_FILE_EXT is extension of files that indexes are written into before renamed.
+	TEMP_FILE_EXT = ".tmp"
+)
+
+// File represents an indexed file.
+type File struct {
+	BlobId string
+	Tokens []string
+}
+
+// Index maps tokens to paths of files that contain them.
+// It is not safe for concurrent modification.
+type Index struct {
+	CommitId string // Revision that files are indexed at.
+	Files    map[string]*File
+
+	tokens map[string]map[string]bool
+	sorted []string // Sorted tokens for prefix search, nil if out of date.
+}
+
+func New() *Index {
+	return &Index{
+		Files:  make(map[string]*File),
+		tokens: make(map[string]map[string]bool),
+	}
+}
+
+func isTokenRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Tokenize splits text into unique lower-cased words.
+func Tokenize(text string) []string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0, 50)
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isTokenRune(r) }) {
+		if len(word) < MIN_TOKEN_LEN || len(word) > MAX_TOKEN_LEN {
+			continue
+		}
+		word = strings.ToLower(word)
+		if !seen[word] {
+			seen[word] = true
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func (idx *Index) addTokens(path string, tokens []string) {
+	for _, token := range tokens {
+		paths, ok := idx.tokens[token]
+		if !ok {
+			paths = make(map[string]bool)
+			idx.tokens[token] = paths
+			idx.sorted = nil
+		}
+		paths[path] = true
+	}
+}
+
+// Add indexes content of file, previous content of same path is replaced.
+func (idx *Index) Add(path, blobId string, content []byte) {
+	idx.Remove(path)
+	f := &File{
+		BlobId: blobId,
+		Tokens: Tokenize(string(content)),
+	}
+	idx.Files[path] = f
+	idx.addTokens(path, f.Tokens)
+}
+
+// Remove removes file from index.
+func (idx *Index) Remove(path string) {
+	f, ok := idx.Files[path]
+	if !ok {
+		return
+	}
+	for _, token := range f.Tokens {
+		delete(idx.tokens[token], path)
+		if len(idx.tokens[token]) == 0 {
+			delete(idx.tokens, token)
+			idx.sorted = nil
+		}
+	}
+	delete(idx.Files, path)
+}
+
+// pathsWithPrefix returns paths of files that contain a token starting with prefix.
+func (idx *Index) pathsWithPrefix(prefix string) map[string]bool {
+	if idx.sorted == nil {
+		idx.sorted = make([]string, 0, len(idx.tokens))
+		for token := range idx.tokens {
+			idx.sorted = append(idx.sorted, token)
+		}
+		sort.Strings(idx.sorted)
+	}
+
+	paths := make(map[string]bool)
+	for i := sort.SearchStrings(idx.sorted, prefix); i < len(idx.sorted); i++ {
+		if !strings.HasPrefix(idx.sorted[i], prefix) {
+			break
+		}
+		for path := range idx.tokens[idx.sorted[i]] {
+			paths[path] = true
+		}
+	}
+	return paths
+}
+
+// Search returns sorted paths of files that contain all words of query,
+// words match beginnings of tokens.
+func (idx *Index) Search(query string) []string {
+	words := Tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var matched map[string]bool
+	for _, word := range words {
+		paths := idx.pathsWithPrefix(word)
+		if matched == nil {
+			matched = paths
+			continue
+		}
+		for path := range matched {
+			if !paths[path] {
+				delete(matched, path)
+			}
+		}
+	}
+
+	results := make([]string, 0, len(matched))
+	for path := range matched {
+		results = append(results, path)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// Save writes index into file, a temporary file is renamed to
+// the destination so that readers never see a partial index.
+func (idx *Index) Save(fpath string) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmpPath := fmt.Sprintf("%s.%d%s", fpath, time.Now().UnixNano(), TEMP_FILE_EXT)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, fpath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// RemoveTempFiles removes temporary files in directory that are left by processes
+// killed while saving indexes. Files newer than given age may still be written
+// by other processes, so they are kept.
+func RemoveTempFiles(dir string, age time.Duration) error {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), TEMP_FILE_EXT) ||
+			time.Since(fi.ModTime()) < age {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads index from file.
+func Load(fpath string) (*Index, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := New()
+	if err = gob.NewDecoder(f).Decode(idx); err != nil {
+		return nil, err
+	}
+	for path, file := range idx.Files {
+		idx.addTokens(path, file.Tokens)
+	}
+	return idx, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrHashMismatch = errors.New("Content hash does not match OID")
+	ErrSizeMismatch = errors.New("Content size does not match")
+)
+
+// ContentStore stores content of LFS objects in files named by their OIDs,
+// so that same content is only stored once for all repositories.
+type ContentStore struct {
+	BasePath string
+}
+
+func (s *ContentStore) path(oid string) string {
+	return filepath.Join(s.BasePath, oid[0:2], oid[2:4], oid[4:])
+}
+
+// Exists returns true if content of object is stored.
+func (s *ContentStore) Exists(p *Pointer) bool {
+	fi, err := os.Stat(s.path(p.Oid))
+	return err == nil && fi.Size() == p.Size
+}
+
+// Get opens content of object for reading.
+func (s *ContentStore) Get(p *Pointer) (*os.File, error) {
+	return os.Open(s.path(p.Oid))
+}
+
+// Put stores content of object that is read from r, content is verified
+// against the pointer before it becomes visible.
+func (s *ContentStore) Put(p *Pointer, r io.Reader) (err error) {
+	filePath := s.path(p.Oid)
+	dir := filepath.Dir(filePath)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if written != p.Size {
+		return ErrSizeMismatch
+	} else if hex.EncodeToString(hash.Sum(nil)) != p.Oid {
+		return ErrHashMismatch
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// Remove deletes content of object.
+func (s *ContentStore) Remove(oid string) error {
+	err := os.Remove(s.path(oid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
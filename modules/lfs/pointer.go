@@ -0,0 +1,68 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package lfs implements storage of Git LFS objects and parsing of pointer files.
+package lfs
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// POINTER_MAX_SIZE is the largest size of a pointer file, larger files are never pointers.
+	POINTER_MAX_SIZE = 1024
+
+	POINTER_VERSION = "https://git-lfs.github.com/spec/v1"
+)
+
+var oidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// IsValidOid returns true if oid is a SHA-256 hash in lower-case hexadecimal.
+func IsValidOid(oid string) bool {
+	return oidPattern.MatchString(oid)
+}
+
+// Pointer represents a pointer file that is committed in place of content of LFS object.
+type Pointer struct {
+	Oid  string
+	Size int64
+}
+
+// ReadPointer parses content of a pointer file, it returns nil if content is not a valid pointer.
+func ReadPointer(data []byte) *Pointer {
+	if len(data) > POINTER_MAX_SIZE || !bytes.HasPrefix(data, []byte("version "+POINTER_VERSION+"\n")) {
+		return nil
+	}
+
+	// Content is a list of "<key> <value>" lines sorted by key, version comes first.
+	p := new(Pointer)
+	hasSize := false
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[1:] {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil
+		}
+		switch fields[0] {
+		case "oid":
+			if !strings.HasPrefix(fields[1], "sha256:") {
+				return nil
+			}
+			p.Oid = strings.TrimPrefix(fields[1], "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil
+			}
+			p.Size = size
+			hasSize = true
+		}
+	}
+	if !IsValidOid(p.Oid) || !hasSize {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package lfs
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOid = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+func TestReadPointer(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected *Pointer
+	}{
+		// Valid pointers.
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid + "\nsize 12345\n",
+			&Pointer{testOid, 12345}},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid + "\nsize 0",
+			&Pointer{testOid, 0}},
+		{"version https://git-lfs.github.com/spec/v1\next-0-foo sha256:" + testOid + "\noid sha256:" + testOid + "\nsize 1\n",
+			&Pointer{testOid, 1}},
+
+		// Not pointers.
+		{"", nil},
+		{"hello world\n", nil},
+		{"version https://hawser.github.com/spec/v1\noid sha256:" + testOid + "\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\r\noid sha256:" + testOid + "\r\nsize 1\r\n", nil},
+		{"oid sha256:" + testOid + "\nversion https://git-lfs.github.com/spec/v1\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid + "\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid md5:" + testOid + "\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + strings.ToUpper(testOid) + "\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid[1:] + "\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid + "\nsize -1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid + "\nsize 1k\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\n\noid sha256:" + testOid + "\nsize 1\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + testOid + "\nsize 1\n" +
+			strings.Repeat("x", POINTER_MAX_SIZE), nil},
+	}
+	for _, test := range tests {
+		p := ReadPointer([]byte(test.data))
+		switch {
+		case test.expected == nil && p != nil:
+			t.Errorf("ReadPointer(%q): expected nil, got %+v", test.data, p)
+		case test.expected != nil && (p == nil || *p != *test.expected):
+			t.Errorf("ReadPointer(%q): expected %+v, got %+v", test.data, test.expected, p)
+		}
+	}
+}
+
+func TestIsValidOid(t *testing.T) {
+	for oid, expected := range map[string]bool{
+		testOid:                           true,
+		"":                                false,
+		testOid[1:]:                       false,
+		testOid + "0":                     false,
+		strings.ToUpper(testOid):          false,
+		"../" + testOid[3:]:               false,
+		strings.Repeat("g", len(testOid)): false,
+	} {
+		if actual := IsValidOid(oid); actual != expected {
+			t.Errorf("IsValidOid(%q): expected %v, got %v", oid, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package linguist
+
+// Language represents a programming or markup language.
+type Language struct {
+	Name       string
+	Color      string
+	Extensions []string
+	Filenames  []string
+}
+
+// Languages contains all known languages. Data formats and prose
+// such as JSON or Markdown are left out, they do not tell what
+// a repository is written in.
+var Languages = []*Language{
+	{"ActionScript", "#882b0f", []string{".as"}, nil},
+	{"Assembly", "#6e4c13", []string{".asm", ".s", ".nasm"}, nil},
+	{"C", "#555555", []string{".c", ".h"}, nil},
+	{"C#", "#178600", []string{".cs", ".csx"}, nil},
+	{"C++", "#f34b7d", []string{".cpp", ".cc", ".cxx", ".c++", ".hpp", ".hh", ".hxx", ".h++", ".ino"}, nil},
+	{"Clojure", "#db5855", []string{".clj", ".cljs", ".cljc", ".edn"}, nil},
+	{"CMake", "#064f8c", []string{".cmake"}, []string{"CMakeLists.txt"}},
+	{"CoffeeScript", "#244776", []string{".coffee"}, []string{"Cakefile"}},
+	{"Common Lisp", "#3fb68b", []string{".lisp", ".lsp", ".cl"}, nil},
+	{"CSS", "#563d7c", []string{".css"}, nil},
+	{"D", "#ba595e", []string{".d"}, nil},
+	{"Dart", "#00b4ab", []string{".dart"}, nil},
+	{"Dockerfile", "#384d54", nil, []string{"Dockerfile"}},
+	{"Elixir", "#6e4a7e", []string{".ex", ".exs"}, nil},
+	{"Emacs Lisp", "#c065db", []string{".el"}, nil},
+	{"Erlang", "#b83998", []string{".erl", ".hrl"}, nil},
+	{"F#", "#b845fc", []string{".fs", ".fsi", ".fsx"}, nil},
+	{"Fortran", "#4d41b1", []string{".f", ".f77", ".f90", ".f95", ".for"}, nil},
+	{"Go", "#375eab", []string{".go"}, nil},
+	{"Groovy", "#e69f56", []string{".groovy", ".gradle"}, nil},
+	{"Haskell", "#29b544", []string{".hs", ".lhs"}, nil},
+	{"HTML", "#e44b23", []string{".html", ".htm", ".xhtml", ".tmpl"}, nil},
+	{"Java", "#b07219", []string{".java"}, nil},
+	{"JavaScript", "#f1e05a", []string{".js", ".jsx", ".mjs"}, []string{"Jakefile"}},
+	{"Julia", "#a270ba", []string{".jl"}, nil},
+	{"Kotlin", "#f18e33", []string{".kt", ".kts"}, nil},
+	{"Less", "#1d365d", []string{".less"}, nil},
+	{"Lua", "#000080", []string{".lua"}, nil},
+	{"Makefile", "#427819", []string{".mk", ".mak"}, []string{"Makefile", "makefile", "GNUmakefile"}},
+	{"Objective-C", "#438eff", []string{".m"}, nil},
+	{"Objective-C++", "#6866fb", []string{".mm"}, nil},
+	{"OCaml", "#3be133", []string{".ml", ".mli"}, nil},
+	{"Pascal", "#e3f171", []string{".pas", ".pp", ".dpr"}, nil},
+	{"Perl", "#0298c3", []string{".pl", ".pm", ".t"}, nil},
+	{"PHP", "#4f5d95", []string{".php", ".phtml"}, nil},
+	{"PowerShell", "#012456", []string{".ps1", ".psm1", ".psd1"}, nil},
+	{"Python", "#3572a5", []string{".py", ".pyw", ".pyx", ".pxd"}, []string{"SConstruct", "SConscript", "wscript"}},
+	{"R", "#198ce7", []string{".r"}, nil},
+	{"Ruby", "#701516", []string{".rb", ".rake", ".gemspec", ".ru"}, []string{"Rakefile", "Gemfile", "Vagrantfile", "Podfile"}},
+	{"Rust", "#dea584", []string{".rs"}, nil},
+	{"Sass", "#cf649a", []string{".sass", ".scss"}, nil},
+	{"Scala", "#dc322f", []string{".scala", ".sbt"}, nil},
+	{"Scheme", "#1e4aec", []string{".scm", ".ss"}, nil},
+	{"Shell", "#89e051", []string{".sh", ".bash", ".zsh", ".ksh"}, nil},
+	{"SQL", "#e38c00", []string{".sql"}, nil},
+	{"Swift", "#ffac45", []string{".swift"}, nil},
+	{"Tcl", "#e4cc98", []string{".tcl"}, nil},
+	{"TeX", "#3d6117", []string{".tex", ".sty", ".cls"}, nil},
+	{"TypeScript", "#2b7489", []string{".ts", ".tsx"}, nil},
+	{"Vala", "#fbe5cd", []string{".vala", ".vapi"}, nil},
+	{"VimL", "#199f4b", []string{".vim"}, []string{".vimrc", ".gvimrc"}},
+	{"Visual Basic", "#945db7", []string{".vb", ".bas", ".vbs"}, nil},
+}
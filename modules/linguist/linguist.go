@@ -0,0 +1,140 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package linguist detects languages of files by their names.
+package linguist
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	extensions = make(map[string]*Language)
+	filenames  = make(map[string]*Language)
+)
+
+func init() {
+	for _, lang := range Languages {
+		for _, ext := range lang.Extensions {
+			extensions[ext] = lang
+		}
+		for _, name := range lang.Filenames {
+			filenames[name] = lang
+		}
+	}
+}
+
+// GetLanguage returns language by its name, case-insensitively.
+func GetLanguage(name string) *Language {
+	for _, lang := range Languages {
+		if strings.EqualFold(lang.Name, name) {
+			return lang
+		}
+	}
+	return nil
+}
+
+// DetectLanguage returns language of file by its name,
+// or nil if it is not written in any known language.
+func DetectLanguage(filename string) *Language {
+	name := path.Base(filename)
+	if lang, ok := filenames[name]; ok {
+		return lang
+	}
+	return extensions[strings.ToLower(path.Ext(name))]
+}
+
+// vendorPatterns matches paths of third-party and generated code,
+// which is not counted as code of repository.
+var vendorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(^|/)(vendor|vendors|third[-_]?party|deps|Godeps|node_modules|bower_components|_workspace)/`),
+	regexp.MustCompile(`(^|/)dist/`),
+	regexp.MustCompile(`(^|/)\.[^/]+/`),
+	regexp.MustCompile(`\.min\.(js|css)$`),
+	regexp.MustCompile(`-min\.(js|css)$`),
+	regexp.MustCompile(`(^|/)(jquery|bootstrap|angular|d3|modernizr)[^/]*\.js$`),
+	regexp.MustCompile(`\.pb\.go$`),
+	regexp.MustCompile(`_pb2\.py$`),
+	regexp.MustCompile(`(^|/)bindata\.go$`),
+}
+
+// IsVendored returns true if path is third-party or generated code.
+func IsVendored(treePath string) bool {
+	for _, re := range vendorPatterns {
+		if re.MatchString(treePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attribute is a path pattern from ".gitattributes" that overrides
+// whether matched files are vendored or generated.
+type Attribute struct {
+	Pattern  string
+	Vendored bool
+}
+
+// ParseAttributes parses "linguist-vendored" and "linguist-generated"
+// attributes of content of ".gitattributes" file.
+func ParseAttributes(data []byte) []*Attribute {
+	attrs := make([]*Attribute, 0, 5)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			var vendored bool
+			switch field {
+			case "linguist-vendored", "linguist-generated",
+				"linguist-vendored=true", "linguist-generated=true":
+				vendored = true
+			case "-linguist-vendored", "-linguist-generated",
+				"linguist-vendored=false", "linguist-generated=false":
+				vendored = false
+			default:
+				continue
+			}
+			attrs = append(attrs, &Attribute{fields[0], vendored})
+		}
+	}
+	return attrs
+}
+
+// match reports whether path matches pattern of attribute in the way Git does:
+// pattern without slash matches name at any level, otherwise it matches path
+// from root of repository, and trailing "/**" matches everything inside directory.
+func (a *Attribute) match(treePath string) bool {
+	pattern := strings.TrimPrefix(a.Pattern, "/")
+	if strings.HasSuffix(pattern, "/**") {
+		dir := strings.TrimSuffix(pattern, "/**")
+		for p := path.Dir(treePath); p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(dir, p); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !strings.Contains(a.Pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(treePath))
+		return ok
+	}
+	ok, _ := path.Match(pattern, treePath)
+	return ok
+}
+
+// IsVendoredWithAttributes is like IsVendored, but attributes of
+// repository take precedence, the last matched one wins.
+func IsVendoredWithAttributes(treePath string, attrs []*Attribute) bool {
+	for i := len(attrs) - 1; i >= 0; i-- {
+		if attrs[i].match(treePath) {
+			return attrs[i].Vendored
+		}
+	}
+	return IsVendored(treePath)
+}
@@ -0,0 +1,152 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package markup renders markup files such as READMEs into HTML
+// with renderers that are chosen by file extension.
+package markup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/process"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+// Timeout of external render commands.
+const RENDER_TIMEOUT = 10 * time.Second
+
+// Renderer converts content of markup files into HTML.
+type Renderer interface {
+	Name() string
+	// Extensions returns lower-cased file extensions with leading dot.
+	Extensions() []string
+	Render(rawBytes []byte, urlPrefix string) ([]byte, error)
+}
+
+var (
+	renderersLock sync.RWMutex
+	renderers     = make(map[string]Renderer)
+)
+
+// RegisterRenderer registers renderer for its file extensions,
+// it replaces renderers that were registered for same extensions.
+func RegisterRenderer(r Renderer) {
+	renderersLock.Lock()
+	defer renderersLock.Unlock()
+
+	for _, ext := range r.Extensions() {
+		renderers[ext] = r
+	}
+}
+
+// GetRenderer returns renderer of given file name, or nil if there is none.
+func GetRenderer(name string) Renderer {
+	renderersLock.RLock()
+	defer renderersLock.RUnlock()
+
+	return renderers[strings.ToLower(filepath.Ext(name))]
+}
+
+// IsMarkupFile returns true if file of given name can be rendered.
+func IsMarkupFile(name string) bool {
+	return GetRenderer(name) != nil
+}
+
+// Render renders content of file of given name with its renderer,
+// the result is sanitized so that it is safe to be displayed.
+func Render(name string, rawBytes []byte, urlPrefix string) ([]byte, error) {
+	r := GetRenderer(name)
+	if r == nil {
+		return nil, fmt.Errorf("no renderer for file: %s", name)
+	}
+	return RenderWith(r, rawBytes, urlPrefix)
+}
+
+// RenderWith renders content with given renderer and sanitizes the result.
+func RenderWith(r Renderer, rawBytes []byte, urlPrefix string) ([]byte, error) {
+	body, err := r.Render(rawBytes, urlPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", r.Name(), err)
+	}
+	return base.Sanitize(body), nil
+}
+
+// MarkdownRenderer renders Markdown files with built-in renderer.
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) Name() string {
+	return "markdown"
+}
+
+func (MarkdownRenderer) Extensions() []string {
+	return base.MarkdownFileExtensions
+}
+
+func (MarkdownRenderer) Render(rawBytes []byte, urlPrefix string) ([]byte, error) {
+	return base.RenderMarkdown(rawBytes, urlPrefix), nil
+}
+
+// ExternalRenderer renders files with a command that reads content
+// from standard input and writes HTML to standard output.
+type ExternalRenderer struct {
+	name       string
+	extensions []string
+	command    string
+	args       []string
+}
+
+func NewExternalRenderer(name string, extensions []string, command string) (*ExternalRenderer, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("empty render command")
+	}
+	return &ExternalRenderer{
+		name:       name,
+		extensions: extensions,
+		command:    fields[0],
+		args:       fields[1:],
+	}, nil
+}
+
+func (r *ExternalRenderer) Name() string {
+	return r.name
+}
+
+func (r *ExternalRenderer) Extensions() []string {
+	return r.extensions
+}
+
+func (r *ExternalRenderer) Render(rawBytes []byte, urlPrefix string) ([]byte, error) {
+	stdout, stderr, err := process.ExecStdin(RENDER_TIMEOUT, bytes.NewReader(rawBytes),
+		"Render markup: "+r.name, r.command, r.args...)
+	if err != nil {
+		return nil, fmt.Errorf("%v - %s", err, stderr)
+	}
+	return []byte(stdout), nil
+}
+
+func init() {
+	RegisterRenderer(MarkdownRenderer{})
+}
+
+// NewMarkupContext registers external renderers from configuration.
+func NewMarkupContext() {
+	for _, cfg := range setting.ExternalMarkupRenderers {
+		r, err := NewExternalRenderer(cfg.Name, cfg.FileExtensions, cfg.Command)
+		if err != nil {
+			log.Error(4, "Fail to create markup renderer(%s): %v", cfg.Name, err)
+			continue
+		}
+		RegisterRenderer(r)
+		log.Info("Markup renderer(%s) enabled for: %s", cfg.Name, strings.Join(cfg.FileExtensions, ", "))
+	}
+}
@@ -150,7 +150,14 @@ func RepoAssignment(redirect bool, args ...bool) macaron.Handler {
 		}
 
 		repo.NumOpenIssues = repo.NumIssues - repo.NumClosedIssues
+		repo.NumOpenPulls = repo.NumPulls - repo.NumClosedPulls
 		repo.NumOpenMilestones = repo.NumMilestones - repo.NumClosedMilestones
+		if repo.IsFork {
+			if err = repo.GetForkRepo(); err != nil && err != models.ErrRepoNotExist {
+				ctx.Handle(500, "GetForkRepo", err)
+				return
+			}
+		}
 		ctx.Repo.Repository = repo
 		ctx.Data["IsBareRepo"] = ctx.Repo.Repository.IsBare
 
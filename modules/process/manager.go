@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"time"
 
@@ -51,21 +52,26 @@ func Add(desc string, cmd *exec.Cmd) int64 {
 	return pid
 }
 
-// Exec starts executing a command in given path, it records its process and timeout.
-func ExecDir(timeout time.Duration, dir, desc, cmdName string, args ...string) (string, string, error) {
+// ExecDirWriter starts executing a command in given path and writes its output to given writer,
+// it records its process and timeout, and returns standard error output.
+func ExecDirWriter(timeout time.Duration, dir string, stdout io.Writer, desc, cmdName string, args ...string) (string, error) {
+	return execDirReaderWriter(timeout, dir, nil, stdout, desc, cmdName, args...)
+}
+
+func execDirReaderWriter(timeout time.Duration, dir string, stdin io.Reader, stdout io.Writer, desc, cmdName string, args ...string) (string, error) {
 	if timeout == -1 {
 		timeout = DEFAULT
 	}
 
-	bufOut := new(bytes.Buffer)
 	bufErr := new(bytes.Buffer)
 
 	cmd := exec.Command(cmdName, args...)
 	cmd.Dir = dir
-	cmd.Stdout = bufOut
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
 	cmd.Stderr = bufErr
 	if err := cmd.Start(); err != nil {
-		return "", err.Error(), err
+		return err.Error(), err
 	}
 
 	pid := Add(desc, cmd)
@@ -81,12 +87,33 @@ func ExecDir(timeout time.Duration, dir, desc, cmdName string, args ...string) (
 			log.Error(4, "Exec(%d:%s): %v", pid, desc, errKill)
 		}
 		<-done
-		return "", ErrExecTimeout.Error(), ErrExecTimeout
+		return ErrExecTimeout.Error(), ErrExecTimeout
 	case err = <-done:
 	}
 
 	Remove(pid)
-	return bufOut.String(), bufErr.String(), err
+	return bufErr.String(), err
+}
+
+// Exec starts executing a command in given path, it records its process and timeout.
+func ExecDir(timeout time.Duration, dir, desc, cmdName string, args ...string) (string, string, error) {
+	bufOut := new(bytes.Buffer)
+	stderr, err := ExecDirWriter(timeout, dir, bufOut, desc, cmdName, args...)
+	if err == ErrExecTimeout {
+		return "", stderr, err
+	}
+	return bufOut.String(), stderr, err
+}
+
+// ExecStdin starts executing a command that reads given standard input,
+// it records its process and timeout.
+func ExecStdin(timeout time.Duration, stdin io.Reader, desc, cmdName string, args ...string) (string, string, error) {
+	bufOut := new(bytes.Buffer)
+	stderr, err := execDirReaderWriter(timeout, "", stdin, bufOut, desc, cmdName, args...)
+	if err == ErrExecTimeout {
+		return "", stderr, err
+	}
+	return bufOut.String(), stderr, err
 }
 
 // Exec starts executing a command, it records its process and timeout.
@@ -18,7 +18,6 @@ import (
 	"github.com/macaron-contrib/session"
 
 	"github.com/gogits/gogs/modules/log"
-	// "github.com/gogits/gogs-ng/modules/ssh"
 )
 
 type Scheme string
@@ -36,15 +35,22 @@ var (
 	AppUrl  string
 
 	// Server settings.
-	Protocol           Scheme
-	Domain             string
-	HttpAddr, HttpPort string
-	SshPort            int
-	OfflineMode        bool
-	DisableRouterLog   bool
-	CertFile, KeyFile  string
-	StaticRootPath     string
-	EnableGzip         bool
+	Protocol                 Scheme
+	Domain                   string
+	HttpAddr, HttpPort       string
+	SshPort                  int
+	StartSshServer           bool
+	SshListenHost            string
+	SshListenPort            int
+	SshHostKeyPath           string
+	DisableSshAuthorizedKeys bool
+	OfflineMode              bool
+	DisableRouterLog         bool
+	CertFile, KeyFile        string
+	StaticRootPath           string
+	EnableGzip               bool
+	LFSStartServer           bool
+	LFSContentPath           string
 
 	// Security settings.
 	InstallLock          bool
@@ -59,8 +65,16 @@ var (
 	WebhookDeliverTimeout int
 
 	// Repository settings.
-	RepoRootPath string
-	ScriptType   string
+	RepoRootPath           string
+	ScriptType             string
+	RepoUploadMaxSize      int64
+	RepoUploadMaxFiles     int
+	RepoArchiveCacheMaxAge int
+
+	// Git settings.
+	MaxGitDiffFiles     int
+	MaxGitDiffFileLines int
+	MaxGitDiffLines     int
 
 	// Picture settings.
 	PictureService  string
@@ -78,13 +92,22 @@ var (
 	AttachmentMaxFiles     int
 	AttachmentEnabled      bool
 
+	// Code search settings.
+	CodeIndexerEnabled   bool
+	CodeIndexPath        string
+	CodeIndexMaxFileSize int64
+
+	// Markup settings.
+	ExternalMarkupRenderers []MarkupRenderer
+
 	// Time settings.
 	TimeFormat string
 
 	// Cache settings.
-	CacheAdapter  string
-	CacheInternal int
-	CacheConn     string
+	CacheAdapter       string
+	CacheInternal      int
+	CacheConn          string
+	LastCommitCacheTTL int
 
 	EnableRedis    bool
 	EnableMemcache bool
@@ -108,6 +131,44 @@ func init() {
 	log.NewLogger(0, "console", `{"level": 0}`)
 }
 
+// MarkupRenderer represents a command that renders markup files into HTML.
+type MarkupRenderer struct {
+	Name           string
+	FileExtensions []string
+	Command        string
+}
+
+// newMarkupRenderers loads renderers from sections whose names start with "markup.".
+func newMarkupRenderers() {
+	for _, sec := range Cfg.GetSectionList() {
+		if !strings.HasPrefix(sec, "markup.") || !Cfg.MustBool(sec, "ENABLED") {
+			continue
+		}
+
+		exts := make([]string, 0, 3)
+		for _, ext := range strings.Split(Cfg.MustValue(sec, "FILE_EXTENSIONS"), ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if len(ext) == 0 {
+				continue
+			} else if ext[0] != '.' {
+				ext = "." + ext
+			}
+			exts = append(exts, ext)
+		}
+		command := strings.TrimSpace(Cfg.MustValue(sec, "RENDER_COMMAND"))
+		if len(exts) == 0 || len(command) == 0 {
+			log.Warn("Markup renderer(%s) needs FILE_EXTENSIONS and RENDER_COMMAND", sec)
+			continue
+		}
+
+		ExternalMarkupRenderers = append(ExternalMarkupRenderers, MarkupRenderer{
+			Name:           strings.TrimPrefix(sec, "markup."),
+			FileExtensions: exts,
+			Command:        command,
+		})
+	}
+}
+
 func ExecPath() (string, error) {
 	file, err := exec.LookPath(os.Args[0])
 	if err != nil {
@@ -171,11 +232,25 @@ func NewConfigContext() {
 	HttpAddr = Cfg.MustValue("server", "HTTP_ADDR", "0.0.0.0")
 	HttpPort = Cfg.MustValue("server", "HTTP_PORT", "3000")
 	SshPort = Cfg.MustInt("server", "SSH_PORT", 22)
+	StartSshServer = Cfg.MustBool("server", "START_SSH_SERVER")
+	SshListenHost = Cfg.MustValue("server", "SSH_LISTEN_HOST", "0.0.0.0")
+	SshListenPort = Cfg.MustInt("server", "SSH_LISTEN_PORT", SshPort)
+	SshHostKeyPath = Cfg.MustValue("server", "SSH_HOST_KEY_PATH", "data/ssh/gogs.rsa")
+	if !filepath.IsAbs(SshHostKeyPath) {
+		SshHostKeyPath = filepath.Join(workDir, SshHostKeyPath)
+	}
+	DisableSshAuthorizedKeys = Cfg.MustBool("server", "DISABLE_SSH_AUTHORIZED_KEYS")
 	OfflineMode = Cfg.MustBool("server", "OFFLINE_MODE")
 	DisableRouterLog = Cfg.MustBool("server", "DISABLE_ROUTER_LOG")
 	StaticRootPath = Cfg.MustValue("server", "STATIC_ROOT_PATH", workDir)
 	LogRootPath = Cfg.MustValue("log", "ROOT_PATH", path.Join(workDir, "log"))
 	EnableGzip = Cfg.MustBool("server", "ENABLE_GZIP")
+	LFSStartServer = Cfg.MustBool("server", "LFS_START_SERVER")
+	LFSContentPath = Cfg.MustValue("server", "LFS_CONTENT_PATH", "data/lfs")
+	// Path is used by web and serv command, which runs in a different directory.
+	if !filepath.IsAbs(LFSContentPath) {
+		LFSContentPath = filepath.Join(workDir, LFSContentPath)
+	}
 
 	InstallLock = Cfg.MustBool("security", "INSTALL_LOCK")
 	SecretKey = Cfg.MustValue("security", "SECRET_KEY")
@@ -190,6 +265,16 @@ func NewConfigContext() {
 	AttachmentMaxFiles = Cfg.MustInt("attachment", "MAX_FILES", 10)
 	AttachmentEnabled = Cfg.MustBool("attachment", "ENABLE", true)
 
+	CodeIndexerEnabled = Cfg.MustBool("search", "ENABLE_CODE_INDEXER", true)
+	CodeIndexPath = Cfg.MustValue("search", "CODE_INDEX_PATH", "data/code_index")
+	// Index is also updated by serv command, which runs in a different directory.
+	if !filepath.IsAbs(CodeIndexPath) {
+		CodeIndexPath = filepath.Join(workDir, CodeIndexPath)
+	}
+	CodeIndexMaxFileSize = Cfg.MustInt64("search", "CODE_INDEX_MAX_FILE_SIZE", 1024)
+
+	newMarkupRenderers()
+
 	TimeFormat = map[string]string{
 		"ANSIC":       time.ANSIC,
 		"UnixDate":    time.UnixDate,
@@ -238,6 +323,13 @@ func NewConfigContext() {
 		log.Fatal(4, "Fail to create repository root path(%s): %v", RepoRootPath, err)
 	}
 	ScriptType = Cfg.MustValue("repository", "SCRIPT_TYPE", "bash")
+	RepoUploadMaxSize = Cfg.MustInt64("repository", "UPLOAD_MAX_SIZE", 3)
+	RepoUploadMaxFiles = Cfg.MustInt("repository", "UPLOAD_MAX_FILES", 5)
+	RepoArchiveCacheMaxAge = Cfg.MustInt("repository", "ARCHIVE_CACHE_MAX_AGE", 24)
+
+	MaxGitDiffFiles = Cfg.MustInt("git", "MAX_GIT_DIFF_FILES", 100)
+	MaxGitDiffFileLines = Cfg.MustInt("git", "MAX_GIT_DIFF_FILE_LINES", 1000)
+	MaxGitDiffLines = Cfg.MustInt("git", "MAX_GIT_DIFF_LINES", 10000)
 
 	PictureService = Cfg.MustValueRange("picture", "SERVICE", "server",
 		[]string{"server"})
@@ -354,6 +446,7 @@ func newCacheService() {
 	default:
 		log.Fatal(4, "Unknown cache adapter: %s", CacheAdapter)
 	}
+	LastCommitCacheTTL = Cfg.MustInt("cache", "LAST_COMMIT_TTL", 86400)
 
 	log.Info("Cache Service Enabled")
 }
@@ -458,5 +551,4 @@ func NewServices() {
 	newRegisterMailService()
 	newNotifyMailService()
 	newWebhookService()
-	// ssh.Listen("2022")
 }
@@ -0,0 +1,249 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/setting"
+	"github.com/gogits/gogs/modules/uuid"
+)
+
+// LFS_AUTHENTICATE is called by Git LFS client to get the HTTP endpoint and credentials
+// of LFS server, it takes repository path followed by operation as arguments.
+const LFS_AUTHENTICATE = "git-lfs-authenticate"
+
+var (
+	COMMANDS_READONLY = map[string]models.AccessType{
+		"git-upload-pack":    models.WRITABLE,
+		"git upload-pack":    models.WRITABLE,
+		"git-upload-archive": models.WRITABLE,
+		LFS_AUTHENTICATE:     models.WRITABLE,
+	}
+
+	COMMANDS_WRITE = map[string]models.AccessType{
+		"git-receive-pack": models.READABLE,
+		"git receive-pack": models.READABLE,
+	}
+)
+
+func In(b string, sl map[string]models.AccessType) bool {
+	_, e := sl[b]
+	return e
+}
+
+func parseCmd(cmd string) (string, string) {
+	ss := strings.SplitN(cmd, " ", 2)
+	if len(ss) != 2 {
+		return "", ""
+	}
+
+	verb, args := ss[0], ss[1]
+	if verb == "git" {
+		ss = strings.SplitN(args, " ", 2)
+		args = ss[1]
+		verb = fmt.Sprintf("%s %s", verb, ss[0])
+	}
+	return verb, strings.Replace(args, "'/", "'", 1)
+}
+
+// Serv performs command that is requested over SSH by owner of given key.
+// Access to repository is checked before Git is run with given streams,
+// and pushed commits are processed after Git exits.
+// Error is meant to be shown to client.
+func Serv(keyId int64, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	user, err := models.GetUserByKeyId(keyId)
+	if err != nil {
+		if err == models.ErrUserNotKeyOwner {
+			return errors.New("you are not the owner of SSH key")
+		}
+		return fmt.Errorf("internal error: %v", err)
+	}
+
+	if cmd == "" {
+		fmt.Fprintln(stderr, "Hi", user.Name, "! You've successfully authenticated, but Gogs does not provide shell access.")
+		return nil
+	}
+
+	verb, args := parseCmd(cmd)
+
+	lfsOperation := ""
+	if verb == LFS_AUTHENTICATE {
+		ss := strings.Fields(args)
+		if len(ss) != 2 || (ss[1] != models.LFS_OPERATION_DOWNLOAD && ss[1] != models.LFS_OPERATION_UPLOAD) {
+			return fmt.Errorf("unknown LFS operation: %s", args)
+		}
+		args, lfsOperation = ss[0], ss[1]
+	}
+
+	repoPath := strings.Trim(args, "'")
+	rr := strings.SplitN(repoPath, "/", 2)
+	if len(rr) != 2 {
+		return fmt.Errorf("unavailable repository: %s", args)
+	}
+	repoUserName := rr[0]
+	repoName := strings.TrimSuffix(rr[1], ".git")
+
+	// Wiki of repository is served as "<reponame>.wiki.git" with same access rules.
+	isWiki := strings.HasSuffix(repoName, ".wiki")
+	if isWiki {
+		repoName = strings.TrimSuffix(repoName, ".wiki")
+	}
+
+	isWrite := In(verb, COMMANDS_WRITE)
+	isRead := In(verb, COMMANDS_READONLY)
+	if lfsOperation == models.LFS_OPERATION_UPLOAD {
+		isWrite, isRead = true, false
+	}
+
+	repoUser, err := models.GetUserByName(repoUserName)
+	if err != nil {
+		if err == models.ErrUserNotExist {
+			return fmt.Errorf("given repository owner are not registered: %s", repoUserName)
+		}
+		return fmt.Errorf("internal error: %v", err)
+	}
+
+	// Access check.
+	switch {
+	case isWrite:
+		has, err := models.HasAccess(user.Name, path.Join(repoUserName, repoName), models.WRITABLE)
+		if err != nil {
+			return fmt.Errorf("internal error: %v", err)
+		} else if !has {
+			return fmt.Errorf("user %s has no right to write repository %s", user.Name, repoPath)
+		}
+	case isRead:
+		repo, err := models.GetRepositoryByName(repoUser.Id, repoName)
+		if err != nil {
+			if err == models.ErrRepoNotExist {
+				return fmt.Errorf("given repository does not exist: %s/%s", repoUser.Name, repoName)
+			}
+			return fmt.Errorf("internal error: %v", err)
+		}
+
+		if !repo.IsPrivate {
+			break
+		}
+
+		has, err := models.HasAccess(user.Name, path.Join(repoUserName, repoName), models.READABLE)
+		if err != nil {
+			return fmt.Errorf("internal error: %v", err)
+		} else if !has {
+			return fmt.Errorf("user %s has no right to read repository %s", user.Name, repoPath)
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", verb)
+	}
+
+	if verb == LFS_AUTHENTICATE {
+		if !setting.LFSStartServer {
+			return errors.New("LFS server is not enabled")
+		}
+		repo, err := models.GetRepositoryByName(repoUser.Id, repoName)
+		if err != nil {
+			return fmt.Errorf("internal error: %v", err)
+		}
+
+		// Lifetime of token starts at beginning of current minute, so expires_at is set a minute earlier.
+		data, err := json.Marshal(map[string]interface{}{
+			"header": map[string]string{
+				"Authorization": "Bearer " + models.NewLFSToken(user.Id, repo.Id, lfsOperation),
+			},
+			"href":       setting.AppUrl + repoUserName + "/" + repoName + ".git/info/lfs",
+			"expires_at": time.Now().Add((models.LFS_TOKEN_EXPIRE_MINUTES - 1) * time.Minute).Format(time.RFC3339),
+		})
+		if err != nil {
+			return fmt.Errorf("internal error: %v", err)
+		}
+		fmt.Fprintln(stdout, string(data))
+		return nil
+	}
+
+	// First push to wiki creates it.
+	if isWiki && isWrite {
+		repo, err := models.GetRepositoryByName(repoUser.Id, repoName)
+		if err != nil {
+			return fmt.Errorf("internal error: %v", err)
+		}
+		repo.Owner = repoUser
+		if err = repo.InitWiki(); err != nil {
+			return fmt.Errorf("internal error: init wiki: %v", err)
+		}
+	}
+
+	// Update hook reads information of the push from environment.
+	uuid := uuid.NewV4().String()
+	verbs := strings.Split(verb, " ")
+	gitcmd := exec.Command(verbs[0], append(verbs[1:], repoPath)...)
+	gitcmd.Dir = setting.RepoRootPath
+	gitcmd.Env = append(os.Environ(),
+		"SSH_ORIGINAL_COMMAND="+cmd,
+		"uuid="+uuid,
+		models.ENV_AUTH_USER_ID+"="+com.ToStr(user.Id),
+		models.ENV_REPO_OWNER_NAME+"="+repoUserName,
+		models.ENV_REPO_NAME+"="+repoName)
+	gitcmd.Stdout = stdout
+	gitcmd.Stderr = stderr
+	gitStdin, err := gitcmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("internal error: %v", err)
+	}
+	if err = gitcmd.Start(); err != nil {
+		return fmt.Errorf("internal error: fail to execute git command: %v", err)
+	}
+	// Client does not always close its input when Git is done, so copying is not waited for.
+	go func() {
+		io.Copy(gitStdin, stdin)
+		gitStdin.Close()
+	}()
+	if err = gitcmd.Wait(); err != nil {
+		return fmt.Errorf("internal error: fail to execute git command: %v", err)
+	}
+
+	if isWrite && !isWiki {
+		tasks, err := models.GetUpdateTasksByUuid(uuid)
+		if err != nil {
+			return fmt.Errorf("internal error: GetUpdateTasksByUuid: %v", err)
+		}
+
+		// Failure of one update does not stop others from being processed.
+		var updateErr error
+		for _, task := range tasks {
+			if err = models.Update(task.RefName, task.OldCommitId, task.NewCommitId,
+				user.Name, repoUserName, repoName, user.Id); err != nil {
+				updateErr = fmt.Errorf("internal error: fail to update: %v", err)
+			}
+		}
+
+		if err = models.DelUpdateTasksByUuid(uuid); err != nil {
+			return fmt.Errorf("internal error: DelUpdateTasksByUuid: %v", err)
+		} else if updateErr != nil {
+			return updateErr
+		}
+	}
+
+	// Update key activity.
+	key, err := models.GetPublicKeyById(keyId)
+	if err != nil {
+		return fmt.Errorf("internal error: GetPublicKeyById: %v", err)
+	}
+	key.Updated = time.Now()
+	if err = models.UpdatePublicKey(key); err != nil {
+		return fmt.Errorf("internal error: UpdatePublicKey: %v", err)
+	}
+	return nil
+}
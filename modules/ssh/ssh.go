@@ -2,25 +2,89 @@
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 
-// Prototype, git client looks like do not recognize req.Reply.
+// Package ssh implements serving Git over SSH, both for serv command that is called
+// by system SSH server and for the built-in SSH server.
 package ssh
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"code.google.com/p/go.crypto/ssh"
 
 	"github.com/Unknwon/com"
 
+	"github.com/gogits/gogs/models"
 	"github.com/gogits/gogs/modules/log"
 )
 
-func handleServerConn(keyId string, chans <-chan ssh.NewChannel) {
+// parseString returns the string that is encoded with its length in payload of request.
+func parseString(payload []byte) (string, bool) {
+	if len(payload) < 4 {
+		return "", false
+	}
+	length := binary.BigEndian.Uint32(payload)
+	if uint32(len(payload)-4) < length {
+		return "", false
+	}
+	return string(payload[4 : 4+length]), true
+}
+
+func exitStatus(status uint32) []byte {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, status)
+	return payload
+}
+
+func handleSession(keyId int64, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			// Environment of Git is set by server, variables sent by client are ignored.
+			req.Reply(true, nil)
+		case "exec", "shell":
+			cmd := ""
+			if req.Type == "exec" {
+				var ok bool
+				if cmd, ok = parseString(req.Payload); !ok {
+					req.Reply(false, nil)
+					continue
+				}
+			}
+
+			// Client waits for reply before it sends any data, so reply must not wait for command.
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			var status uint32
+			if err := Serv(keyId, cmd, channel, channel, channel.Stderr()); err != nil {
+				log.Error(4, "Serv(key %d): %v", keyId, err)
+				fmt.Fprintln(channel.Stderr(), "Gogs:", err)
+				status = 1
+			}
+			if _, err := channel.SendRequest("exit-status", false, exitStatus(status)); err != nil {
+				log.Error(4, "Send exit status: %v", err)
+			}
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func handleServerConn(keyId int64, chans <-chan ssh.NewChannel) {
 	for newChan := range chans {
 		if newChan.ChannelType() != "session" {
 			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
@@ -28,92 +92,110 @@ func handleServerConn(keyId string, chans <-chan ssh.NewChannel) {
 		}
 		channel, requests, err := newChan.Accept()
 		if err != nil {
-			log.Error(3, "Could not accept channel: %v", err)
+			log.Error(4, "Fail to accept channel: %v", err)
 			continue
 		}
+		go handleSession(keyId, channel, requests)
+	}
+}
 
-		go func(in <-chan *ssh.Request) {
-			defer channel.Close()
-			for req := range in {
-				ok, payload := false, strings.TrimLeft(string(req.Payload), "\x00")
-				fmt.Println("Request:", req.Type, req.WantReply, payload)
-				switch req.Type {
-				case "env":
-					args := strings.Split(strings.Replace(payload, "\x00", "", -1), "\v")
-					if len(args) != 2 {
-						break
-					}
-					args[0] = strings.TrimLeft(args[0], "\x04")
-					_, _, err := com.ExecCmdBytes("env", args[0]+"="+args[1])
-					if err != nil {
-						log.Error(3, "env: %v", err)
-						channel.Stderr().Write([]byte(err.Error()))
-						break
-					}
-					ok = true
-				case "exec":
-					os.Setenv("SSH_ORIGINAL_COMMAND", strings.TrimLeft(payload, "'("))
-					log.Info("Payload: %v", strings.TrimLeft(payload, "'("))
-					cmd := exec.Command("/Users/jiahuachen/Applications/Go/src/github.com/gogits/gogs-ng/gogs-ng", "serv", "key-"+keyId)
-					cmd.Stdout = channel
-					cmd.Stdin = channel
-					cmd.Stderr = channel.Stderr()
-					if err := cmd.Run(); err != nil {
-						log.Error(3, "exec: %v", err)
-					} else {
-						ok = true
-					}
+func listen(config *ssh.ServerConfig, listener net.Listener) {
+	var delay time.Duration // How long to sleep on temporary accept failure.
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Temporary errors (e.g. out of file descriptors) are retried with backoff
+			// as net/http does, others (e.g. closed listener) stop serving.
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else {
+					delay *= 2
 				}
-				fmt.Println("Done:", ok)
-				req.Reply(ok, nil) // BUG: Git on Mac seems not know this reply and hang?
+				if delay > time.Second {
+					delay = time.Second
+				}
+				log.Warn("Fail to accept incoming connection: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			log.Error(4, "Fail to accept incoming connection: %v", err)
+			return
+		}
+		delay = 0
+
+		// Handshake is done separately so that slow clients do not block others.
+		go func() {
+			sConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+			if err != nil {
+				log.Trace("Fail to handshake with %s: %v", conn.RemoteAddr(), err)
+				return
 			}
-			fmt.Println("Done!!!")
-		}(requests)
+			// The incoming Request channel must be serviced.
+			go ssh.DiscardRequests(reqs)
+			handleServerConn(com.StrTo(sConn.Permissions.Extensions["key-id"]).MustInt64(), chans)
+		}()
 	}
 }
 
-func listen(config *ssh.ServerConfig, port string) {
-	listener, err := net.Listen("tcp", "0.0.0.0:"+port)
+// generateHostKey generates a RSA private key and saves it in PEM format.
+func generateHostKey(keyPath string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	for {
-		// Once a ServerConfig has been configured, connections can be accepted.
-		conn, err := listener.Accept()
-		if err != nil {
-			log.Error(3, "Fail to accept incoming connection: %v", err)
-			continue
-		}
-		// Before use, a handshake must be performed on the incoming net.Conn.
-		sConn, chans, reqs, err := ssh.NewServerConn(conn, config)
-		if err != nil {
-			log.Error(3, "Fail to handshake: %v", err)
-			continue
-		}
-		// The incoming Request channel must be serviced.
-		go ssh.DiscardRequests(reqs)
-		go handleServerConn(sConn.Permissions.Extensions["key-id"], chans)
+
+	if err = os.MkdirAll(filepath.Dir(keyPath), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+
+	return pem.Encode(f, &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
 }
 
-// Listen starts a SSH server listens on given port.
-func Listen(port string) {
+// Listen starts the built-in SSH server on given address, host key is generated
+// at given path if it does not exist. Users are authenticated by their public keys.
+func Listen(host string, port int, hostKeyPath string) error {
 	config := &ssh.ServerConfig{
 		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
-			// keyCache[string(ssh.MarshalAuthorizedKey(key))] = 2
-			return &ssh.Permissions{Extensions: map[string]string{"key-id": "2"}}, nil
+			pkey, err := models.GetPublicKeyByContent(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+			if err != nil {
+				if err != models.ErrKeyNotExist {
+					log.Error(4, "GetPublicKeyByContent: %v", err)
+				}
+				return nil, err
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"key-id": com.ToStr(pkey.Id)}}, nil
 		},
 	}
 
-	privateBytes, err := ioutil.ReadFile("/Users/jiahuachen/.ssh/id_rsa")
+	if !com.IsFile(hostKeyPath) {
+		log.Info("Generating SSH host key: %s", hostKeyPath)
+		if err := generateHostKey(hostKeyPath); err != nil {
+			return fmt.Errorf("generate host key: %v", err)
+		}
+	}
+	privateBytes, err := ioutil.ReadFile(hostKeyPath)
 	if err != nil {
-		panic("failed to load private key")
+		return fmt.Errorf("read host key: %v", err)
 	}
 	private, err := ssh.ParsePrivateKey(privateBytes)
 	if err != nil {
-		panic("failed to parse private key")
+		return fmt.Errorf("parse host key: %v", err)
 	}
 	config.AddHostKey(private)
 
-	go listen(config, port)
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, com.ToStr(port)))
+	if err != nil {
+		return err
+	}
+	go listen(config, listener)
+	return nil
 }
@@ -1120,6 +1120,143 @@ function initOrganization() {
     console.log("init script : organization done");
 }
 
+function initDiffComment() {
+    var $form = $('#diff-comment-form');
+    if (!$form.length) {
+        return;
+    }
+
+    $('.code-diff').on('click', '.add-line-comment', function (e) {
+        e.preventDefault();
+        var $this = $(this);
+        var $row = $this.closest('tr');
+        var $next = $row.next('.diff-comment-new');
+        if ($next.length) {
+            $next.find('textarea').focus();
+            return;
+        }
+
+        var $newForm = $form.clone().removeAttr('id').removeClass('hidden');
+        $newForm.find('input[name=path]').val($this.data('path'));
+        $newForm.find('input[name=line]').val($this.data('line'));
+        $newForm.on('click', '.cancel', function () {
+            $(this).closest('tr').remove();
+            return false;
+        });
+        var $tr = $('<tr class="diff-comment-new"><td colspan="3"></td></tr>');
+        $tr.find('td').append($newForm);
+        $row.after($tr);
+        $newForm.find('textarea').focus();
+    });
+}
+
+function initCommitGraph() {
+    var ROW_HEIGHT = 28,
+        COLUMN_WIDTH = 16,
+        DOT_RADIUS = 4,
+        COLORS = ['#4183c4', '#d9534f', '#5cb85c', '#f0ad4e', '#9b59b6', '#1abc9c', '#e67e22', '#34495e'];
+
+    var $graph = $('#commit-graph'),
+        $list = $('#commit-graph-list'),
+        $more = $('#commit-graph-more'),
+        canvas = document.getElementById('commit-graph-canvas'),
+        rows = [],
+        incoming = [],
+        page = 0;
+
+    function x(column) {
+        return column * COLUMN_WIDTH + COLUMN_WIDTH / 2;
+    }
+
+    function y(row) {
+        return row * ROW_HEIGHT + ROW_HEIGHT / 2;
+    }
+
+    function color(i) {
+        return COLORS[i % COLORS.length];
+    }
+
+    // Lines go from a row to the next one, columns are joined by a curve.
+    function drawLine(ctx, row, line) {
+        var x1 = x(line.from), y1 = y(row), x2 = x(line.to), y2 = y(row + 1);
+        ctx.strokeStyle = color(line.color);
+        ctx.beginPath();
+        ctx.moveTo(x1, y1);
+        if (x1 == x2) {
+            ctx.lineTo(x2, y2);
+        } else {
+            ctx.bezierCurveTo(x1, y1 + ROW_HEIGHT / 2, x2, y2 - ROW_HEIGHT / 2, x2, y2);
+        }
+        ctx.stroke();
+    }
+
+    function draw() {
+        var columns = 1;
+        $.each(incoming, function (i, line) {
+            columns = Math.max(columns, line.from + 1, line.to + 1);
+        });
+        $.each(rows, function (i, commit) {
+            columns = Math.max(columns, commit.column + 1);
+            $.each(commit.lines, function (j, line) {
+                columns = Math.max(columns, line.from + 1, line.to + 1);
+            });
+        });
+
+        canvas.width = columns * COLUMN_WIDTH;
+        canvas.height = rows.length * ROW_HEIGHT;
+        $list.css('margin-left', canvas.width + 10);
+
+        var ctx = canvas.getContext('2d');
+        ctx.lineWidth = 2;
+        $.each(incoming, function (i, line) {
+            drawLine(ctx, -1, line);
+        });
+        $.each(rows, function (i, commit) {
+            $.each(commit.lines, function (j, line) {
+                drawLine(ctx, i, line);
+            });
+        });
+        $.each(rows, function (i, commit) {
+            ctx.fillStyle = color(commit.color);
+            ctx.beginPath();
+            ctx.arc(x(commit.column), y(i), DOT_RADIUS, 0, 2 * Math.PI);
+            ctx.fill();
+        });
+    }
+
+    function load() {
+        $more.addClass('hidden');
+        $.getJSON($graph.data('url'), {
+            branch: $graph.data('branch'),
+            p: page + 1
+        }, function (data) {
+            if (page == 0) {
+                incoming = data.incoming || [];
+            }
+            page = data.page;
+            $.each(data.commits, function (i, commit) {
+                rows.push(commit);
+                var $item = $('<li>').css('height', ROW_HEIGHT);
+                $item.append($('<a class="label label-success sha">').attr('href', $graph.data('commit-link') + commit.id).text(commit.id.substr(0, 10)));
+                $.each(commit.refs || [], function (j, ref) {
+                    $item.append($('<span class="label label-primary ref">').text(ref));
+                });
+                $item.append($('<span class="message">').text(commit.summary));
+                $item.append($('<span class="author">').append($('<img class="avatar">').attr('src', commit.avatar)).append(document.createTextNode(commit.author_name)));
+                $item.append($('<span class="date">').text(new Date(commit.when * 1000).toLocaleString()));
+                $list.append($item);
+            });
+            draw();
+            if (data.has_more) {
+                $more.removeClass('hidden');
+            }
+        });
+    }
+
+    $more.on('click', load);
+    load();
+}
+
 function initTimeSwitch() {
     $(".time-since[title]").on("click", function() {
         var $this = $(this);
@@ -1148,6 +1285,9 @@ function initTimeSwitch() {
         if ($('#issue').length) {
             initIssue();
         }
+        if ($('.code-diff').length) {
+            initDiffComment();
+        }
         if ($('#release').length) {
             initRelease();
         }
@@ -1157,6 +1297,9 @@ function initTimeSwitch() {
         if ($('#repo-create').length) {
             initRepoCreating();
         }
+        if ($('#commit-graph').length) {
+            initCommitGraph();
+        }
         if ($('#body-nav').hasClass("org-nav")) {
             initOrganization();
         }
@@ -23,9 +23,13 @@ type repo struct {
 
 func SearchRepos(ctx *middleware.Context) {
 	opt := models.SearchOption{
-		Keyword: path.Base(ctx.Query("q")),
-		Uid:     com.StrTo(ctx.Query("uid")).MustInt64(),
-		Limit:   com.StrTo(ctx.Query("limit")).MustInt(),
+		Keyword:  ctx.Query("q"),
+		Uid:      com.StrTo(ctx.Query("uid")).MustInt64(),
+		Limit:    com.StrTo(ctx.Query("limit")).MustInt(),
+		Language: ctx.Query("language"),
+	}
+	if len(opt.Keyword) > 0 {
+		opt.Keyword = path.Base(opt.Keyword)
 	}
 	if opt.Limit == 0 {
 		opt.Limit = 10
@@ -22,6 +22,7 @@ import (
 	"github.com/gogits/gogs/modules/cron"
 	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/mailer"
+	"github.com/gogits/gogs/modules/markup"
 	"github.com/gogits/gogs/modules/middleware"
 	"github.com/gogits/gogs/modules/setting"
 	"github.com/gogits/gogs/modules/social"
@@ -53,6 +54,7 @@ func GlobalInit() {
 	log.Trace("Custom path: %s", setting.CustomPath)
 	log.Trace("Log path: %s", setting.LogRootPath)
 	mailer.NewMailerContext()
+	markup.NewMarkupContext()
 	models.LoadModelsConfig()
 	NewServices()
 
@@ -65,7 +67,13 @@ func GlobalInit() {
 		}
 
 		models.HasEngine = true
+		models.IsWebServer = true
+		if err := models.NewLastCommitCache(); err != nil {
+			log.Fatal(4, "Fail to initialize last commit cache: %v", err)
+		}
 		cron.NewCronContext()
+		go models.TestPullRequests()
+		go models.UpdateAllRepoIndexes()
 		log.NewGitLogger(path.Join(setting.LogRootPath, "http.log"))
 	}
 	if models.EnableSQLite3 {
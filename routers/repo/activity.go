@@ -0,0 +1,95 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/middleware"
+)
+
+const (
+	ACTIVITY base.TplName = "repo/activity"
+
+	ACTIVITY_MAX_CONTRIBUTORS = 50
+	// Periods are relative to current time, so cached statistics expire daily.
+	ACTIVITY_CACHE_TTL = 24 * 60 * 60
+)
+
+// getRepoActivity returns activity statistics of current commit, results are
+// cached per commit and period, so they are only computed again after push.
+func getRepoActivity(ctx *middleware.Context, period string, since time.Time) (*models.RepoActivity, error) {
+	key := "repo_activity_" + com.ToStr(ctx.Repo.Repository.Id) + "_" + ctx.Repo.Commit.Id.String() + "_" + period
+	if val, ok := ctx.Cache.Get(key).(string); ok {
+		act := new(models.RepoActivity)
+		if err := json.Unmarshal([]byte(val), act); err == nil {
+			return act, nil
+		}
+	}
+
+	act, err := models.GetRepoActivity(ctx.Repo.GitRepo, ctx.Repo.Commit, since)
+	if err != nil {
+		return nil, err
+	}
+	if len(act.Contributors) > ACTIVITY_MAX_CONTRIBUTORS {
+		act.Contributors = act.Contributors[:ACTIVITY_MAX_CONTRIBUTORS]
+	}
+
+	data, err := json.Marshal(act)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Cache.Put(key, string(data), ACTIVITY_CACHE_TTL); err != nil {
+		log.Error(4, "Put repository activity into cache: %v", err)
+	}
+	return act, nil
+}
+
+func Activity(ctx *middleware.Context) {
+	ctx.Data["Title"] = "Activity - " + ctx.Repo.Repository.Name
+	ctx.Data["IsViewBranch"] = ctx.Repo.IsBranch
+
+	period := ctx.Query("period")
+	if len(period) == 0 {
+		period = "quarter"
+	}
+	var since time.Time
+	found := false
+	for _, p := range models.ActivityPeriods {
+		if p.Name == period {
+			found = true
+			if p.Duration > 0 {
+				since = time.Now().Add(-p.Duration)
+			}
+			break
+		}
+	}
+	if !found {
+		ctx.Handle(404, "repo.Activity", nil)
+		return
+	}
+
+	act, err := getRepoActivity(ctx, period, since)
+	if err != nil {
+		ctx.Handle(500, "GetRepoActivity", err)
+		return
+	}
+	if err = act.LoadContributorUsers(); err != nil {
+		ctx.Handle(500, "LoadContributorUsers", err)
+		return
+	}
+
+	ctx.Data["Period"] = period
+	ctx.Data["ActivityPeriods"] = models.ActivityPeriods
+	ctx.Data["Activity"] = act
+	ctx.Data["WeekDays"] = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	ctx.HTML(200, ACTIVITY)
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"strings"
+
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/middleware"
+)
+
+const (
+	BLAME base.TplName = "repo/blame"
+)
+
+func Blame(ctx *middleware.Context) {
+	treename := ctx.Params("*")
+	ctx.Data["Title"] = treename + " - " + ctx.Repo.Repository.Name
+	ctx.Data["IsRepoToolbarSource"] = true
+	ctx.Data["IsViewBranch"] = ctx.Repo.IsBranch
+
+	entry, err := ctx.Repo.Commit.GetTreeEntryByPath(treename)
+	if err != nil {
+		if err == git.ErrNotExist {
+			ctx.Handle(404, "GetTreeEntryByPath", nil)
+		} else {
+			ctx.Handle(500, "GetTreeEntryByPath", err)
+		}
+		return
+	} else if entry.IsDir() {
+		ctx.Handle(404, "repo.Blame", nil)
+		return
+	}
+
+	parts, err := ctx.Repo.GitRepo.GetBlame(ctx.Repo.CommitId, treename)
+	if err != nil {
+		ctx.Handle(500, "GetBlame", err)
+		return
+	}
+
+	treenames := strings.Split(treename, "/")
+	paths := make([]string, len(treenames))
+	for i := range treenames {
+		paths[i] = strings.Join(treenames[:i+1], "/")
+	}
+
+	ctx.Data["Username"] = ctx.Repo.Owner.Name
+	ctx.Data["Reponame"] = ctx.Repo.Repository.Name
+	ctx.Data["FileName"] = entry.Name()
+	ctx.Data["FileSize"] = entry.Blob().Size()
+	ctx.Data["FileLink"] = ctx.Repo.RepoLink + "/raw/" + ctx.Repo.BranchName + "/" + treename
+	ctx.Data["BranchLink"] = ctx.Repo.RepoLink + "/src/" + ctx.Repo.BranchName
+	ctx.Data["TreeName"] = treename
+	ctx.Data["Treenames"] = treenames
+	ctx.Data["Paths"] = paths
+	ctx.Data["BlameParts"] = parts
+	ctx.HTML(200, BLAME)
+}
@@ -5,7 +5,11 @@
 package repo
 
 import (
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/auth"
 	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/middleware"
 )
 
@@ -13,6 +17,17 @@ const (
 	BRANCH base.TplName = "repo/branch"
 )
 
+// Branch represents a branch with its status compared to default branch.
+type Branch struct {
+	Name          string
+	Commit        *git.Commit
+	IsDefault     bool
+	IsProtected   bool
+	Ahead, Behind int
+	// Percentages that are used to draw ahead and behind graphs.
+	AheadPercent, BehindPercent int
+}
+
 func Branches(ctx *middleware.Context) {
 	ctx.Data["Title"] = "Branches"
 	ctx.Data["IsRepoToolbarBranches"] = true
@@ -26,6 +41,152 @@ func Branches(ctx *middleware.Context) {
 		return
 	}
 
-	ctx.Data["Branches"] = brs
+	defaultBranch := ctx.Repo.Repository.DefaultBranch
+	if !ctx.Repo.GitRepo.IsBranchExist(defaultBranch) {
+		defaultBranch = brs[0]
+	}
+
+	pbs, err := models.GetProtectBranchesByRepoId(ctx.Repo.Repository.Id)
+	if err != nil {
+		ctx.Handle(500, "GetProtectBranchesByRepoId", err)
+		return
+	}
+	protected := make(map[string]bool, len(pbs))
+	for _, pb := range pbs {
+		protected[pb.Name] = true
+	}
+
+	var (
+		branches  = make([]*Branch, 0, len(brs))
+		maxCount  = 1
+		defBranch *Branch
+	)
+	for _, name := range brs {
+		commit, err := ctx.Repo.GitRepo.GetCommitOfBranch(name)
+		if err != nil {
+			ctx.Handle(500, "GetCommitOfBranch", err)
+			return
+		}
+		br := &Branch{
+			Name:        name,
+			Commit:      commit,
+			IsDefault:   name == defaultBranch,
+			IsProtected: protected[name],
+		}
+		if br.IsDefault {
+			defBranch = br
+			continue
+		}
+
+		br.Ahead, br.Behind, err = ctx.Repo.GitRepo.GetAheadBehind(defaultBranch, name)
+		if err != nil {
+			ctx.Handle(500, "GetAheadBehind", err)
+			return
+		}
+		if br.Ahead > maxCount {
+			maxCount = br.Ahead
+		}
+		if br.Behind > maxCount {
+			maxCount = br.Behind
+		}
+		branches = append(branches, br)
+	}
+	for _, br := range branches {
+		br.AheadPercent = br.Ahead * 100 / maxCount
+		br.BehindPercent = br.Behind * 100 / maxCount
+	}
+
+	ctx.Data["DefaultBranch"] = defBranch
+	ctx.Data["Branches"] = branches
 	ctx.HTML(200, BRANCH)
 }
+
+func CreateBranch(ctx *middleware.Context, form auth.CreateBranchForm) {
+	if !ctx.Repo.IsOwner {
+		ctx.Handle(403, "CreateBranch", nil)
+		return
+	}
+
+	redirectTo := ctx.Repo.RepoLink + "/branches"
+	if ctx.HasError() {
+		ctx.Flash.Error(ctx.Data["ErrorMsg"].(string))
+		ctx.Redirect(redirectTo)
+		return
+	}
+
+	if err := models.CreateBranch(ctx.User, ctx.Repo.Repository, form.BranchName, form.StartPoint); err != nil {
+		switch err {
+		case models.ErrReferenceNameIllegal:
+			ctx.Flash.Error(ctx.Tr("repo.branches.illegal_name", form.BranchName))
+		case models.ErrBranchAlreadyExist:
+			ctx.Flash.Error(ctx.Tr("repo.branches.already_exist", form.BranchName))
+		case models.ErrRevisionNotExist:
+			ctx.Flash.Error(ctx.Tr("repo.branches.revision_not_exist", form.StartPoint))
+		default:
+			if perr, ok := err.(models.ErrBranchProtected); ok {
+				ctx.Flash.Error(protectedBranchMessage(ctx, perr))
+				break
+			}
+			ctx.Handle(500, "CreateBranch", err)
+			return
+		}
+		ctx.Redirect(redirectTo)
+		return
+	}
+	log.Trace("Branch created: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, form.BranchName)
+
+	ctx.Flash.Success(ctx.Tr("repo.branches.create_success", form.BranchName))
+	ctx.Redirect(ctx.Repo.RepoLink + "/src/" + form.BranchName)
+}
+
+func DeleteBranch(ctx *middleware.Context) {
+	if !ctx.Repo.IsOwner {
+		ctx.Handle(403, "DeleteBranch", nil)
+		return
+	}
+
+	name := ctx.Query("name")
+	if err := models.DeleteBranch(ctx.User, ctx.Repo.Repository, name); err != nil {
+		switch err {
+		case models.ErrBranchNotExist:
+			ctx.Handle(404, "DeleteBranch", nil)
+			return
+		case models.ErrDeleteDefaultBranch:
+			ctx.Flash.Error(ctx.Tr("repo.branches.delete_default"))
+		default:
+			if perr, ok := err.(models.ErrBranchProtected); ok {
+				ctx.Flash.Error(protectedBranchMessage(ctx, perr))
+				break
+			}
+			ctx.Handle(500, "DeleteBranch", err)
+			return
+		}
+		ctx.Redirect(ctx.Repo.RepoLink + "/branches")
+		return
+	}
+	log.Trace("Branch deleted: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, name)
+
+	ctx.Flash.Success(ctx.Tr("repo.branches.delete_success", name))
+	ctx.Redirect(ctx.Repo.RepoLink + "/branches")
+}
+
+func DeleteTag(ctx *middleware.Context) {
+	if !ctx.Repo.IsOwner {
+		ctx.Handle(403, "DeleteTag", nil)
+		return
+	}
+
+	name := ctx.Query("name")
+	if err := models.DeleteTag(ctx.User, ctx.Repo.Repository, name); err != nil {
+		if err == models.ErrTagNotExist {
+			ctx.Handle(404, "DeleteTag", nil)
+		} else {
+			ctx.Handle(500, "DeleteTag", err)
+		}
+		return
+	}
+	log.Trace("Tag deleted: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, name)
+
+	ctx.Flash.Success(ctx.Tr("repo.tags.delete_success", name))
+	ctx.Redirect(ctx.Repo.RepoLink + "/releases")
+}
@@ -5,12 +5,19 @@
 package repo
 
 import (
+	"container/list"
+	"net/url"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/Unknwon/com"
 
 	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/auth"
 	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/middleware"
 )
 
@@ -69,19 +76,55 @@ func Commits(ctx *middleware.Context) {
 	ctx.HTML(200, COMMITS)
 }
 
+// parseSearchDate parses date of commit search in form of "2006-01-02",
+// zero time is returned for empty value.
+func parseSearchDate(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
 func SearchCommits(ctx *middleware.Context) {
 	ctx.Data["IsSearchPage"] = true
 	ctx.Data["IsRepoToolbarCommits"] = true
 
-	keyword := ctx.Query("q")
-	if len(keyword) == 0 {
+	userName := ctx.Params(":username")
+	repoName := ctx.Params(":reponame")
+
+	opts := &git.SearchCommitsOptions{
+		Keyword:      strings.TrimSpace(ctx.Query("q")),
+		MessageRegex: ctx.Query("message"),
+		Author:       strings.TrimSpace(ctx.Query("author")),
+		Committer:    strings.TrimSpace(ctx.Query("committer")),
+		Path:         strings.Trim(ctx.Query("path"), "/ "),
+	}
+	ctx.Data["Keyword"] = opts.Keyword
+	ctx.Data["SearchMessage"] = opts.MessageRegex
+	ctx.Data["SearchAuthor"] = opts.Author
+	ctx.Data["SearchCommitter"] = opts.Committer
+	ctx.Data["SearchSince"] = ctx.Query("since")
+	ctx.Data["SearchUntil"] = ctx.Query("until")
+	ctx.Data["SearchPath"] = opts.Path
+	ctx.Data["IsAdvancedSearch"] = len(opts.MessageRegex) > 0 || len(opts.Author) > 0 ||
+		len(opts.Committer) > 0 || len(ctx.Query("since")) > 0 || len(ctx.Query("until")) > 0 || len(opts.Path) > 0
+
+	var err error
+	if opts.Since, err = parseSearchDate(ctx.Query("since")); err != nil {
+		ctx.Data["SearchError"] = ctx.Tr("repo.commits.invalid_since")
+	} else if opts.Until, err = parseSearchDate(ctx.Query("until")); err != nil {
+		ctx.Data["SearchError"] = ctx.Tr("repo.commits.invalid_until")
+	}
+	if !opts.Until.IsZero() {
+		// Until date is inclusive.
+		opts.Until = opts.Until.Add(24*time.Hour - time.Second)
+	}
+
+	if err == nil && opts.IsEmpty() {
 		ctx.Redirect(ctx.Repo.RepoLink + "/commits/" + ctx.Repo.BranchName)
 		return
 	}
 
-	userName := ctx.Params(":username")
-	repoName := ctx.Params(":reponame")
-
 	brs, err := ctx.Repo.GitRepo.GetBranches()
 	if err != nil {
 		ctx.Handle(500, "GetBranches", err)
@@ -91,17 +134,55 @@ func SearchCommits(ctx *middleware.Context) {
 		return
 	}
 
-	commits, err := ctx.Repo.Commit.SearchCommits(keyword)
+	ctx.Data["Username"] = userName
+	ctx.Data["Reponame"] = repoName
+	if ctx.Data["SearchError"] != nil {
+		ctx.Data["Commits"] = list.New()
+		ctx.HTML(200, COMMITS)
+		return
+	}
+
+	// Message is an extended regular expression that only Git can validate.
+	commitsCount, err := ctx.Repo.Commit.SearchCommitsCount(opts)
 	if err != nil {
-		ctx.Handle(500, "repo.SearchCommits(SearchCommits)", err)
+		if perr, ok := err.(git.ErrInvalidSearchPattern); ok {
+			ctx.Data["SearchError"] = ctx.Tr("repo.commits.invalid_message", perr.Message)
+			ctx.Data["Commits"] = list.New()
+			ctx.HTML(200, COMMITS)
+			return
+		}
+		ctx.Handle(500, "SearchCommitsCount", err)
 		return
 	}
 
-	ctx.Data["Keyword"] = keyword
-	ctx.Data["Username"] = userName
-	ctx.Data["Reponame"] = repoName
-	ctx.Data["CommitCount"] = commits.Len()
+	// Calculate and validate page number.
+	page := com.StrTo(ctx.Query("p")).MustInt()
+	if page < 1 {
+		page = 1
+	}
+	lastPage := page - 1
+	nextPage := page + 1
+	if page*50 >= commitsCount {
+		nextPage = 0
+	}
+
+	commits, err := ctx.Repo.Commit.SearchCommits(opts, page)
+	if err != nil {
+		ctx.Handle(500, "SearchCommits", err)
+		return
+	}
+
+	query := make(url.Values)
+	for _, name := range []string{"q", "message", "author", "committer", "since", "until", "path"} {
+		if len(ctx.Query(name)) > 0 {
+			query.Set(name, ctx.Query(name))
+		}
+	}
+	ctx.Data["SearchLink"] = ctx.Repo.RepoLink + "/commits/" + ctx.Repo.BranchName + "/search?" + query.Encode()
+	ctx.Data["CommitCount"] = commitsCount
 	ctx.Data["Commits"] = commits
+	ctx.Data["LastPageNum"] = lastPage
+	ctx.Data["NextPageNum"] = nextPage
 	ctx.HTML(200, COMMITS)
 }
 
@@ -159,6 +240,12 @@ func Diff(ctx *middleware.Context) {
 	ctx.Data["DiffNotAvailable"] = diff.NumFiles() == 0
 	ctx.Data["SourcePath"] = "/" + path.Join(userName, repoName, "src", commitId)
 	ctx.Data["RawPath"] = "/" + path.Join(userName, repoName, "raw", commitId)
+
+	setDiffViewStyle(ctx)
+	prepareLineComments(ctx, diff, "", commitId, nil)
+	if ctx.Written() {
+		return
+	}
 	ctx.HTML(200, DIFF)
 }
 
@@ -220,9 +307,151 @@ func CompareDiff(ctx *middleware.Context) {
 	ctx.Data["DiffNotAvailable"] = diff.NumFiles() == 0
 	ctx.Data["SourcePath"] = "/" + path.Join(userName, repoName, "src", afterCommitId)
 	ctx.Data["RawPath"] = "/" + path.Join(userName, repoName, "raw", afterCommitId)
+
+	setDiffViewStyle(ctx)
+	prepareLineComments(ctx, diff, beforeCommitId, afterCommitId, commits)
+	if ctx.Written() {
+		return
+	}
 	ctx.HTML(200, DIFF)
 }
 
+// RawDiff writes raw diff or patch of a commit or a compare range,
+// the format depends on extension of the request path.
+func RawDiff(ctx *middleware.Context) {
+	before, after := ctx.Params(":before"), ctx.Params(":after")
+	if len(after) == 0 {
+		after = ctx.Params(":sha")
+	}
+
+	afterCommitId, err := ctx.Repo.GitRepo.GetCommitIdOfRevision(after)
+	if err != nil {
+		ctx.Handle(404, "GetCommitIdOfRevision", err)
+		return
+	}
+	var beforeCommitId string
+	if len(before) > 0 {
+		if beforeCommitId, err = ctx.Repo.GitRepo.GetCommitIdOfRevision(before); err != nil {
+			ctx.Handle(404, "GetCommitIdOfRevision", err)
+			return
+		}
+	}
+
+	ctx.Resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err = models.WriteRawDiff(models.RepoPath(ctx.Repo.Owner.Name, ctx.Repo.Repository.Name),
+		beforeCommitId, afterCommitId, ctx.Params(":ext") == "patch", ctx.Resp); err != nil {
+		// Part of output may have been sent, so only log the error.
+		log.Error(4, "WriteRawDiff: %v", err)
+	}
+}
+
+// setDiffViewStyle sets style of diff view by query parameter "style",
+// the choice is kept in session so later diffs are shown in same style.
+func setDiffViewStyle(ctx *middleware.Context) {
+	style := ctx.Query("style")
+	switch style {
+	case "split", "unified":
+		ctx.Session.Set("diffViewStyle", style)
+	default:
+		style, _ = ctx.Session.Get("diffViewStyle").(string)
+	}
+	ctx.Data["IsSplitStyle"] = style == "split"
+
+	// Keep other query parameters, pages like new pull request depend on them.
+	query := ctx.Req.URL.Query()
+	query.Del("style")
+	link := ctx.Req.URL.Path + "?"
+	if len(query) > 0 {
+		link += query.Encode() + "&"
+	}
+	ctx.Data["DiffStyleLink"] = link + "style="
+}
+
+// prepareLineComments loads line comments of given commits into diff,
+// and sets data that are needed for creating new line comments.
+// Comments of other commits are not loaded, so outdated comments only
+// show up in views of commit ranges such as pull requests.
+func prepareLineComments(ctx *middleware.Context, diff *models.Diff, beforeCommitId, afterCommitId string, commits *list.List) {
+	commitSHAs := []string{afterCommitId}
+	if commits != nil {
+		for e := commits.Front(); e != nil; e = e.Next() {
+			if sha := e.Value.(*git.Commit).Id.String(); sha != afterCommitId {
+				commitSHAs = append(commitSHAs, sha)
+			}
+		}
+	}
+
+	comments, err := models.GetLineComments(ctx.Repo.Repository.Id, commitSHAs)
+	if err != nil {
+		ctx.Handle(500, "GetLineComments", err)
+		return
+	}
+	mdOpts := markdownOptions(ctx)
+	for _, c := range comments {
+		c.Content = string(base.RenderMarkdownWithOptions([]byte(c.Content), mdOpts))
+	}
+	diff.LoadComments(comments)
+
+	ctx.Data["CanLineComment"] = ctx.IsSigned
+	ctx.Data["CommentBeforeId"] = beforeCommitId
+	ctx.Data["CommentCommitId"] = afterCommitId
+	ctx.Data["CommentRedirectTo"] = ctx.Req.URL.Path
+}
+
+func CreateLineComment(ctx *middleware.Context, form auth.CreateLineCommentForm) {
+	if ctx.HasError() {
+		ctx.Handle(400, "CreateLineComment", nil)
+		return
+	}
+
+	// Before commit is passed to Git as an argument, so it must be an existing commit.
+	beforeCommitId := ""
+	if len(form.BeforeCommitId) > 0 {
+		if _, err := git.NewIdFromString(form.BeforeCommitId); err != nil {
+			ctx.Handle(400, "NewIdFromString", err)
+			return
+		}
+		beforeCommit, err := ctx.Repo.GitRepo.GetCommit(form.BeforeCommitId)
+		if err != nil {
+			ctx.Handle(404, "GetCommit", err)
+			return
+		}
+		beforeCommitId = beforeCommit.Id.String()
+	}
+
+	diff, err := models.GetDiffRange(models.RepoPath(ctx.Repo.Owner.Name, ctx.Repo.Repository.Name),
+		beforeCommitId, form.CommitId)
+	if err != nil {
+		ctx.Handle(404, "GetDiffRange", err)
+		return
+	}
+
+	diffFile := diff.GetFile(form.TreePath)
+	if diffFile == nil {
+		ctx.Handle(404, "GetFile", nil)
+		return
+	}
+	diffLine := diffFile.GetLine(form.Line)
+	if diffLine == nil {
+		ctx.Handle(404, "GetLine", models.ErrDiffLineNotExist)
+		return
+	}
+
+	comment, err := models.CreateLineComment(ctx.User.Id, ctx.Repo.Repository.Id, form.CommitId,
+		form.TreePath, form.Line, diffLine.Content[1:], form.Content)
+	if err != nil {
+		ctx.Handle(500, "CreateLineComment", err)
+		return
+	}
+	log.Trace("Line comment created: %d/%d", ctx.Repo.Repository.Id, comment.Id)
+
+	redirectTo := form.RedirectTo
+	if !strings.HasPrefix(redirectTo, ctx.Repo.RepoLink+"/") {
+		redirectTo = ctx.Repo.RepoLink + "/commit/" + form.CommitId
+	}
+	ctx.Redirect(redirectTo + "#diff-comment-" + com.ToStr(comment.Id))
+}
+
 func FileHistory(ctx *middleware.Context) {
 	ctx.Data["IsRepoToolbarCommits"] = true
 
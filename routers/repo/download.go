@@ -5,41 +5,173 @@
 package repo
 
 import (
-	"io"
+	"bytes"
+	"net/http"
+	"os"
 	"path"
+	"strings"
+
+	"github.com/Unknwon/com"
 
 	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/middleware"
 )
 
+// isETagMatched returns true if value of If-None-Match header matches given ETag.
+func isETagMatched(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func SingleDownload(ctx *middleware.Context) {
 	treename := ctx.Params("*")
 
 	blob, err := ctx.Repo.Commit.GetBlobByPath(treename)
 	if err != nil {
-		ctx.Handle(500, "GetBlobByPath", err)
+		if err == git.ErrNotExist {
+			ctx.Handle(404, "GetBlobByPath", nil)
+		} else {
+			ctx.Handle(500, "GetBlobByPath", err)
+		}
+		return
+	}
+
+	// Content of a blob never changes, so its ID is a strong validator.
+	etag := `"` + blob.Id.String() + `"`
+	cacheScope := "public"
+	if ctx.Repo.Repository.IsPrivate {
+		cacheScope = "private"
+	}
+	ctx.Resp.Header().Set("ETag", etag)
+	if ctx.Repo.IsCommit {
+		// Commit never changes, neither do files that are addressed by it.
+		ctx.Resp.Header().Set("Cache-Control", cacheScope+", max-age=31536000, immutable")
+	} else {
+		ctx.Resp.Header().Set("Cache-Control", cacheScope+", no-cache")
+	}
+	if isETagMatched(ctx.Req.Header.Get("If-None-Match"), etag) {
+		ctx.Resp.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	dataRc, err := blob.Data()
+	// Last-Modified follows the file rather than the reference, so it does not change
+	// with pushes that leave the file untouched.
+	lastCommit, err := ctx.Repo.Commit.GetCommitOfRelPath(treename)
 	if err != nil {
-		ctx.Handle(500, "repo.SingleDownload(Data)", err)
+		ctx.Handle(500, "repo.SingleDownload(GetCommitOfRelPath)", err)
 		return
 	}
+	modTime := lastCommit.Committer.When
 
-	buf := make([]byte, 1024)
-	n, _ := dataRc.Read(buf)
-	if n > 0 {
-		buf = buf[:n]
+	// Pointers of LFS objects are replaced by content of objects.
+	_, lfsFile, err := openLFSContentOfBlob(ctx.Repo.Repository.Id, blob)
+	if err != nil {
+		ctx.Handle(500, "repo.SingleDownload(openLFSContentOfBlob)", err)
+		return
+	} else if lfsFile != nil {
+		defer lfsFile.Close()
+
+		buf := make([]byte, 1024)
+		n, _ := lfsFile.Read(buf)
+		if _, err = lfsFile.Seek(0, os.SEEK_SET); err != nil {
+			ctx.Handle(500, "repo.SingleDownload(Seek)", err)
+			return
+		}
+		setSingleDownloadHeaders(ctx, path.Base(treename), buf[:n])
+		http.ServeContent(ctx.Resp, ctx.Req, path.Base(treename), modTime, lfsFile)
+		return
 	}
 
+	// Range requests need random access, so content is read into memory only for them.
+	if len(ctx.Req.Header.Get("Range")) > 0 {
+		data, err := ctx.Repo.GitRepo.GetBlobContent(blob.Id.String())
+		if err != nil {
+			ctx.Handle(500, "repo.SingleDownload(GetBlobContent)", err)
+			return
+		}
+		buf := data
+		if len(buf) > 1024 {
+			buf = buf[:1024]
+		}
+		setSingleDownloadHeaders(ctx, path.Base(treename), buf)
+		http.ServeContent(ctx.Resp, ctx.Req, path.Base(treename), modTime, bytes.NewReader(data))
+		return
+	}
+
+	if size := blob.Size(); size > 0 {
+		ctx.Resp.Header().Set("Content-Length", com.ToStr(size))
+	}
+	ctx.Resp.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	ctx.Resp.Header().Set("Accept-Ranges", "bytes")
+	w := &sniffWriter{ctx: ctx, name: path.Base(treename)}
+	if err = blob.DataPipeline(w); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		if !w.sent {
+			ctx.Handle(500, "repo.SingleDownload(DataPipeline)", err)
+			return
+		}
+		// Headers have been sent, client gets a truncated file.
+		log.Error(4, "SingleDownload(%s): %v", treename, err)
+	}
+}
+
+// sniffWriter holds the first bytes of a streamed file until content headers
+// are decided by them, and writes the rest directly to response.
+type sniffWriter struct {
+	ctx  *middleware.Context
+	name string
+	buf  []byte
+	sent bool
+}
+
+func (w *sniffWriter) Write(p []byte) (int, error) {
+	if w.sent {
+		return w.ctx.Resp.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= 1024 {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sets content headers and writes held bytes, it is also called
+// when the whole file is shorter than bytes needed to decide headers.
+func (w *sniffWriter) Flush() error {
+	if w.sent {
+		return nil
+	}
+	w.sent = true
+
+	head := w.buf
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	setSingleDownloadHeaders(w.ctx, w.name, head)
+	_, err := w.ctx.Resp.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// setSingleDownloadHeaders sets content headers of file by its first bytes,
+// files that browsers cannot display are sent as attachments.
+func setSingleDownloadHeaders(ctx *middleware.Context, name string, buf []byte) {
 	contentType, isTextFile := base.IsTextFile(buf)
 	_, isImageFile := base.IsImageFile(buf)
 	ctx.Resp.Header().Set("Content-Type", contentType)
 	if !isTextFile && !isImageFile {
-		ctx.Resp.Header().Set("Content-Disposition", "attachment; filename="+path.Base(treename))
+		ctx.Resp.Header().Set("Content-Disposition", "attachment; filename="+name)
 		ctx.Resp.Header().Set("Content-Transfer-Encoding", "binary")
 	}
-	ctx.Resp.Write(buf)
-	io.Copy(ctx.Resp, dataRc)
 }
@@ -0,0 +1,368 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/auth"
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/middleware"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+const (
+	EDIT_FILE   base.TplName = "repo/editor/edit"
+	DELETE_FILE base.TplName = "repo/editor/delete"
+	UPLOAD_FILE base.TplName = "repo/editor/upload"
+)
+
+const COMMIT_TO_NEW_BRANCH = "commit-to-new-branch"
+
+// checkEditorAccess makes sure current user has write access
+// and is viewing a branch, which is the only ref that can be edited.
+func checkEditorAccess(ctx *middleware.Context) bool {
+	if !ctx.Repo.IsOwner || !ctx.Repo.IsBranch {
+		ctx.Handle(404, "checkEditorAccess", nil)
+		return false
+	}
+
+	ctx.Data["IsRepoToolbarSource"] = true
+	ctx.Data["LastCommitId"] = ctx.Repo.CommitId
+	return true
+}
+
+// prepareCommitForm sets default values of commit form of editor.
+func prepareCommitForm(ctx *middleware.Context) {
+	ctx.Data["CommitChoice"] = "direct"
+	ctx.Data["NewBranchName"] = ctx.User.Name + "-patch-1"
+}
+
+// getCommitBranch returns the branch that changes should be committed to.
+func getCommitBranch(ctx *middleware.Context, commitChoice, newBranchName string) string {
+	if commitChoice == COMMIT_TO_NEW_BRANCH {
+		return strings.TrimSpace(newBranchName)
+	}
+	return ctx.Repo.BranchName
+}
+
+// buildCommitMessage returns commit message composed by summary and
+// extended description, default summary is used when summary is empty.
+func buildCommitMessage(summary, message, defaultSummary string) string {
+	summary = strings.TrimSpace(summary)
+	if len(summary) == 0 {
+		summary = defaultSummary
+	}
+	message = strings.TrimSpace(message)
+	if len(message) > 0 {
+		summary += "\n\n" + message
+	}
+	return summary
+}
+
+// handleEditorError renders template with a message of known error,
+// unknown errors are handled as internal errors.
+func handleEditorError(ctx *middleware.Context, err error, tpl base.TplName, form interface{}) {
+	var msg string
+	switch err {
+	case models.ErrRepoFileAlreadyExist:
+		msg = ctx.Tr("repo.editor.file_already_exist")
+	case models.ErrRepoFileNotExist:
+		msg = ctx.Tr("repo.editor.file_not_exist")
+	case models.ErrRepoFilePathIllegal:
+		msg = ctx.Tr("repo.editor.file_path_illegal")
+	case models.ErrRepoFileOutdated:
+		msg = ctx.Tr("repo.editor.file_outdated")
+	case models.ErrRepoFileNoChange:
+		msg = ctx.Tr("repo.editor.no_change")
+	case models.ErrReferenceNameIllegal:
+		msg = ctx.Tr("repo.editor.new_branch_illegal")
+	case models.ErrBranchAlreadyExist:
+		msg = ctx.Tr("repo.editor.new_branch_already_exist")
+	case models.ErrBranchNotExist:
+		msg = ctx.Tr("repo.editor.branch_not_exist")
+	default:
+		if perr, ok := err.(models.ErrBranchProtected); ok {
+			msg = protectedBranchMessage(ctx, perr)
+			break
+		}
+		ctx.Handle(500, "handleEditorError", err)
+		return
+	}
+	ctx.RenderWithErr(msg, tpl, form)
+}
+
+// redirectAfterCommit redirects to given path of the branch,
+// or to the page of creating pull request if changes were committed to a new branch.
+func redirectAfterCommit(ctx *middleware.Context, branchName, treeName string) {
+	if branchName != ctx.Repo.BranchName {
+		ctx.Redirect(fmt.Sprintf("%s/pulls/new?base=%s&head=%s", ctx.Repo.RepoLink,
+			url.QueryEscape(ctx.Repo.BranchName), url.QueryEscape(branchName)))
+		return
+	}
+	if treeName == "." || len(treeName) == 0 {
+		ctx.Redirect(ctx.Repo.RepoLink + "/src/" + branchName)
+		return
+	}
+	ctx.Redirect(ctx.Repo.RepoLink + "/src/" + branchName + "/" + treeName)
+}
+
+func editFile(ctx *middleware.Context, isNewFile bool) {
+	if !checkEditorAccess(ctx) {
+		return
+	}
+	ctx.Data["Title"] = "Edit File"
+	ctx.Data["IsNewFile"] = isNewFile
+	prepareCommitForm(ctx)
+
+	treeName := models.CleanTreePath(ctx.Params("*"))
+	if isNewFile {
+		ctx.Data["Title"] = "New File"
+		if len(treeName) > 0 {
+			treeName += "/"
+		}
+		ctx.Data["TreeName"] = treeName
+		ctx.HTML(200, EDIT_FILE)
+		return
+	}
+
+	entry, err := ctx.Repo.Commit.GetTreeEntryByPath(treeName)
+	if err != nil || entry.IsDir() {
+		ctx.Handle(404, "GetTreeEntryByPath", err)
+		return
+	}
+	dataRc, err := entry.Blob().Data()
+	if err != nil {
+		ctx.Handle(500, "Data", err)
+		return
+	}
+	data, err := ioutil.ReadAll(dataRc)
+	if err != nil {
+		ctx.Handle(500, "ReadAll", err)
+		return
+	}
+	if _, isTextFile := base.IsTextFile(data); !isTextFile {
+		ctx.Handle(404, "IsTextFile", nil)
+		return
+	}
+
+	ctx.Data["OldTreeName"] = treeName
+	ctx.Data["TreeName"] = treeName
+	ctx.Data["Content"] = string(data)
+	ctx.HTML(200, EDIT_FILE)
+}
+
+func EditFile(ctx *middleware.Context) {
+	editFile(ctx, false)
+}
+
+func NewFile(ctx *middleware.Context) {
+	editFile(ctx, true)
+}
+
+func editFilePost(ctx *middleware.Context, form auth.EditRepoFileForm, isNewFile bool) {
+	if !checkEditorAccess(ctx) {
+		return
+	}
+	ctx.Data["Title"] = "Edit File"
+	ctx.Data["IsNewFile"] = isNewFile
+
+	oldTreeName := models.CleanTreePath(ctx.Params("*"))
+	if isNewFile {
+		ctx.Data["Title"] = "New File"
+		oldTreeName = ""
+	}
+	ctx.Data["OldTreeName"] = oldTreeName
+
+	if ctx.HasError() {
+		ctx.HTML(200, EDIT_FILE)
+		return
+	}
+
+	branchName := getCommitBranch(ctx, form.CommitChoice, form.NewBranchName)
+	if len(branchName) == 0 {
+		ctx.RenderWithErr(ctx.Tr("repo.editor.new_branch_empty"), EDIT_FILE, &form)
+		return
+	}
+
+	treeName := models.CleanTreePath(form.TreeName)
+	defaultSummary := "Update " + treeName
+	if isNewFile {
+		defaultSummary = "Add " + treeName
+	} else if oldTreeName != treeName {
+		defaultSummary = "Rename " + oldTreeName + " to " + treeName
+	}
+
+	if err := ctx.Repo.Repository.UpdateRepoFile(ctx.User, models.UpdateRepoFileOptions{
+		LastCommitId: form.LastCommitId,
+		OldBranch:    ctx.Repo.BranchName,
+		NewBranch:    branchName,
+		OldTreeName:  oldTreeName,
+		NewTreeName:  form.TreeName,
+		Message:      buildCommitMessage(form.CommitSummary, form.CommitMessage, defaultSummary),
+		Content:      strings.Replace(form.Content, "\r\n", "\n", -1),
+		IsNewFile:    isNewFile,
+	}); err != nil {
+		handleEditorError(ctx, err, EDIT_FILE, &form)
+		return
+	}
+	log.Trace("File updated: %s/%s:%s/%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, branchName, treeName)
+
+	redirectAfterCommit(ctx, branchName, treeName)
+}
+
+func EditFilePost(ctx *middleware.Context, form auth.EditRepoFileForm) {
+	editFilePost(ctx, form, false)
+}
+
+func NewFilePost(ctx *middleware.Context, form auth.EditRepoFileForm) {
+	editFilePost(ctx, form, true)
+}
+
+func DeleteFile(ctx *middleware.Context) {
+	if !checkEditorAccess(ctx) {
+		return
+	}
+	ctx.Data["Title"] = "Delete File"
+	prepareCommitForm(ctx)
+
+	treeName := models.CleanTreePath(ctx.Params("*"))
+	entry, err := ctx.Repo.Commit.GetTreeEntryByPath(treeName)
+	if err != nil || entry.IsDir() {
+		ctx.Handle(404, "GetTreeEntryByPath", err)
+		return
+	}
+
+	ctx.Data["TreeName"] = treeName
+	ctx.HTML(200, DELETE_FILE)
+}
+
+func DeleteFilePost(ctx *middleware.Context, form auth.DeleteRepoFileForm) {
+	if !checkEditorAccess(ctx) {
+		return
+	}
+	ctx.Data["Title"] = "Delete File"
+
+	treeName := models.CleanTreePath(ctx.Params("*"))
+	ctx.Data["TreeName"] = treeName
+
+	if ctx.HasError() {
+		ctx.HTML(200, DELETE_FILE)
+		return
+	}
+
+	branchName := getCommitBranch(ctx, form.CommitChoice, form.NewBranchName)
+	if len(branchName) == 0 {
+		ctx.RenderWithErr(ctx.Tr("repo.editor.new_branch_empty"), DELETE_FILE, &form)
+		return
+	}
+
+	if err := ctx.Repo.Repository.DeleteRepoFile(ctx.User, models.DeleteRepoFileOptions{
+		LastCommitId: form.LastCommitId,
+		OldBranch:    ctx.Repo.BranchName,
+		NewBranch:    branchName,
+		TreeName:     treeName,
+		Message:      buildCommitMessage(form.CommitSummary, form.CommitMessage, "Delete "+treeName),
+	}); err != nil {
+		handleEditorError(ctx, err, DELETE_FILE, &form)
+		return
+	}
+	log.Trace("File deleted: %s/%s:%s/%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, branchName, treeName)
+
+	redirectAfterCommit(ctx, branchName, path.Dir(treeName))
+}
+
+func UploadFile(ctx *middleware.Context) {
+	if !checkEditorAccess(ctx) {
+		return
+	}
+	ctx.Data["Title"] = "Upload Files"
+	ctx.Data["UploadMaxSize"] = setting.RepoUploadMaxSize
+	ctx.Data["UploadMaxFiles"] = setting.RepoUploadMaxFiles
+	prepareCommitForm(ctx)
+
+	ctx.Data["TreeName"] = models.CleanTreePath(ctx.Params("*"))
+	ctx.HTML(200, UPLOAD_FILE)
+}
+
+// checkUploadFiles returns an error message if uploaded files exceed limits.
+func checkUploadFiles(ctx *middleware.Context) string {
+	if ctx.Req.MultipartForm == nil || len(ctx.Req.MultipartForm.File["files"]) == 0 {
+		return ctx.Tr("repo.editor.upload_no_files")
+	}
+
+	files := ctx.Req.MultipartForm.File["files"]
+	if len(files) > setting.RepoUploadMaxFiles {
+		return ctx.Tr("repo.editor.upload_too_many_files", setting.RepoUploadMaxFiles)
+	}
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			return ctx.Tr("repo.editor.upload_cannot_read", header.Filename)
+		}
+		size, err := file.Seek(0, os.SEEK_END)
+		file.Close()
+		if err != nil || size > setting.RepoUploadMaxSize*1024*1024 {
+			return ctx.Tr("repo.editor.upload_too_large", header.Filename, setting.RepoUploadMaxSize)
+		}
+	}
+	return ""
+}
+
+func UploadFilePost(ctx *middleware.Context, form auth.UploadRepoFileForm) {
+	if !checkEditorAccess(ctx) {
+		return
+	}
+	ctx.Data["Title"] = "Upload Files"
+	ctx.Data["UploadMaxSize"] = setting.RepoUploadMaxSize
+	ctx.Data["UploadMaxFiles"] = setting.RepoUploadMaxFiles
+
+	if ctx.HasError() {
+		ctx.HTML(200, UPLOAD_FILE)
+		return
+	}
+
+	if msg := checkUploadFiles(ctx); len(msg) > 0 {
+		ctx.RenderWithErr(msg, UPLOAD_FILE, &form)
+		return
+	}
+
+	branchName := getCommitBranch(ctx, form.CommitChoice, form.NewBranchName)
+	if len(branchName) == 0 {
+		ctx.RenderWithErr(ctx.Tr("repo.editor.new_branch_empty"), UPLOAD_FILE, &form)
+		return
+	}
+
+	treeName := models.CleanTreePath(form.TreeName)
+	files := ctx.Req.MultipartForm.File["files"]
+	defaultSummary := fmt.Sprintf("Upload %d files", len(files))
+	if len(files) == 1 {
+		defaultSummary = "Add " + path.Join(treeName, path.Base(files[0].Filename))
+	} else if len(treeName) > 0 {
+		defaultSummary += " to " + treeName
+	}
+
+	if err := ctx.Repo.Repository.UploadRepoFiles(ctx.User, models.UploadRepoFileOptions{
+		LastCommitId: form.LastCommitId,
+		OldBranch:    ctx.Repo.BranchName,
+		NewBranch:    branchName,
+		TreeName:     form.TreeName,
+		Message:      buildCommitMessage(form.CommitSummary, form.CommitMessage, defaultSummary),
+		Files:        files,
+	}); err != nil {
+		handleEditorError(ctx, err, UPLOAD_FILE, &form)
+		return
+	}
+	log.Trace("Files uploaded: %s/%s:%s/%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, branchName, treeName)
+
+	redirectAfterCommit(ctx, branchName, treeName)
+}
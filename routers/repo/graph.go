@@ -0,0 +1,142 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/middleware"
+)
+
+const (
+	GRAPH base.TplName = "repo/graph"
+
+	GRAPH_PAGE_SIZE = 100
+)
+
+type graphLine struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Color int `json:"color"`
+}
+
+type graphCommit struct {
+	Id          string       `json:"id"`
+	Summary     string       `json:"summary"`
+	AuthorName  string       `json:"author_name"`
+	AuthorEmail string       `json:"author_email"`
+	Avatar      string       `json:"avatar"`
+	When        int64        `json:"when"`
+	Parents     []string     `json:"parents"`
+	Refs        []string     `json:"refs"`
+	Column      int          `json:"column"`
+	Color       int          `json:"color"`
+	Lines       []*graphLine `json:"lines"`
+}
+
+func toGraphLines(lines []*git.GraphLine) []*graphLine {
+	apiLines := make([]*graphLine, len(lines))
+	for i, l := range lines {
+		apiLines[i] = &graphLine{l.From, l.To, l.Color}
+	}
+	return apiLines
+}
+
+// getGraphBranches returns all branches and the one to filter graph by,
+// empty filter means all branches.
+func getGraphBranches(ctx *middleware.Context) ([]string, string, bool) {
+	brs, err := ctx.Repo.GitRepo.GetBranches()
+	if err != nil {
+		ctx.Handle(500, "GetBranches", err)
+		return nil, "", false
+	}
+
+	branch := ctx.Query("branch")
+	if len(branch) > 0 && !ctx.Repo.GitRepo.IsBranchExist(branch) {
+		ctx.Handle(404, "IsBranchExist", nil)
+		return nil, "", false
+	}
+	return brs, branch, true
+}
+
+func Graph(ctx *middleware.Context) {
+	ctx.Data["Title"] = "Graph - " + ctx.Repo.Repository.Name
+	ctx.Data["IsRepoToolbarGraph"] = true
+
+	brs, branch, ok := getGraphBranches(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Data["Branches"] = brs
+	ctx.Data["GraphBranch"] = branch
+	ctx.HTML(200, GRAPH)
+}
+
+// GraphData returns a page of commit graph in JSON for client-side rendering.
+func GraphData(ctx *middleware.Context) {
+	brs, branch, ok := getGraphBranches(ctx)
+	if !ok {
+		return
+	}
+
+	var revs []string
+	if len(branch) > 0 {
+		revs = []string{branch}
+	}
+	page, _ := com.StrTo(ctx.Query("p")).Int()
+	if page < 1 {
+		page = 1
+	}
+
+	graph, err := ctx.Repo.GitRepo.GetCommitGraph(revs, page, GRAPH_PAGE_SIZE)
+	if err != nil {
+		ctx.Handle(500, "GetCommitGraph", err)
+		return
+	}
+
+	// Branch labels of commits.
+	refs := make(map[string][]string)
+	for _, br := range brs {
+		id, err := ctx.Repo.GitRepo.GetCommitIdOfBranch(br)
+		if err != nil {
+			ctx.Handle(500, "GetCommitIdOfBranch", err)
+			return
+		}
+		refs[id] = append(refs[id], br)
+	}
+
+	commits := make([]*graphCommit, len(graph.Rows))
+	for i, row := range graph.Rows {
+		c := row.Commit
+		parents := make([]string, c.ParentCount())
+		for n := range parents {
+			id, _ := c.ParentId(n)
+			parents[n] = id.String()
+		}
+		commits[i] = &graphCommit{
+			Id:          c.Id.String(),
+			Summary:     c.Summary(),
+			AuthorName:  c.Author.Name,
+			AuthorEmail: c.Author.Email,
+			Avatar:      base.AvatarLink(c.Author.Email),
+			When:        c.Author.When.Unix(),
+			Parents:     parents,
+			Refs:        refs[c.Id.String()],
+			Column:      row.Column,
+			Color:       row.Color,
+			Lines:       toGraphLines(row.Lines),
+		}
+	}
+
+	ctx.JSON(200, map[string]interface{}{
+		"page":     page,
+		"has_more": graph.HasMore,
+		"incoming": toGraphLines(graph.Incoming),
+		"commits":  commits,
+	})
+}
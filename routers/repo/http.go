@@ -21,6 +21,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Unknwon/com"
+
 	"github.com/gogits/gogs/models"
 	"github.com/gogits/gogs/modules/base"
 	"github.com/gogits/gogs/modules/log"
@@ -55,12 +57,61 @@ func authRequired(ctx *middleware.Context) {
 	ctx.HTML(401, base.TplName("status/401"))
 }
 
+// httpBasicAuth returns the user whose credentials are given in basic authorization header.
+func httpBasicAuth(ctx *middleware.Context) (*models.User, error) {
+	auths := strings.Fields(ctx.Req.Header.Get("Authorization"))
+	// currently check basic auth
+	// TODO: support digit auth
+	if len(auths) != 2 || auths[0] != "Basic" {
+		return nil, errors.New("no basic auth")
+	}
+	authUsername, passwd, err := basicDecode(auths[1])
+	if err != nil {
+		return nil, err
+	}
+
+	authUser, err := models.GetUserByName(authUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	newUser := &models.User{Passwd: passwd, Salt: authUser.Salt}
+	newUser.EncodePasswd()
+	if authUser.Passwd != newUser.Passwd {
+		return nil, models.ErrUserNotExist
+	}
+	return authUser, nil
+}
+
+// hasRepoAccess returns true if user can pull from or push to repository,
+// users who can push are always allowed to pull.
+func hasRepoAccess(u *models.User, username, reponame string, isPull bool) (bool, error) {
+	var tp = models.WRITABLE
+	if isPull {
+		tp = models.READABLE
+	}
+
+	has, err := models.HasAccess(u.Name, username+"/"+reponame, tp)
+	if err != nil {
+		return false, err
+	} else if !has && tp == models.READABLE {
+		return models.HasAccess(u.Name, username+"/"+reponame, models.WRITABLE)
+	}
+	return has, nil
+}
+
 func Http(ctx *middleware.Context) {
 	username := ctx.Params(":username")
 	reponame := ctx.Params(":reponame")
 	if strings.HasSuffix(reponame, ".git") {
 		reponame = reponame[:len(reponame)-4]
 	}
+	// Wiki of repository is served as "<reponame>.wiki.git" with same access rules.
+	isWiki := false
+	if strings.HasSuffix(reponame, ".wiki") {
+		isWiki = true
+		reponame = reponame[:len(reponame)-5]
+	}
 
 	var isPull bool
 	service := ctx.Query("service")
@@ -98,67 +149,38 @@ func Http(ctx *middleware.Context) {
 	isPublicPull := !repo.IsPrivate && isPull
 	var askAuth = !isPublicPull || setting.Service.RequireSignInView
 	var authUser *models.User
-	var authUsername, passwd string
 
 	// check access
 	if askAuth {
-		baHead := ctx.Req.Header.Get("Authorization")
-		if baHead == "" {
+		if ctx.Req.Header.Get("Authorization") == "" {
 			authRequired(ctx)
 			return
 		}
 
-		auths := strings.Fields(baHead)
-		// currently check basic auth
-		// TODO: support digit auth
-		if len(auths) != 2 || auths[0] != "Basic" {
-			ctx.Handle(401, "no basic auth and digit auth", nil)
-			return
-		}
-		authUsername, passwd, err = basicDecode(auths[1])
-		if err != nil {
-			ctx.Handle(401, "no basic auth and digit auth", nil)
-			return
-		}
-
-		authUser, err = models.GetUserByName(authUsername)
+		authUser, err = httpBasicAuth(ctx)
 		if err != nil {
 			ctx.Handle(401, "no basic auth and digit auth", nil)
 			return
 		}
 
-		newUser := &models.User{Passwd: passwd, Salt: authUser.Salt}
-		newUser.EncodePasswd()
-		if authUser.Passwd != newUser.Passwd {
-			ctx.Handle(401, "no basic auth and digit auth", nil)
-			return
-		}
-
 		if !isPublicPull {
-			var tp = models.WRITABLE
-			if isPull {
-				tp = models.READABLE
-			}
-
-			has, err := models.HasAccess(authUsername, username+"/"+reponame, tp)
-			if err != nil {
+			has, err := hasRepoAccess(authUser, username, reponame, isPull)
+			if err != nil || !has {
 				ctx.Handle(401, "no basic auth and digit auth", nil)
 				return
-			} else if !has {
-				if tp == models.READABLE {
-					has, err = models.HasAccess(authUsername, username+"/"+reponame, models.WRITABLE)
-					if err != nil || !has {
-						ctx.Handle(401, "no basic auth and digit auth", nil)
-						return
-					}
-				} else {
-					ctx.Handle(401, "no basic auth and digit auth", nil)
-					return
-				}
 			}
 		}
 	}
 
+	// First push to wiki creates it.
+	if isWiki && !isPull {
+		repo.Owner = repoUser
+		if err = repo.InitWiki(); err != nil {
+			ctx.Handle(500, "InitWiki", err)
+			return
+		}
+	}
+
 	var f func(rpc string, input []byte)
 
 	f = func(rpc string, input []byte) {
@@ -190,7 +212,7 @@ func Http(ctx *middleware.Context) {
 						newCommitId := fields[1]
 						refName := fields[2]
 
-						models.Update(refName, oldCommitId, newCommitId, authUsername, username, reponame, authUser.Id)
+						models.Update(refName, oldCommitId, newCommitId, authUser.Name, username, reponame, authUser.Id)
 					}
 					lastLine = lastLine + size
 				} else {
@@ -200,7 +222,22 @@ func Http(ctx *middleware.Context) {
 		}
 	}
 
-	config := Config{setting.RepoRootPath, "git", true, true, f}
+	// Pass pusher information to update hook for checking protected branches.
+	var env []string
+	if authUser != nil {
+		env = []string{
+			models.ENV_AUTH_USER_ID + "=" + com.ToStr(authUser.Id),
+			models.ENV_REPO_OWNER_NAME + "=" + username,
+			models.ENV_REPO_NAME + "=" + reponame,
+		}
+	}
+
+	// Pushes to wiki do not go through update process of repository.
+	if isWiki {
+		f = nil
+	}
+
+	config := Config{setting.RepoRootPath, "git", true, true, env, f}
 
 	handler := HttpBackend(&config)
 	handler(ctx.Resp, ctx.Req)
@@ -217,6 +254,7 @@ type Config struct {
 	GitBinPath  string
 	UploadPack  bool
 	ReceivePack bool
+	Env         []string
 	OnSucceed   func(rpc string, input []byte)
 }
 
@@ -305,6 +343,7 @@ func serviceRpc(rpc string, hr handler) {
 	args := []string{rpc, "--stateless-rpc", dir}
 	cmd := exec.Command(hr.Config.GitBinPath, args...)
 	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), hr.Config.Env...)
 	cmd.Stdout = w
 	cmd.Stdin = br
 
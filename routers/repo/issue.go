@@ -40,6 +40,22 @@ var (
 	ErrTooManyFiles      = errors.New("Maximum number of files to upload exceeded")
 )
 
+// markdownOptions returns options to render Markdown content of current repository,
+// commit SHAs are only linked when they refer to commits of the repository.
+func markdownOptions(ctx *middleware.Context) *base.MarkdownOptions {
+	opts := &base.MarkdownOptions{UrlPrefix: ctx.Repo.RepoLink}
+	if ctx.Repo.GitRepo != nil {
+		opts.GetFullCommitId = func(shortId string) string {
+			id, err := ctx.Repo.GitRepo.GetFullCommitId(shortId)
+			if err != nil {
+				return ""
+			}
+			return id
+		}
+	}
+	return opts
+}
+
 func Issues(ctx *middleware.Context) {
 	ctx.Data["Title"] = "Issues"
 	ctx.Data["IsRepoToolbarIssues"] = true
@@ -235,7 +251,7 @@ func CreateIssuePost(ctx *middleware.Context, form auth.CreateIssueForm) {
 	}
 	issue := &models.Issue{
 		RepoId:      ctx.Repo.Repository.Id,
-		Index:       int64(ctx.Repo.Repository.NumIssues) + 1,
+		Index:       ctx.Repo.Repository.NextIssueIndex(),
 		Name:        form.IssueName,
 		PosterId:    ctx.User.Id,
 		MilestoneId: form.MilestoneId,
@@ -327,8 +343,6 @@ func checkLabels(labels, allLabels []*models.Label) {
 }
 
 func ViewIssue(ctx *middleware.Context) {
-	ctx.Data["AttachmentsEnabled"] = setting.AttachmentEnabled
-
 	idx := com.StrTo(ctx.Params(":index")).MustInt64()
 	if idx == 0 {
 		ctx.Handle(404, "issue.ViewIssue", nil)
@@ -343,9 +357,27 @@ func ViewIssue(ctx *middleware.Context) {
 			ctx.Handle(500, "issue.ViewIssue(GetIssueByIndex)", err)
 		}
 		return
+	} else if issue.IsPull {
+		ctx.Redirect(fmt.Sprintf("%s/pulls/%d", ctx.Repo.RepoLink, issue.Index))
+		return
 	}
 
+	prepareIssueView(ctx, issue)
+	if ctx.Written() {
+		return
+	}
+	ctx.Data["IsRepoToolbarIssues"] = true
+	ctx.Data["IsRepoToolbarIssuesList"] = false
+	ctx.HTML(200, ISSUE_VIEW)
+}
+
+// prepareIssueView loads all information that is needed to render
+// the view page of an issue or a pull request.
+func prepareIssueView(ctx *middleware.Context, issue *models.Issue) {
+	ctx.Data["AttachmentsEnabled"] = setting.AttachmentEnabled
+
 	// Get labels.
+	var err error
 	if err = issue.GetLabels(); err != nil {
 		ctx.Handle(500, "issue.ViewIssue(GetLabels)", err)
 		return
@@ -406,7 +438,7 @@ func ViewIssue(ctx *middleware.Context) {
 		ctx.Handle(500, "issue.ViewIssue(GetAssignee): %v", err)
 		return
 	}
-	issue.RenderedContent = string(base.RenderMarkdown([]byte(issue.Content), ctx.Repo.RepoLink))
+	issue.RenderedContent = string(base.RenderMarkdownWithOptions([]byte(issue.Content), markdownOptions(ctx)))
 
 	// Get comments.
 	comments, err := models.GetIssueComments(issue.Id)
@@ -416,6 +448,7 @@ func ViewIssue(ctx *middleware.Context) {
 	}
 
 	// Get posters.
+	mdOpts := markdownOptions(ctx)
 	for i := range comments {
 		u, err := models.GetUserById(comments[i].PosterId)
 		if err != nil {
@@ -425,7 +458,7 @@ func ViewIssue(ctx *middleware.Context) {
 		comments[i].Poster = u
 
 		if comments[i].Type == models.COMMENT {
-			comments[i].Content = string(base.RenderMarkdown([]byte(comments[i].Content), ctx.Repo.RepoLink))
+			comments[i].Content = string(base.RenderMarkdownWithOptions([]byte(comments[i].Content), mdOpts))
 		}
 	}
 
@@ -435,9 +468,6 @@ func ViewIssue(ctx *middleware.Context) {
 	ctx.Data["Issue"] = issue
 	ctx.Data["Comments"] = comments
 	ctx.Data["IsIssueOwner"] = ctx.Repo.IsOwner || (ctx.IsSigned && issue.PosterId == ctx.User.Id)
-	ctx.Data["IsRepoToolbarIssues"] = true
-	ctx.Data["IsRepoToolbarIssuesList"] = false
-	ctx.HTML(200, ISSUE_VIEW)
 }
 
 func UpdateIssue(ctx *middleware.Context, form auth.CreateIssueForm) {
@@ -479,7 +509,7 @@ func UpdateIssue(ctx *middleware.Context, form auth.CreateIssueForm) {
 	ctx.JSON(200, map[string]interface{}{
 		"ok":      true,
 		"title":   issue.Name,
-		"content": string(base.RenderMarkdown([]byte(issue.Content), ctx.Repo.RepoLink)),
+		"content": string(base.RenderMarkdownWithOptions([]byte(issue.Content), markdownOptions(ctx))),
 	})
 }
 
@@ -865,6 +895,10 @@ func Comment(ctx *middleware.Context) {
 		}
 	}
 
+	if issue.IsPull {
+		send(200, fmt.Sprintf("%s/pulls/%d", ctx.Repo.RepoLink, index), nil)
+		return
+	}
 	send(200, fmt.Sprintf("%s/issues/%d", ctx.Repo.RepoLink, index), nil)
 }
 
@@ -0,0 +1,371 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/lfs"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/middleware"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+const (
+	LFS_CONTENT_TYPE   = "application/vnd.git-lfs+json"
+	LFS_TRANSFER_BASIC = "basic"
+)
+
+type lfsObject struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers,omitempty"`
+	Objects   []*lfsObject `json:"objects"`
+}
+
+type lfsLink struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lfsObjectResponse struct {
+	Oid           string              `json:"oid"`
+	Size          int64               `json:"size"`
+	Authenticated bool                `json:"authenticated,omitempty"`
+	Actions       map[string]*lfsLink `json:"actions,omitempty"`
+	Error         *lfsObjectError     `json:"error,omitempty"`
+}
+
+type lfsBatchResponse struct {
+	Transfer string               `json:"transfer"`
+	Objects  []*lfsObjectResponse `json:"objects"`
+}
+
+func lfsJSON(ctx *middleware.Context, status int, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		ctx.Handle(500, "json.Marshal", err)
+		return
+	}
+	ctx.Resp.Header().Set("Content-Type", LFS_CONTENT_TYPE)
+	ctx.Resp.WriteHeader(status)
+	ctx.Resp.Write(data)
+}
+
+func lfsError(ctx *middleware.Context, status int, msg string) {
+	if status == 401 {
+		ctx.Resp.Header().Set("WWW-Authenticate", "Basic realm=\".\"")
+	}
+	lfsJSON(ctx, status, map[string]string{"message": msg})
+}
+
+// lfsRepoAssignment returns the repository that request is made to if requester
+// is allowed to perform operation, it writes the error response otherwise.
+// Besides basic authorization, tokens issued by serv command are accepted.
+func lfsRepoAssignment(ctx *middleware.Context, operation string) (*models.Repository, bool) {
+	username := ctx.Params(":username")
+	reponame := strings.TrimSuffix(ctx.Params(":reponame"), ".git")
+
+	repoUser, err := models.GetUserByName(username)
+	if err != nil {
+		if err == models.ErrUserNotExist {
+			lfsError(ctx, 404, "Repository does not exist")
+		} else {
+			log.Error(4, "GetUserByName: %v", err)
+			lfsError(ctx, 500, "Internal server error")
+		}
+		return nil, false
+	}
+	repo, err := models.GetRepositoryByName(repoUser.Id, reponame)
+	if err != nil {
+		if err == models.ErrRepoNotExist {
+			lfsError(ctx, 404, "Repository does not exist")
+		} else {
+			log.Error(4, "GetRepositoryByName: %v", err)
+			lfsError(ctx, 500, "Internal server error")
+		}
+		return nil, false
+	}
+	repo.Owner = repoUser
+
+	// only public download don't need auth
+	isPull := operation == models.LFS_OPERATION_DOWNLOAD
+	isPublicPull := isPull && !repo.IsPrivate
+	if isPublicPull && !setting.Service.RequireSignInView {
+		return repo, true
+	}
+
+	var authUser *models.User
+	auths := strings.Fields(ctx.Req.Header.Get("Authorization"))
+	if len(auths) == 2 && auths[0] == "Bearer" {
+		authUser, err = models.VerifyLFSToken(auths[1], repo.Id, operation)
+	} else {
+		authUser, err = httpBasicAuth(ctx)
+	}
+	if err != nil {
+		lfsError(ctx, 401, "Credentials needed")
+		return nil, false
+	} else if isPublicPull {
+		return repo, true
+	}
+
+	has, err := hasRepoAccess(authUser, username, reponame, isPull)
+	if err != nil {
+		log.Error(4, "hasRepoAccess: %v", err)
+		lfsError(ctx, 500, "Internal server error")
+		return nil, false
+	} else if !has {
+		lfsError(ctx, 403, "Access denied")
+		return nil, false
+	}
+	return repo, true
+}
+
+// getLFSMetaObject returns LFS object of given OID that is stored and linked to
+// repository, it writes the error response if there is no such object.
+func getLFSMetaObject(ctx *middleware.Context, repoId int64, oid string) (*models.LFSMetaObject, bool) {
+	meta, err := models.GetLFSMetaObjectByOid(repoId, oid)
+	if err != nil {
+		if err == models.ErrLFSObjectNotExist {
+			lfsError(ctx, 404, "Object does not exist")
+		} else {
+			log.Error(4, "GetLFSMetaObjectByOid: %v", err)
+			lfsError(ctx, 500, "Internal server error")
+		}
+		return nil, false
+	}
+	if !models.LFSContentStore().Exists(meta.Pointer()) {
+		lfsError(ctx, 404, "Object does not exist")
+		return nil, false
+	}
+	return meta, true
+}
+
+// LFSBatch tells client where to download or upload requested objects.
+func LFSBatch(ctx *middleware.Context) {
+	req := new(lfsBatchRequest)
+	if err := json.NewDecoder(ctx.Req.Body).Decode(req); err != nil {
+		lfsError(ctx, 422, "Invalid request")
+		return
+	}
+	if req.Operation != models.LFS_OPERATION_DOWNLOAD && req.Operation != models.LFS_OPERATION_UPLOAD {
+		lfsError(ctx, 422, "Invalid operation")
+		return
+	}
+	if len(req.Transfers) > 0 {
+		isSupported := false
+		for _, transfer := range req.Transfers {
+			if transfer == LFS_TRANSFER_BASIC {
+				isSupported = true
+				break
+			}
+		}
+		if !isSupported {
+			lfsError(ctx, 422, "Only basic transfer is supported")
+			return
+		}
+	}
+
+	repo, ok := lfsRepoAssignment(ctx, req.Operation)
+	if !ok {
+		return
+	}
+
+	// Client sends the same authorization to the links.
+	var header map[string]string
+	if auth := ctx.Req.Header.Get("Authorization"); len(auth) > 0 {
+		header = map[string]string{"Authorization": auth}
+	}
+	linkPrefix := setting.AppUrl + repo.Owner.Name + "/" + repo.Name + ".git/info/lfs"
+
+	store := models.LFSContentStore()
+	objects := make([]*lfsObjectResponse, 0, len(req.Objects))
+	for _, obj := range req.Objects {
+		resp := &lfsObjectResponse{
+			Oid:           obj.Oid,
+			Size:          obj.Size,
+			Authenticated: true,
+		}
+		objects = append(objects, resp)
+		if !lfs.IsValidOid(obj.Oid) || obj.Size < 0 {
+			resp.Error = &lfsObjectError{422, "Invalid object"}
+			continue
+		}
+
+		meta, err := models.GetLFSMetaObjectByOid(repo.Id, obj.Oid)
+		if err != nil && err != models.ErrLFSObjectNotExist {
+			log.Error(4, "GetLFSMetaObjectByOid: %v", err)
+			lfsError(ctx, 500, "Internal server error")
+			return
+		}
+		exists := meta != nil && store.Exists(meta.Pointer())
+
+		if req.Operation == models.LFS_OPERATION_DOWNLOAD {
+			if !exists {
+				resp.Error = &lfsObjectError{404, "Object does not exist"}
+				continue
+			}
+			resp.Size = meta.Size
+			resp.Actions = map[string]*lfsLink{
+				"download": {Href: linkPrefix + "/objects/" + obj.Oid, Header: header},
+			}
+		} else if !exists {
+			// Objects that are already linked to repository need no upload.
+			resp.Actions = map[string]*lfsLink{
+				"upload": {Href: linkPrefix + "/objects/" + obj.Oid, Header: header},
+				"verify": {Href: linkPrefix + "/verify", Header: header},
+			}
+		}
+	}
+
+	lfsJSON(ctx, 200, &lfsBatchResponse{
+		Transfer: LFS_TRANSFER_BASIC,
+		Objects:  objects,
+	})
+}
+
+// LFSDownload sends content of an object.
+func LFSDownload(ctx *middleware.Context) {
+	repo, ok := lfsRepoAssignment(ctx, models.LFS_OPERATION_DOWNLOAD)
+	if !ok {
+		return
+	}
+	meta, ok := getLFSMetaObject(ctx, repo.Id, ctx.Params(":oid"))
+	if !ok {
+		return
+	}
+
+	f, err := models.LFSContentStore().Get(meta.Pointer())
+	if err != nil {
+		if os.IsNotExist(err) {
+			lfsError(ctx, 404, "Object does not exist")
+		} else {
+			log.Error(4, "ContentStore.Get(%s): %v", meta.Oid, err)
+			lfsError(ctx, 500, "Internal server error")
+		}
+		return
+	}
+	defer f.Close()
+
+	ctx.Resp.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(ctx.Resp, ctx.Req, meta.Oid, meta.Created, f)
+}
+
+// LFSUpload receives content of an object and links it to repository.
+func LFSUpload(ctx *middleware.Context) {
+	repo, ok := lfsRepoAssignment(ctx, models.LFS_OPERATION_UPLOAD)
+	if !ok {
+		return
+	}
+
+	p := &lfs.Pointer{
+		Oid:  ctx.Params(":oid"),
+		Size: ctx.Req.ContentLength,
+	}
+	if !lfs.IsValidOid(p.Oid) {
+		lfsError(ctx, 422, "Invalid object")
+		return
+	} else if p.Size < 0 {
+		lfsError(ctx, 411, "Content length is required")
+		return
+	}
+
+	// Content is always received even if it has been stored for other repositories,
+	// so that one cannot get an object linked without having its content.
+	if err := models.LFSContentStore().Put(p, ctx.Req.Body); err != nil {
+		if err == lfs.ErrHashMismatch || err == lfs.ErrSizeMismatch {
+			lfsError(ctx, 422, err.Error())
+		} else {
+			log.Error(4, "ContentStore.Put(%s): %v", p.Oid, err)
+			lfsError(ctx, 500, "Internal server error")
+		}
+		return
+	}
+
+	if err := models.NewLFSMetaObject(&models.LFSMetaObject{
+		Oid:    p.Oid,
+		Size:   p.Size,
+		RepoId: repo.Id,
+	}); err != nil {
+		log.Error(4, "NewLFSMetaObject: %v", err)
+		lfsError(ctx, 500, "Internal server error")
+		return
+	}
+	ctx.Resp.WriteHeader(200)
+}
+
+// LFSVerify checks if an object has been uploaded completely.
+func LFSVerify(ctx *middleware.Context) {
+	obj := new(lfsObject)
+	if err := json.NewDecoder(ctx.Req.Body).Decode(obj); err != nil {
+		lfsError(ctx, 422, "Invalid request")
+		return
+	}
+
+	repo, ok := lfsRepoAssignment(ctx, models.LFS_OPERATION_UPLOAD)
+	if !ok {
+		return
+	}
+	meta, ok := getLFSMetaObject(ctx, repo.Id, obj.Oid)
+	if !ok {
+		return
+	} else if meta.Size != obj.Size {
+		lfsError(ctx, 422, "Object size does not match")
+		return
+	}
+	ctx.Resp.WriteHeader(200)
+}
+
+// openLFSContentOfBlob opens content of LFS object if blob is a pointer to an object
+// that is available in repository, it returns nil file otherwise.
+func openLFSContentOfBlob(repoId int64, blob *git.Blob) (*models.LFSMetaObject, *os.File, error) {
+	if !setting.LFSStartServer || blob.Size() > lfs.POINTER_MAX_SIZE {
+		return nil, nil, nil
+	}
+
+	dataRc, err := blob.Data()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(dataRc)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := lfs.ReadPointer(data)
+	if p == nil {
+		return nil, nil, nil
+	}
+
+	meta, err := models.GetLFSMetaObjectByOid(repoId, p.Oid)
+	if err != nil {
+		if err == models.ErrLFSObjectNotExist {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	f, err := models.LFSContentStore().Get(meta.Pointer())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return meta, f, nil
+}
@@ -5,15 +5,478 @@
 package repo
 
 import (
+	"container/list"
+	"fmt"
+	"path"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/auth"
 	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
 	"github.com/gogits/gogs/modules/middleware"
 )
 
 const (
-	PULLS base.TplName = "repo/pulls"
+	PULLS             base.TplName = "repo/pull/list"
+	PULL_NEW          base.TplName = "repo/pull/new"
+	PULL_VIEW_COMMITS base.TplName = "repo/pull/commits"
+	PULL_VIEW_FILES   base.TplName = "repo/pull/files"
 )
 
 func Pulls(ctx *middleware.Context) {
+	ctx.Data["Title"] = "Pull Requests"
 	ctx.Data["IsRepoToolbarPulls"] = true
+
+	isShowClosed := ctx.Query("state") == "closed"
+	page, _ := com.StrTo(ctx.Query("page")).Int()
+	if page <= 0 {
+		page = 1
+	}
+
+	pulls, err := models.GetPulls(ctx.Repo.Repository.Id, page, isShowClosed)
+	if err != nil {
+		ctx.Handle(500, "GetPulls", err)
+		return
+	}
+	for i := range pulls {
+		if err = pulls[i].GetPoster(); err != nil {
+			ctx.Handle(500, "GetPoster", fmt.Errorf("[#%d]%v", pulls[i].Id, err))
+			return
+		}
+	}
+
+	ctx.Data["Pulls"] = pulls
+	ctx.Data["IsShowClosed"] = isShowClosed
+	if isShowClosed {
+		ctx.Data["State"] = "closed"
+	}
 	ctx.HTML(200, PULLS)
 }
+
+// setDiffData sets data that are needed by diff box of given commit and diff.
+func setDiffData(ctx *middleware.Context, repoLink string, commit *git.Commit, diff *models.Diff) {
+	ctx.Data["IsImageFile"] = func(name string) bool {
+		blob, err := commit.GetBlobByPath(name)
+		if err != nil {
+			return false
+		}
+
+		dataRc, err := blob.Data()
+		if err != nil {
+			return false
+		}
+		buf := make([]byte, 1024)
+		n, _ := dataRc.Read(buf)
+		if n > 0 {
+			buf = buf[:n]
+		}
+		_, isImage := base.IsImageFile(buf)
+		return isImage
+	}
+	ctx.Data["Diff"] = diff
+	ctx.Data["DiffNotAvailable"] = diff.NumFiles() == 0
+	ctx.Data["SourcePath"] = path.Join(repoLink, "src", commit.Id.String())
+	ctx.Data["RawPath"] = path.Join(repoLink, "raw", commit.Id.String())
+	setDiffViewStyle(ctx)
+}
+
+// canReadHeadRepo returns true if current user can read given fork,
+// forks can be private even if base repository is public.
+func canReadHeadRepo(ctx *middleware.Context, fork *models.Repository) (bool, error) {
+	if !fork.IsPrivate {
+		return true, nil
+	} else if !ctx.IsSigned {
+		return false, nil
+	}
+	return models.HasAccess(ctx.User.Name, fork.Owner.Name+"/"+fork.Name, models.READABLE)
+}
+
+// getHeadRepos returns all repositories that can be head of a pull request,
+// which are base repository itself and its forks that current user can read.
+func getHeadRepos(ctx *middleware.Context) ([]*models.Repository, error) {
+	forks, err := models.GetForks(ctx.Repo.Repository)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Repo.Repository.Owner = ctx.Repo.Owner
+
+	repos := make([]*models.Repository, 1, len(forks)+1)
+	repos[0] = ctx.Repo.Repository
+	for _, fork := range forks {
+		has, err := canReadHeadRepo(ctx, fork)
+		if err != nil {
+			return nil, err
+		} else if has {
+			repos = append(repos, fork)
+		}
+	}
+	return repos, nil
+}
+
+// getHeadRepo returns head repository of a pull request by given full name,
+// it must be base repository itself or one of its forks.
+func getHeadRepo(ctx *middleware.Context, fullName string) (*models.Repository, error) {
+	if len(fullName) == 0 || fullName == ctx.Repo.Owner.Name+"/"+ctx.Repo.Repository.Name {
+		ctx.Repo.Repository.Owner = ctx.Repo.Owner
+		return ctx.Repo.Repository, nil
+	}
+
+	headRepo, err := models.GetRepositoryByRef(fullName)
+	if err != nil {
+		if err == models.ErrUserNotExist || err == models.ErrInvalidReference {
+			return nil, models.ErrRepoNotExist
+		}
+		return nil, err
+	} else if headRepo.ForkId != ctx.Repo.Repository.Id {
+		return nil, models.ErrRepoNotExist
+	}
+	if err = headRepo.GetOwner(); err != nil {
+		return nil, err
+	}
+
+	// Private fork is reported as not existing to users who cannot read it.
+	if has, err := canReadHeadRepo(ctx, headRepo); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, models.ErrRepoNotExist
+	}
+	return headRepo, nil
+}
+
+// parseCompareInfo prepares all information of comparing base and head branches
+// to create a new pull request.
+func parseCompareInfo(ctx *middleware.Context, headRepoName, baseBranch, headBranch string) (*models.Repository, *git.PullRequestInfo) {
+	headRepo, err := getHeadRepo(ctx, headRepoName)
+	if err != nil {
+		if err == models.ErrRepoNotExist {
+			ctx.Handle(404, "getHeadRepo", err)
+		} else {
+			ctx.Handle(500, "getHeadRepo", err)
+		}
+		return nil, nil
+	}
+
+	headRepoPath := models.RepoPath(headRepo.Owner.Name, headRepo.Name)
+	headGitRepo, err := git.OpenRepository(headRepoPath)
+	if err != nil {
+		ctx.Handle(500, "OpenRepository", err)
+		return nil, nil
+	}
+
+	if !ctx.Repo.GitRepo.IsBranchExist(baseBranch) || !headGitRepo.IsBranchExist(headBranch) {
+		ctx.Handle(404, "IsBranchExist", nil)
+		return nil, nil
+	}
+
+	prInfo, err := headGitRepo.GetPullRequestInfo(models.RepoPath(ctx.Repo.Owner.Name, ctx.Repo.Repository.Name),
+		baseBranch, headBranch)
+	if err != nil {
+		ctx.Handle(500, "GetPullRequestInfo", err)
+		return nil, nil
+	}
+
+	headCommitId, err := headGitRepo.GetCommitIdOfBranch(headBranch)
+	if err != nil {
+		ctx.Handle(500, "GetCommitIdOfBranch", err)
+		return nil, nil
+	}
+	headCommit, err := headGitRepo.GetCommit(headCommitId)
+	if err != nil {
+		ctx.Handle(500, "GetCommit", err)
+		return nil, nil
+	}
+
+	diff, err := models.GetDiffRange(headRepoPath, prInfo.MergeBase, headCommitId)
+	if err != nil {
+		ctx.Handle(500, "GetDiffRange", err)
+		return nil, nil
+	}
+	setDiffData(ctx, "/"+headRepo.Owner.Name+"/"+headRepo.Name, headCommit, diff)
+
+	ctx.Data["HeadRepo"] = headRepo
+	ctx.Data["BaseBranch"] = baseBranch
+	ctx.Data["HeadBranch"] = headBranch
+	ctx.Data["Commits"] = prInfo.Commits
+	ctx.Data["CommitCount"] = prInfo.Commits.Len()
+	ctx.Data["Username"] = headRepo.Owner.Name
+	ctx.Data["Reponame"] = headRepo.Name
+	return headRepo, prInfo
+}
+
+func NewPullRequest(ctx *middleware.Context) {
+	ctx.Data["Title"] = "New Pull Request"
+	ctx.Data["IsRepoToolbarPulls"] = true
+
+	brs, err := ctx.Repo.GitRepo.GetBranches()
+	if err != nil {
+		ctx.Handle(500, "GetBranches", err)
+		return
+	}
+	ctx.Data["Branches"] = brs
+	ctx.Data["HeadRepos"], err = getHeadRepos(ctx)
+	if err != nil {
+		ctx.Handle(500, "getHeadRepos", err)
+		return
+	}
+
+	baseBranch := ctx.Query("base")
+	headBranch := ctx.Query("head")
+	ctx.Data["HeadRepoName"] = ctx.Query("head_repo")
+	if len(baseBranch) == 0 || len(headBranch) == 0 {
+		ctx.HTML(200, PULL_NEW)
+		return
+	}
+	ctx.Data["IsCompared"] = true
+
+	headRepo, prInfo := parseCompareInfo(ctx, ctx.Query("head_repo"), baseBranch, headBranch)
+	if ctx.Written() {
+		return
+	}
+	ctx.Data["IsNothingToCompare"] = prInfo.Commits.Len() == 0
+
+	pr, err := models.GetUnmergedPullRequest(headRepo.Id, ctx.Repo.Repository.Id, headBranch, baseBranch)
+	if err == nil {
+		ctx.Data["HasPullRequest"] = true
+		ctx.Data["PullRequest"] = pr
+	} else if err != models.ErrPullRequestNotExist {
+		ctx.Handle(500, "GetUnmergedPullRequest", err)
+		return
+	}
+
+	ctx.HTML(200, PULL_NEW)
+}
+
+func NewPullRequestPost(ctx *middleware.Context, form auth.CreatePullRequestForm) {
+	ctx.Data["Title"] = "New Pull Request"
+	ctx.Data["IsRepoToolbarPulls"] = true
+
+	brs, err := ctx.Repo.GitRepo.GetBranches()
+	if err != nil {
+		ctx.Handle(500, "GetBranches", err)
+		return
+	}
+	ctx.Data["Branches"] = brs
+	ctx.Data["HeadRepos"], err = getHeadRepos(ctx)
+	if err != nil {
+		ctx.Handle(500, "getHeadRepos", err)
+		return
+	}
+	ctx.Data["IsCompared"] = true
+
+	headRepo, prInfo := parseCompareInfo(ctx, form.HeadRepo, form.BaseBranch, form.HeadBranch)
+	if ctx.Written() {
+		return
+	}
+
+	if ctx.HasError() {
+		ctx.HTML(200, PULL_NEW)
+		return
+	} else if prInfo.Commits.Len() == 0 {
+		ctx.Data["IsNothingToCompare"] = true
+		ctx.RenderWithErr(ctx.Tr("repo.pulls.nothing_to_compare"), PULL_NEW, &form)
+		return
+	}
+
+	if _, err = models.GetUnmergedPullRequest(headRepo.Id, ctx.Repo.Repository.Id,
+		form.HeadBranch, form.BaseBranch); err == nil {
+		ctx.RenderWithErr(ctx.Tr("repo.pulls.already_exist"), PULL_NEW, &form)
+		return
+	} else if err != models.ErrPullRequestNotExist {
+		ctx.Handle(500, "GetUnmergedPullRequest", err)
+		return
+	}
+
+	pull := &models.Issue{
+		RepoId:   ctx.Repo.Repository.Id,
+		Index:    ctx.Repo.Repository.NextIssueIndex(),
+		Name:     form.Title,
+		PosterId: ctx.User.Id,
+		Content:  form.Content,
+	}
+	pr := &models.PullRequest{
+		HeadRepoId:   headRepo.Id,
+		BaseRepoId:   ctx.Repo.Repository.Id,
+		HeadUserName: headRepo.Owner.Name,
+		HeadBranch:   form.HeadBranch,
+		BaseBranch:   form.BaseBranch,
+		MergeBase:    prInfo.MergeBase,
+	}
+	if err = models.NewPullRequest(ctx.Repo.Repository, pull, pr); err != nil {
+		ctx.Handle(500, "NewPullRequest", err)
+		return
+	}
+
+	if err = models.NotifyWatchers(&models.Action{
+		ActUserId:    ctx.User.Id,
+		ActUserName:  ctx.User.Name,
+		ActEmail:     ctx.User.Email,
+		OpType:       models.PULL_REQUEST,
+		Content:      fmt.Sprintf("%d|%s", pull.Index, pull.Name),
+		RepoId:       ctx.Repo.Repository.Id,
+		RepoUserName: ctx.Repo.Owner.Name,
+		RepoName:     ctx.Repo.Repository.Name,
+		IsPrivate:    ctx.Repo.Repository.IsPrivate,
+	}); err != nil {
+		ctx.Handle(500, "NotifyWatchers", err)
+		return
+	}
+
+	log.Trace("Pull request created: %d/%d", ctx.Repo.Repository.Id, pull.Id)
+	ctx.Redirect(fmt.Sprintf("%s/pulls/%d", ctx.Repo.RepoLink, pull.Index))
+}
+
+// checkPullInfo loads pull request of current index and its related information.
+func checkPullInfo(ctx *middleware.Context) *models.PullRequest {
+	idx := com.StrTo(ctx.Params(":index")).MustInt64()
+	if idx <= 0 {
+		ctx.Handle(404, "checkPullInfo", nil)
+		return nil
+	}
+
+	pull, err := models.GetIssueByIndex(ctx.Repo.Repository.Id, idx)
+	if err != nil {
+		if err == models.ErrIssueNotExist {
+			ctx.Handle(404, "GetIssueByIndex", err)
+		} else {
+			ctx.Handle(500, "GetIssueByIndex", err)
+		}
+		return nil
+	} else if !pull.IsPull {
+		ctx.Redirect(fmt.Sprintf("%s/issues/%d", ctx.Repo.RepoLink, pull.Index))
+		return nil
+	}
+
+	pr, err := models.GetPullRequestByPullId(pull.Id)
+	if err != nil {
+		ctx.Handle(500, "GetPullRequestByPullId", err)
+		return nil
+	}
+	pr.Issue = pull
+
+	if err = pr.GetHeadRepo(); err != nil && err != models.ErrRepoNotExist {
+		ctx.Handle(500, "GetHeadRepo", err)
+		return nil
+	}
+	pr.BaseRepo = ctx.Repo.Repository
+	pr.BaseRepo.Owner = ctx.Repo.Owner
+	if err = pr.GetMerger(); err != nil {
+		ctx.Handle(500, "GetMerger", err)
+		return nil
+	}
+
+	headCommitId, err := pr.HeadCommitId()
+	if err != nil {
+		ctx.Handle(500, "HeadCommitId", err)
+		return nil
+	}
+	commits, err := ctx.Repo.GitRepo.CommitsBetweenIds(headCommitId, pr.MergeBase)
+	if err != nil {
+		ctx.Handle(500, "CommitsBetweenIds", err)
+		return nil
+	}
+
+	ctx.Data["Title"] = pull.Name
+	ctx.Data["IsRepoToolbarPulls"] = true
+	ctx.Data["IsPullRequest"] = true
+	ctx.Data["PullRequest"] = pr
+	ctx.Data["Issue"] = pull
+	ctx.Data["HeadCommitId"] = headCommitId
+	ctx.Data["Commits"] = commits
+	ctx.Data["NumCommits"] = commits.Len()
+	ctx.Data["CommitCount"] = commits.Len()
+	ctx.Data["Username"] = ctx.Repo.Owner.Name
+	ctx.Data["Reponame"] = ctx.Repo.Repository.Name
+	return pr
+}
+
+func ViewPull(ctx *middleware.Context) {
+	ctx.Data["PageIsPullConversation"] = true
+
+	pr := checkPullInfo(ctx)
+	if ctx.Written() {
+		return
+	}
+
+	prepareIssueView(ctx, pr.Issue)
+	if ctx.Written() {
+		return
+	}
+	ctx.HTML(200, ISSUE_VIEW)
+}
+
+func ViewPullCommits(ctx *middleware.Context) {
+	ctx.Data["PageIsPullCommits"] = true
+
+	checkPullInfo(ctx)
+	if ctx.Written() {
+		return
+	}
+	ctx.HTML(200, PULL_VIEW_COMMITS)
+}
+
+func ViewPullFiles(ctx *middleware.Context) {
+	ctx.Data["PageIsPullFiles"] = true
+
+	pr := checkPullInfo(ctx)
+	if ctx.Written() {
+		return
+	}
+
+	headCommitId := ctx.Data["HeadCommitId"].(string)
+	headCommit, err := ctx.Repo.GitRepo.GetCommit(headCommitId)
+	if err != nil {
+		ctx.Handle(500, "GetCommit", err)
+		return
+	}
+
+	diff, err := models.GetDiffRange(models.RepoPath(ctx.Repo.Owner.Name, ctx.Repo.Repository.Name),
+		pr.MergeBase, headCommitId)
+	if err != nil {
+		ctx.Handle(500, "GetDiffRange", err)
+		return
+	}
+	setDiffData(ctx, ctx.Repo.RepoLink, headCommit, diff)
+
+	prepareLineComments(ctx, diff, pr.MergeBase, headCommitId, ctx.Data["Commits"].(*list.List))
+	if ctx.Written() {
+		return
+	}
+	ctx.HTML(200, PULL_VIEW_FILES)
+}
+
+func MergePullRequest(ctx *middleware.Context) {
+	if !ctx.Repo.IsOwner {
+		ctx.Handle(403, "MergePullRequest", nil)
+		return
+	}
+
+	pr := checkPullInfo(ctx)
+	if ctx.Written() {
+		return
+	}
+
+	if pr.Issue.IsClosed || pr.HasMerged {
+		ctx.Handle(404, "MergePullRequest", nil)
+		return
+	}
+
+	if err := pr.Merge(ctx.User); err != nil {
+		if err == models.ErrPullRequestNotMergeable {
+			ctx.Flash.Error(ctx.Tr("repo.pulls.cannot_auto_merge"))
+			ctx.Redirect(fmt.Sprintf("%s/pulls/%d", ctx.Repo.RepoLink, pr.Issue.Index))
+			return
+		} else if perr, ok := err.(models.ErrBranchProtected); ok {
+			ctx.Flash.Error(protectedBranchMessage(ctx, perr))
+			ctx.Redirect(fmt.Sprintf("%s/pulls/%d", ctx.Repo.RepoLink, pr.Issue.Index))
+			return
+		}
+		ctx.Handle(500, "Merge", err)
+		return
+	}
+
+	log.Trace("Pull request merged: %d", pr.Id)
+	ctx.Redirect(fmt.Sprintf("%s/pulls/%d", ctx.Repo.RepoLink, pr.Issue.Index))
+}
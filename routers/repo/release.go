@@ -75,7 +75,7 @@ func Releases(ctx *middleware.Context) {
 					rel.NumCommitsBehind = commitsCount - rel.NumCommits
 				}
 
-				rel.Note = base.RenderMarkdownString(rel.Note, ctx.Repo.RepoLink)
+				rel.Note = string(base.RenderMarkdownWithOptions([]byte(rel.Note), markdownOptions(ctx)))
 				tags[i] = rel
 				break
 			}
@@ -6,8 +6,6 @@ package repo
 
 import (
 	"fmt"
-	"os"
-	"path"
 	"strings"
 
 	"github.com/Unknwon/com"
@@ -23,6 +21,7 @@ import (
 const (
 	CREATE  base.TplName = "repo/create"
 	MIGRATE base.TplName = "repo/migrate"
+	FORKS   base.TplName = "repo/forks"
 )
 
 func Create(ctx *middleware.Context) {
@@ -216,6 +215,22 @@ func Action(ctx *middleware.Context) {
 		err = models.StarRepo(ctx.User.Id, ctx.Repo.Repository.Id, true)
 	case "unstar":
 		err = models.StarRepo(ctx.User.Id, ctx.Repo.Repository.Id, false)
+	case "fork":
+		ctx.Repo.Repository.Owner = ctx.Repo.Owner
+		repo, err := models.ForkRepository(ctx.User, ctx.Repo.Repository)
+		if err != nil {
+			if err == models.ErrRepoAlreadyExist {
+				ctx.Flash.Error(ctx.Tr("repo.fork_already_exist"))
+				ctx.Redirect(ctx.Repo.RepoLink)
+			} else {
+				ctx.Handle(500, "ForkRepository", err)
+			}
+			return
+		}
+		log.Trace("Repository forked: %s/%s -> %s/%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name,
+			ctx.User.Name, repo.Name)
+		ctx.Redirect("/" + ctx.User.Name + "/" + repo.Name)
+		return
 	case "desc":
 		if !ctx.Repo.IsOwner {
 			ctx.Error(404)
@@ -242,34 +257,69 @@ func Action(ctx *middleware.Context) {
 	})
 }
 
-func Download(ctx *middleware.Context) {
-	ext := "." + ctx.Params(":ext")
-
-	var archivePath string
-	switch ext {
-	case ".zip":
-		archivePath = path.Join(ctx.Repo.GitRepo.Path, "archives/zip")
-	case ".tar.gz":
-		archivePath = path.Join(ctx.Repo.GitRepo.Path, "archives/targz")
-	default:
-		ctx.Error(404)
+func Forks(ctx *middleware.Context) {
+	ctx.Data["Title"] = "Forks"
+
+	forks, err := models.GetForks(ctx.Repo.Repository)
+	if err != nil {
+		ctx.Handle(500, "GetForks", err)
 		return
 	}
 
-	if !com.IsDir(archivePath) {
-		if err := os.MkdirAll(archivePath, os.ModePerm); err != nil {
-			ctx.Handle(500, "Download -> os.MkdirAll(archivePath)", err)
-			return
+	// Hide private forks from users who cannot access them.
+	visibles := make([]*models.Repository, 0, len(forks))
+	for _, fork := range forks {
+		if fork.IsPrivate {
+			if !ctx.IsSigned {
+				continue
+			}
+			if has, _ := models.HasAccess(ctx.User.Name, fork.Owner.Name+"/"+fork.Name,
+				models.READABLE); !has {
+				continue
+			}
 		}
+		visibles = append(visibles, fork)
 	}
+	ctx.Data["Forks"] = visibles
+	ctx.HTML(200, FORKS)
+}
 
-	archivePath = path.Join(archivePath, ctx.Repo.CommitId+ext)
-	if !com.IsFile(archivePath) {
-		if err := ctx.Repo.Commit.CreateArchive(archivePath, git.ZIP); err != nil {
-			ctx.Handle(500, "Download -> CreateArchive "+archivePath, err)
+// Download serves archive of a branch, tag or commit, the format is decided
+// by extension of the name, e.g. "master.tar.gz". Query parameter "path"
+// limits the archive to given directory.
+func Download(ctx *middleware.Context) {
+	refName, archiveType, ok := git.ParseArchiveName(ctx.Params("*"))
+	if !ok {
+		ctx.Handle(404, "ParseArchiveName", nil)
+		return
+	}
+
+	commitId, err := ctx.Repo.GitRepo.GetCommitIdOfRevision(refName)
+	if err != nil {
+		ctx.Handle(404, "GetCommitIdOfRevision", err)
+		return
+	}
+	commit, err := ctx.Repo.GitRepo.GetCommit(commitId)
+	if err != nil {
+		ctx.Handle(500, "GetCommit", err)
+		return
+	}
+
+	name := ctx.Repo.Repository.Name + "-" + strings.Replace(refName, "/", "-", -1)
+	treePath := strings.Trim(ctx.Query("path"), "/")
+	if len(treePath) > 0 {
+		entry, err := commit.GetTreeEntryByPath(treePath)
+		if err != nil || !entry.IsDir() {
+			ctx.Handle(404, "GetTreeEntryByPath", err)
 			return
 		}
+		name += "-" + strings.Replace(treePath, "/", "-", -1)
 	}
 
-	ctx.ServeFile(archivePath, ctx.Repo.Repository.Name+"-"+base.ShortSha(ctx.Repo.CommitId)+ext)
+	archivePath, err := models.GetArchive(ctx.Repo.GitRepo.Path, commit, archiveType, treePath)
+	if err != nil {
+		ctx.Handle(500, "GetArchive", err)
+		return
+	}
+	ctx.ServeFile(archivePath, name+archiveType.Ext())
 }
@@ -0,0 +1,58 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/middleware"
+	"github.com/gogits/gogs/modules/setting"
+)
+
+const (
+	SEARCH        base.TplName = "repo/search"
+	SEARCH_GLOBAL base.TplName = "explore/code"
+
+	SEARCH_MAX_RESULTS = 50
+)
+
+// searchCode fills search results of keyword in query into data of context.
+func searchCode(ctx *middleware.Context, repoId int64) bool {
+	keyword := ctx.Query("q")
+	ctx.Data["Keyword"] = keyword
+	ctx.Data["IsCodeIndexerEnabled"] = setting.CodeIndexerEnabled
+	if len(keyword) == 0 {
+		return true
+	}
+
+	results, err := models.SearchCode(&models.CodeSearchOptions{
+		Keyword: keyword,
+		RepoId:  repoId,
+		User:    ctx.User,
+		Limit:   SEARCH_MAX_RESULTS,
+	})
+	if err != nil {
+		ctx.Handle(500, "SearchCode", err)
+		return false
+	}
+	ctx.Data["Results"] = results
+	return true
+}
+
+// Search searches code of default branch of current repository.
+func Search(ctx *middleware.Context) {
+	ctx.Data["Title"] = "Search - " + ctx.Repo.Repository.Name
+	if searchCode(ctx, ctx.Repo.Repository.Id) {
+		ctx.HTML(200, SEARCH)
+	}
+}
+
+// SearchGlobal searches code of all repositories that user is allowed to read.
+func SearchGlobal(ctx *middleware.Context) {
+	ctx.Data["Title"] = "Code Search"
+	if searchCode(ctx, 0) {
+		ctx.HTML(200, SEARCH_GLOBAL)
+	}
+}
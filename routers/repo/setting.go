@@ -24,6 +24,8 @@ import (
 const (
 	SETTINGS_OPTIONS base.TplName = "repo/settings/options"
 	COLLABORATION    base.TplName = "repo/settings/collaboration"
+	BRANCHES         base.TplName = "repo/settings/branches"
+	PROTECTED_BRANCH base.TplName = "repo/settings/protected_branch"
 	HOOKS            base.TplName = "repo/settings/hooks"
 	HOOK_NEW         base.TplName = "repo/settings/hook_new"
 )
@@ -247,6 +249,184 @@ func SettingsCollaboration(ctx *middleware.Context) {
 	ctx.HTML(200, COLLABORATION)
 }
 
+func SettingsBranches(ctx *middleware.Context) {
+	ctx.Data["Title"] = ctx.Tr("repo.settings")
+	ctx.Data["PageIsSettingsBranches"] = true
+
+	if ctx.Req.Method == "POST" {
+		branch := ctx.Query("branch")
+		if !ctx.Repo.GitRepo.IsBranchExist(branch) {
+			ctx.Redirect(ctx.Req.URL.Path)
+			return
+		}
+
+		has, err := models.IsBranchOfRepoProtected(ctx.Repo.Repository.Id, branch)
+		if err != nil {
+			ctx.Handle(500, "IsBranchOfRepoProtected", err)
+			return
+		} else if !has {
+			if err = models.UpdateProtectBranch(&models.ProtectBranch{
+				RepoId:           ctx.Repo.Repository.Id,
+				Name:             branch,
+				DisableForcePush: true,
+				DisableDeletion:  true,
+			}); err != nil {
+				ctx.Handle(500, "UpdateProtectBranch", err)
+				return
+			}
+			log.Trace("Branch protected: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, branch)
+			ctx.Flash.Success(ctx.Tr("repo.settings.protect_branch_success", branch))
+		}
+		ctx.Redirect(ctx.Repo.RepoLink + "/settings/branches/" + branch)
+		return
+	}
+
+	// Remove branch protection.
+	remove := ctx.Query("remove")
+	if len(remove) > 0 {
+		if err := models.DeleteProtectBranch(ctx.Repo.Repository.Id, remove); err != nil {
+			ctx.Handle(500, "DeleteProtectBranch", err)
+			return
+		}
+		log.Trace("Branch unprotected: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, remove)
+		ctx.Flash.Success(ctx.Tr("repo.settings.remove_protect_branch_success", remove))
+		ctx.Redirect(ctx.Repo.RepoLink + "/settings/branches")
+		return
+	}
+
+	pbs, err := models.GetProtectBranchesByRepoId(ctx.Repo.Repository.Id)
+	if err != nil {
+		ctx.Handle(500, "GetProtectBranchesByRepoId", err)
+		return
+	}
+	ctx.Data["ProtectBranches"] = pbs
+	ctx.HTML(200, BRANCHES)
+}
+
+// protectedBranchMessage returns translated message of an operation
+// that is rejected by protection rules of a branch.
+func protectedBranchMessage(ctx *middleware.Context, err models.ErrBranchProtected) string {
+	return ctx.Tr("repo.settings.protected_branch_"+err.Reason, err.Branch)
+}
+
+func getProtectBranch(ctx *middleware.Context) *models.ProtectBranch {
+	pb, err := models.GetProtectBranchOfRepoByName(ctx.Repo.Repository.Id, ctx.Params("*"))
+	if err != nil {
+		if err == models.ErrProtectBranchNotExist {
+			ctx.Handle(404, "GetProtectBranchOfRepoByName", nil)
+		} else {
+			ctx.Handle(500, "GetProtectBranchOfRepoByName", err)
+		}
+		return nil
+	}
+	ctx.Data["ProtectBranch"] = pb
+	return pb
+}
+
+func SettingsProtectedBranch(ctx *middleware.Context) {
+	ctx.Data["Title"] = ctx.Tr("repo.settings")
+	ctx.Data["PageIsSettingsBranches"] = true
+
+	pb := getProtectBranch(ctx)
+	if ctx.Written() {
+		return
+	}
+
+	users, err := pb.GetWhitelistUsers()
+	if err != nil {
+		ctx.Handle(500, "GetWhitelistUsers", err)
+		return
+	}
+	names := make([]string, len(users))
+	for i := range users {
+		names[i] = users[i].Name
+	}
+
+	teams, err := pb.GetWhitelistTeams()
+	if err != nil {
+		ctx.Handle(500, "GetWhitelistTeams", err)
+		return
+	}
+	teamNames := make([]string, len(teams))
+	for i := range teams {
+		teamNames[i] = teams[i].Name
+	}
+
+	ctx.Data["DisableForcePush"] = pb.DisableForcePush
+	ctx.Data["DisableDeletion"] = pb.DisableDeletion
+	ctx.Data["EnableWhitelist"] = pb.EnableWhitelist
+	ctx.Data["WhitelistUsers"] = strings.Join(names, ", ")
+	ctx.Data["WhitelistTeams"] = strings.Join(teamNames, ", ")
+	ctx.HTML(200, PROTECTED_BRANCH)
+}
+
+func SettingsProtectedBranchPost(ctx *middleware.Context, form auth.ProtectBranchForm) {
+	ctx.Data["Title"] = ctx.Tr("repo.settings")
+	ctx.Data["PageIsSettingsBranches"] = true
+
+	pb := getProtectBranch(ctx)
+	if ctx.Written() {
+		return
+	}
+
+	if ctx.HasError() {
+		ctx.HTML(200, PROTECTED_BRANCH)
+		return
+	}
+
+	userIds := make([]int64, 0, 5)
+	for _, name := range strings.Split(form.WhitelistUsers, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		u, err := models.GetUserByName(name)
+		if err != nil {
+			if err == models.ErrUserNotExist {
+				ctx.RenderWithErr(ctx.Tr("form.user_not_exist"), PROTECTED_BRANCH, &form)
+			} else {
+				ctx.Handle(500, "GetUserByName", err)
+			}
+			return
+		}
+		userIds = append(userIds, u.Id)
+	}
+
+	teamIds := make([]int64, 0, 5)
+	if ctx.Repo.Owner.IsOrganization() {
+		for _, name := range strings.Split(form.WhitelistTeams, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 {
+				continue
+			}
+			t, err := ctx.Repo.Owner.GetTeam(name)
+			if err != nil {
+				if err == models.ErrTeamNotExist {
+					ctx.RenderWithErr(ctx.Tr("form.team_not_exist"), PROTECTED_BRANCH, &form)
+				} else {
+					ctx.Handle(500, "GetTeam", err)
+				}
+				return
+			}
+			teamIds = append(teamIds, t.Id)
+		}
+	}
+
+	pb.DisableForcePush = form.DisableForcePush
+	pb.DisableDeletion = form.DisableDeletion
+	pb.EnableWhitelist = form.EnableWhitelist
+	pb.SetWhitelistUserIds(userIds)
+	pb.SetWhitelistTeamIds(teamIds)
+	if err := models.UpdateProtectBranch(pb); err != nil {
+		ctx.Handle(500, "UpdateProtectBranch", err)
+		return
+	}
+	log.Trace("Protect branch updated: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, pb.Name)
+
+	ctx.Flash.Success(ctx.Tr("repo.settings.update_protect_branch_success", pb.Name))
+	ctx.Redirect(ctx.Repo.RepoLink + "/settings/branches/" + pb.Name)
+}
+
 func Webhooks(ctx *middleware.Context) {
 	ctx.Data["Title"] = ctx.Tr("repo.settings")
 	ctx.Data["PageIsSettingsHooks"] = true
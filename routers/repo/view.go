@@ -6,14 +6,17 @@ package repo
 
 import (
 	"bytes"
+	"html"
+	"io"
 	"io/ioutil"
 	"path"
-	"path/filepath"
 	"strings"
 
+	"github.com/gogits/gogs/models"
 	"github.com/gogits/gogs/modules/base"
 	"github.com/gogits/gogs/modules/git"
 	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/markup"
 	"github.com/gogits/gogs/modules/middleware"
 
 	"code.google.com/p/mahonia"
@@ -82,49 +85,71 @@ func Home(ctx *middleware.Context) {
 	if entry != nil && !entry.IsDir() {
 		blob := entry.Blob()
 
-		if dataRc, err := blob.Data(); err != nil {
+		// Pointers of LFS objects are shown as content of objects.
+		var dataRc io.Reader
+		fileSize := blob.Size()
+		meta, lfsFile, err := openLFSContentOfBlob(ctx.Repo.Repository.Id, blob)
+		if err != nil {
+			ctx.Handle(500, "openLFSContentOfBlob", err)
+			return
+		} else if lfsFile != nil {
+			defer lfsFile.Close()
+			dataRc, fileSize = lfsFile, meta.Size
+			ctx.Data["IsLFSFile"] = true
+		} else if dataRc, err = blob.Data(); err != nil {
 			ctx.Handle(404, "blob.Data", err)
 			return
-		} else {
-			ctx.Data["FileSize"] = blob.Size()
-			ctx.Data["IsFile"] = true
-			ctx.Data["FileName"] = blob.Name()
-			ext := path.Ext(blob.Name())
-			if len(ext) > 0 {
-				ext = ext[1:]
-			}
-			ctx.Data["FileExt"] = ext
-			ctx.Data["FileLink"] = rawLink + "/" + treename
+		}
 
-			buf := make([]byte, 1024)
-			n, _ := dataRc.Read(buf)
-			if n > 0 {
-				buf = buf[:n]
-			}
+		ctx.Data["FileSize"] = fileSize
+		ctx.Data["IsFile"] = true
+		ctx.Data["FileName"] = blob.Name()
+		ext := path.Ext(blob.Name())
+		if len(ext) > 0 {
+			ext = ext[1:]
+		}
+		ctx.Data["FileExt"] = ext
+		ctx.Data["FileLink"] = rawLink + "/" + treename
+
+		buf := make([]byte, 1024)
+		n, _ := dataRc.Read(buf)
+		if n > 0 {
+			buf = buf[:n]
+		}
 
-			_, isTextFile := base.IsTextFile(buf)
-			_, isImageFile := base.IsImageFile(buf)
-			ctx.Data["IsFileText"] = isTextFile
-
-			switch {
-			case isImageFile:
-				ctx.Data["IsImageFile"] = true
-			case isTextFile:
-				d, _ := ioutil.ReadAll(dataRc)
-				buf = append(buf, d...)
-				readmeExist := base.IsMarkdownFile(blob.Name()) || base.IsReadmeFile(blob.Name())
-				ctx.Data["ReadmeExist"] = readmeExist
-				if readmeExist {
-					ctx.Data["FileContent"] = string(base.RenderMarkdown(buf, ""))
+		_, isTextFile := base.IsTextFile(buf)
+		_, isImageFile := base.IsImageFile(buf)
+		ctx.Data["IsFileText"] = isTextFile
+
+		switch {
+		case isImageFile:
+			ctx.Data["IsImageFile"] = true
+		case isTextFile:
+			d, _ := ioutil.ReadAll(dataRc)
+			buf = append(buf, d...)
+			renderer := markup.GetRenderer(blob.Name())
+			if renderer == nil && base.IsReadmeFile(blob.Name()) {
+				// READMEs without known extension are usually written in Markdown.
+				renderer = markup.MarkdownRenderer{}
+			}
+			readmeExist := false
+			if renderer != nil {
+				if content, err := markup.RenderWith(renderer, buf, ""); err != nil {
+					log.Error(4, "Render markup file(%s): %v", blob.Name(), err)
 				} else {
-					if err, content := toUtf8(buf); err != nil {
-						if err != nil {
-							log.Error(4, "Convert content encoding: %s", err)
-						}
-						ctx.Data["FileContent"] = string(buf)
-					} else {
-						ctx.Data["FileContent"] = content
+					readmeExist = true
+					ctx.Data["FileContent"] = string(content)
+				}
+			}
+			ctx.Data["ReadmeExist"] = readmeExist
+			if !readmeExist {
+				if err, content := toUtf8(buf); err != nil {
+					if err != nil {
+						log.Error(4, "Convert content encoding: %s", err)
 					}
+					ctx.Data["FileContent"] = string(buf)
+				} else {
+					ctx.Data["FileContent"] = content
 				}
 			}
 		}
@@ -142,28 +167,41 @@ func Home(ctx *middleware.Context) {
 		}
 		entries.Sort()
 
-		files := make([][]interface{}, 0, len(entries))
+		commits, err := models.GetLastCommitsOfEntries(ctx.Repo.GitRepo, ctx.Repo.Commit, treename, entries)
+		if err != nil {
+			ctx.Handle(500, "GetLastCommitsOfEntries", err)
+			return
+		}
 
+		files := make([][]interface{}, 0, len(entries))
 		for _, te := range entries {
-			c, err := ctx.Repo.Commit.GetCommitOfRelPath(filepath.Join(treePath, te.Name()))
+			files = append(files, []interface{}{te, commits[te.Name()]})
+		}
+
+		ctx.Data["Files"] = files
+
+		if len(treename) == 0 {
+			langs, err := models.GetRepoLanguages(ctx.Repo.Repository.Id)
 			if err != nil {
-				ctx.Handle(404, "GetCommitOfRelPath", err)
+				ctx.Handle(500, "GetRepoLanguages", err)
 				return
+			} else if ctx.Repo.BranchName == ctx.Repo.Repository.DefaultBranch &&
+				ctx.Repo.CommitId != ctx.Repo.Repository.LanguagesCommitId {
+				// Statistics may have not been computed yet, e.g. for migrated repositories.
+				models.UpdateRepoLanguagesInBackground(ctx.Repo.Repository)
 			}
-
-			files = append(files, []interface{}{te, c})
+			ctx.Data["Languages"] = langs
 		}
 
-		ctx.Data["Files"] = files
-
 		var readmeFile *git.Blob
 
 		for _, f := range entries {
 			if f.IsDir() || !base.IsReadmeFile(f.Name()) {
 				continue
-			} else {
+			}
+			// READMEs that can be rendered are preferred.
+			if readmeFile == nil || (markup.IsMarkupFile(f.Name()) && !markup.IsMarkupFile(readmeFile.Name())) {
 				readmeFile = f.Blob()
-				break
 			}
 		}
 
@@ -189,13 +227,16 @@ func Home(ctx *middleware.Context) {
 				if isTextFile {
 					d, _ := ioutil.ReadAll(dataRc)
 					buf = append(buf, d...)
-					switch {
-					case base.IsMarkdownFile(readmeFile.Name()):
-						buf = base.RenderMarkdown(buf, branchLink)
-					default:
-						buf = bytes.Replace(buf, []byte("\n"), []byte(`<br>`), -1)
+					var content []byte
+					if markup.IsMarkupFile(readmeFile.Name()) {
+						if content, err = markup.Render(readmeFile.Name(), buf, branchLink); err != nil {
+							log.Error(4, "Render README(%s): %v", readmeFile.Name(), err)
+						}
 					}
-					ctx.Data["FileContent"] = string(buf)
+					if content == nil {
+						content = bytes.Replace([]byte(html.EscapeString(string(buf))), []byte("\n"), []byte(`<br>`), -1)
+					}
+					ctx.Data["FileContent"] = string(content)
 				}
 			}
 		}
@@ -0,0 +1,376 @@
+// Copyright 2014 The Gogs Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/Unknwon/com"
+
+	"github.com/gogits/gogs/models"
+	"github.com/gogits/gogs/modules/auth"
+	"github.com/gogits/gogs/modules/base"
+	"github.com/gogits/gogs/modules/git"
+	"github.com/gogits/gogs/modules/log"
+	"github.com/gogits/gogs/modules/middleware"
+)
+
+const (
+	WIKI_START   base.TplName = "repo/wiki/start"
+	WIKI_VIEW    base.TplName = "repo/wiki/view"
+	WIKI_NEW     base.TplName = "repo/wiki/new"
+	WIKI_PAGES   base.TplName = "repo/wiki/pages"
+	WIKI_HISTORY base.TplName = "repo/wiki/history"
+)
+
+// openWiki sets common data of wiki pages and returns wiki repository and its latest commit,
+// commit is nil if wiki has no page yet. It returns false if error has been handled.
+func openWiki(ctx *middleware.Context) (*git.Repository, *git.Commit, bool) {
+	ctx.Data["Title"] = "Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["IsRepoToolbarWiki"] = true
+	ctx.Data["WikiLink"] = ctx.Repo.RepoLink + "/wiki"
+	ctx.Data["WikiCloneLink"] = map[string]string{
+		"SSH":   strings.TrimSuffix(ctx.Repo.CloneLink.SSH, ".git") + ".wiki.git",
+		"HTTPS": strings.TrimSuffix(ctx.Repo.CloneLink.HTTPS, ".git") + ".wiki.git",
+	}
+
+	wikiRepo, commit, err := ctx.Repo.Repository.OpenWikiRepository()
+	if err != nil {
+		ctx.Handle(500, "OpenWikiRepository", err)
+		return nil, nil, false
+	}
+	if commit != nil {
+		ctx.Data["LastCommitId"] = commit.Id.String()
+	}
+	return wikiRepo, commit, true
+}
+
+// readWikiPage returns raw content of wiki page at given commit.
+func readWikiPage(commit *git.Commit, name string) ([]byte, error) {
+	blob, err := commit.GetBlobByPath(models.WikiPageFileName(name))
+	if err != nil {
+		return nil, err
+	}
+	dataRc, err := blob.Data()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(dataRc)
+}
+
+// renderWikiPage renders Markdown content of wiki page,
+// relative links point to other pages of wiki.
+func renderWikiPage(ctx *middleware.Context, data []byte) string {
+	opts := markdownOptions(ctx)
+	opts.LinkPrefix = ctx.Repo.RepoLink + "/wiki"
+	return string(base.RenderMarkdownWithOptions(data, opts))
+}
+
+// checkWikiAccess makes sure current user has write access to wiki.
+func checkWikiAccess(ctx *middleware.Context) bool {
+	if !ctx.Repo.IsOwner {
+		ctx.Handle(404, "checkWikiAccess", nil)
+		return false
+	}
+	return true
+}
+
+func Wiki(ctx *middleware.Context) {
+	wikiRepo, commit, ok := openWiki(ctx)
+	if !ok {
+		return
+	} else if commit == nil {
+		ctx.HTML(200, WIKI_START)
+		return
+	}
+
+	pages, err := models.GetWikiPages(commit)
+	if err != nil {
+		ctx.Handle(500, "GetWikiPages", err)
+		return
+	}
+	ctx.Data["Pages"] = pages
+
+	name := models.WIKI_HOME_PAGE
+	if len(ctx.Params(":page")) > 0 {
+		name = models.ToWikiPageName(ctx.Params(":page"))
+	}
+
+	// Sidebar always comes from latest revision.
+	if data, err := readWikiPage(commit, models.WIKI_SIDEBAR_PAGE); err == nil {
+		ctx.Data["Sidebar"] = renderWikiPage(ctx, data)
+	} else if err != git.ErrNotExist {
+		ctx.Handle(500, "readWikiPage(sidebar)", err)
+		return
+	}
+
+	revision := ctx.Query("revision")
+	if len(revision) > 0 {
+		commit, err = wikiRepo.GetCommit(revision)
+		if err != nil {
+			ctx.Handle(404, "GetCommit", err)
+			return
+		}
+		ctx.Data["Revision"] = commit
+	}
+
+	data, err := readWikiPage(commit, name)
+	if err != nil {
+		if err != git.ErrNotExist {
+			ctx.Handle(500, "readWikiPage", err)
+			return
+		}
+		switch {
+		case len(revision) > 0:
+			ctx.Handle(404, "readWikiPage", nil)
+		case ctx.Repo.IsOwner:
+			ctx.Redirect(ctx.Repo.RepoLink + "/wiki/_new?title=" + models.ToWikiPageURL(name))
+		case name == models.WIKI_HOME_PAGE:
+			ctx.Redirect(ctx.Repo.RepoLink + "/wiki/_pages")
+		default:
+			ctx.Handle(404, "readWikiPage", nil)
+		}
+		return
+	}
+
+	lastCommit, err := commit.GetCommitOfRelPath(models.WikiPageFileName(name))
+	if err != nil {
+		ctx.Handle(500, "GetCommitOfRelPath", err)
+		return
+	}
+
+	ctx.Data["Title"] = name + " - Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["PageName"] = name
+	ctx.Data["PageURL"] = models.ToWikiPageURL(name)
+	ctx.Data["PageCommit"] = lastCommit
+	ctx.Data["Content"] = renderWikiPage(ctx, data)
+	ctx.HTML(200, WIKI_VIEW)
+}
+
+func WikiPages(ctx *middleware.Context) {
+	_, commit, ok := openWiki(ctx)
+	if !ok {
+		return
+	} else if commit == nil {
+		ctx.Redirect(ctx.Repo.RepoLink + "/wiki")
+		return
+	}
+	ctx.Data["Title"] = "Pages - Wiki - " + ctx.Repo.Repository.Name
+
+	pages, err := models.GetWikiPages(commit)
+	if err != nil {
+		ctx.Handle(500, "GetWikiPages", err)
+		return
+	} else if err = models.LoadWikiPagesUpdated(commit, pages); err != nil {
+		ctx.Handle(500, "LoadWikiPagesUpdated", err)
+		return
+	}
+	ctx.Data["Pages"] = pages
+	ctx.HTML(200, WIKI_PAGES)
+}
+
+func WikiHistory(ctx *middleware.Context) {
+	wikiRepo, commit, ok := openWiki(ctx)
+	if !ok {
+		return
+	} else if commit == nil {
+		ctx.Handle(404, "WikiHistory", nil)
+		return
+	}
+
+	name := models.ToWikiPageName(ctx.Params(":page"))
+	fileName := models.WikiPageFileName(name)
+	commitsCount, err := wikiRepo.FileCommitsCount(models.WIKI_BRANCH, fileName)
+	if err != nil {
+		ctx.Handle(500, "FileCommitsCount", err)
+		return
+	} else if commitsCount == 0 {
+		ctx.Handle(404, "FileCommitsCount", nil)
+		return
+	}
+
+	page := com.StrTo(ctx.Query("p")).MustInt()
+	if page < 1 {
+		page = 1
+	}
+	nextPage := page + 1
+	if nextPage*50 > commitsCount {
+		nextPage = 0
+	}
+
+	ctx.Data["Commits"], err = wikiRepo.CommitsByFileAndRange(models.WIKI_BRANCH, fileName, page)
+	if err != nil {
+		ctx.Handle(500, "CommitsByFileAndRange", err)
+		return
+	}
+
+	ctx.Data["Title"] = "History of " + name + " - Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["PageName"] = name
+	ctx.Data["PageURL"] = models.ToWikiPageURL(name)
+	ctx.Data["CommitCount"] = commitsCount
+	ctx.Data["LastPageNum"] = page - 1
+	ctx.Data["NextPageNum"] = nextPage
+	ctx.HTML(200, WIKI_HISTORY)
+}
+
+// handleWikiError renders template with a message of known error,
+// unknown errors are handled as internal errors.
+func handleWikiError(ctx *middleware.Context, err error, form *auth.NewWikiForm) {
+	var msg string
+	switch err {
+	case models.ErrWikiPageAlreadyExist:
+		msg = ctx.Tr("repo.wiki.page_already_exist")
+	case models.ErrWikiPageNotExist:
+		msg = ctx.Tr("repo.wiki.page_not_exist")
+	case models.ErrWikiPageNameIllegal:
+		msg = ctx.Tr("repo.wiki.page_name_illegal")
+	case models.ErrWikiOutdated:
+		msg = ctx.Tr("repo.wiki.outdated")
+	case models.ErrRepoFileNoChange:
+		msg = ctx.Tr("repo.wiki.no_change")
+	default:
+		ctx.Handle(500, "handleWikiError", err)
+		return
+	}
+	ctx.RenderWithErr(msg, WIKI_NEW, form)
+}
+
+func NewWiki(ctx *middleware.Context) {
+	if !checkWikiAccess(ctx) {
+		return
+	} else if _, _, ok := openWiki(ctx); !ok {
+		return
+	}
+	ctx.Data["Title"] = "New Page - Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["IsNewPage"] = true
+
+	title := models.ToWikiPageName(ctx.Query("title"))
+	if !ctx.Repo.Repository.HasWiki() && len(title) == 0 {
+		title = models.WIKI_HOME_PAGE
+	}
+	ctx.Data["title"] = title
+	ctx.HTML(200, WIKI_NEW)
+}
+
+func NewWikiPost(ctx *middleware.Context, form auth.NewWikiForm) {
+	if !checkWikiAccess(ctx) {
+		return
+	} else if _, _, ok := openWiki(ctx); !ok {
+		return
+	}
+	ctx.Data["Title"] = "New Page - Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["IsNewPage"] = true
+
+	if ctx.HasError() {
+		ctx.HTML(200, WIKI_NEW)
+		return
+	}
+
+	message := strings.TrimSpace(form.Message)
+	if len(message) == 0 {
+		message = "Create " + strings.TrimSpace(form.Title)
+	}
+	if err := ctx.Repo.Repository.UpdateWikiPage(ctx.User, models.UpdateWikiPageOptions{
+		LastCommitId: form.LastCommitId,
+		NewName:      form.Title,
+		Content:      strings.Replace(form.Content, "\r\n", "\n", -1),
+		Message:      message,
+		IsNewPage:    true,
+	}); err != nil {
+		handleWikiError(ctx, err, &form)
+		return
+	}
+	log.Trace("Wiki page created: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, form.Title)
+
+	ctx.Redirect(ctx.Repo.RepoLink + "/wiki/" + models.ToWikiPageURL(form.Title))
+}
+
+func EditWiki(ctx *middleware.Context) {
+	if !checkWikiAccess(ctx) {
+		return
+	}
+	_, commit, ok := openWiki(ctx)
+	if !ok {
+		return
+	} else if commit == nil {
+		ctx.Handle(404, "EditWiki", nil)
+		return
+	}
+
+	name := models.ToWikiPageName(ctx.Params(":page"))
+	data, err := readWikiPage(commit, name)
+	if err != nil {
+		if err == git.ErrNotExist {
+			ctx.Handle(404, "readWikiPage", nil)
+		} else {
+			ctx.Handle(500, "readWikiPage", err)
+		}
+		return
+	}
+
+	ctx.Data["Title"] = "Edit " + name + " - Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["PageName"] = name
+	ctx.Data["PageURL"] = models.ToWikiPageURL(name)
+	ctx.Data["title"] = name
+	ctx.Data["content"] = string(data)
+	ctx.HTML(200, WIKI_NEW)
+}
+
+func EditWikiPost(ctx *middleware.Context, form auth.NewWikiForm) {
+	if !checkWikiAccess(ctx) {
+		return
+	} else if _, _, ok := openWiki(ctx); !ok {
+		return
+	}
+
+	name := models.ToWikiPageName(ctx.Params(":page"))
+	ctx.Data["Title"] = "Edit " + name + " - Wiki - " + ctx.Repo.Repository.Name
+	ctx.Data["PageName"] = name
+	ctx.Data["PageURL"] = models.ToWikiPageURL(name)
+
+	if ctx.HasError() {
+		ctx.HTML(200, WIKI_NEW)
+		return
+	}
+
+	message := strings.TrimSpace(form.Message)
+	if len(message) == 0 {
+		message = "Update " + strings.TrimSpace(form.Title)
+	}
+	if err := ctx.Repo.Repository.UpdateWikiPage(ctx.User, models.UpdateWikiPageOptions{
+		LastCommitId: form.LastCommitId,
+		OldName:      name,
+		NewName:      form.Title,
+		Content:      strings.Replace(form.Content, "\r\n", "\n", -1),
+		Message:      message,
+	}); err != nil {
+		handleWikiError(ctx, err, &form)
+		return
+	}
+	log.Trace("Wiki page updated: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, form.Title)
+
+	ctx.Redirect(ctx.Repo.RepoLink + "/wiki/" + models.ToWikiPageURL(form.Title))
+}
+
+func DeleteWikiPagePost(ctx *middleware.Context) {
+	if !checkWikiAccess(ctx) {
+		return
+	}
+
+	name := models.ToWikiPageName(ctx.Params(":page"))
+	if err := ctx.Repo.Repository.DeleteWikiPage(ctx.User, name, "Delete "+name); err != nil {
+		if err == models.ErrWikiPageNotExist || err == models.ErrWikiPageNameIllegal {
+			ctx.Handle(404, "DeleteWikiPage", nil)
+		} else {
+			ctx.Handle(500, "DeleteWikiPage", err)
+		}
+		return
+	}
+	log.Trace("Wiki page deleted: %s/%s:%s", ctx.Repo.Owner.Name, ctx.Repo.Repository.Name, name)
+
+	ctx.Flash.Success(ctx.Tr("repo.wiki.delete_success", name))
+	ctx.Redirect(ctx.Repo.RepoLink + "/wiki/_pages")
+}